@@ -21,11 +21,16 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/transport"
 	"k8s.io/klog"
 
 	litmuschaosv1alpha1 "github.com/litmuschaos/chaos-operator/pkg/client/clientset/versioned"
@@ -38,13 +43,100 @@ var (
 	kubeconfig string
 )
 
+// revalidationWorkers is the number of chaosengines validated in parallel
+const revalidationWorkers = 2
+
 func main() {
-	var parameters webhook.Parameters
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate":
+			os.Exit(runValidate(os.Args[2:]))
+		case "render":
+			os.Exit(runRender(os.Args[2:]))
+		}
+	}
+
+	var (
+		parameters           webhook.Parameters
+		adminGroups          string
+		enabledValidators    string
+		disabledValidators   string
+		inconclusivePolicy   string
+		modeConfig           string
+		printErrorCodes      bool
+		skipBootstrap        bool
+		metricsPort          int
+		tracing              webhook.TracingOptions
+		logFormat            string
+		logVerbosity         string
+		audit                webhook.AuditOptions
+		auditSinks           string
+		auditFileMaxSizeMB   int64
+		revalidationInterval time.Duration
+		keyAlgorithm         string
+		keySize              int
+		keyCurve             string
+		tlsMinVersion        string
+		tlsCipherSuites      string
+		tlsCurves            string
+		tlsClientCAFile      string
+		protectionPolicy     string
+	)
 
 	// get command line parameters
 	flag.IntVar(&parameters.Port, "port", 8443, "Webhook server port.")
-	flag.StringVar(&parameters.CertFile, "tlsCertFile", "/etc/webhook/certs/cert.pem", "File containing the x509 Certificate for HTTPS.")
-	flag.StringVar(&parameters.KeyFile, "tlsKeyFile", "/etc/webhook/certs/key.pem", "File containing the x509 private key to --tlsCertFile.")
+	flag.DurationVar(&parameters.CertExpiryThreshold, "certExpiryThreshold", 24*time.Hour, "Time before the expiry of the serving certificate from which the admission controller isn't ready.")
+	flag.DurationVar(&parameters.CertRenewBefore, "certRenewBefore", 30*24*time.Hour, "Time before the expiry of the serving certificate from which it is reissued from the CA in the Secret.")
+	flag.DurationVar(&parameters.CertCheckInterval, "certCheckInterval", time.Hour, "Interval at which the certificates are checked for renewal, 0 disables the renewal.")
+	flag.DurationVar(&parameters.CARenewBefore, "caRenewBefore", 90*24*time.Hour, "Time before the expiry of the CA from which it is replaced by a new one.")
+	flag.DurationVar(&parameters.CAGracePeriod, "caGracePeriod", 24*time.Hour, "Time during which a replaced CA stays in the caBundle of the webhooks, longer than -certCheckInterval so that every replica reloads its certificate.")
+	flag.DurationVar(&parameters.CABundleSyncInterval, "caBundleSyncInterval", time.Minute, "Interval at which the caBundle of the webhooks is synced with the CAs of the Secret, 0 disables the sync.")
+	flag.BoolVar(&parameters.CertManager.Enabled, "certManager", false, "Serve the certificate issued by cert-manager to the -certManagerSecret Secret, reloaded when it is renewed, instead of a self-signed one. The caBundle of the webhooks is left to the cert-manager CA injector.")
+	flag.StringVar(&parameters.CertManager.Secret, "certManagerSecret", "admission-controller-tls", "Secret cert-manager issues the serving certificate to, with -certManager.")
+	flag.StringVar(&parameters.CertManager.Certificate, "certManagerCertificate", "admission-controller-certificate", "cert-manager Certificate the CA injector reads the caBundle from, with -certManager.")
+	flag.StringVar(&parameters.CertManager.Issuer, "certManagerIssuer", "", "Issuer of the Certificate created at startup, as Issuer/<name> or ClusterIssuer/<name>, with -certManager. Without it the Certificate must exist.")
+	flag.BoolVar(&parameters.CSR.Enabled, "csr", false, "Request the serving certificate of the Secret from the signer of the cluster through a certificates.k8s.io/v1beta1 CertificateSigningRequest instead of a self-signed CA, and renew it the same way. The caBundle of the webhooks is set to -csrCAFile. The request goes to the kubernetes.io/legacy-unknown signer, removed in Kubernetes 1.22.")
+	flag.BoolVar(&parameters.CSR.AutoApprove, "csrAutoApprove", false, "Approve the CertificateSigningRequest, with -csr. Without it, or without the authorization to approve, the CertificateSigningRequest waits for its approval.")
+	flag.StringVar(&parameters.CSR.CAFile, "csrCAFile", "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt", "File containing the CA of the signer of the cluster, with -csr.")
+	flag.DurationVar(&parameters.CSR.ApprovalTimeout, "csrApprovalTimeout", 10*time.Minute, "Time the certificate of a CertificateSigningRequest is waited for, with -csr.")
+	flag.StringVar(&tracing.Endpoint, "otlpEndpoint", "", "host:port of the OTLP/HTTP collector the traces are exported to, tracing is disabled if empty.")
+	flag.BoolVar(&tracing.Insecure, "otlpInsecure", false, "Export the traces over HTTP instead of HTTPS.")
+	flag.Float64Var(&tracing.SampleRatio, "traceSampleRatio", 1, "Ratio of the admission requests traced, requests sampled by the API server are always traced.")
+	flag.IntVar(&metricsPort, "metricsPort", 8080, "Port serving the prometheus metrics on /metrics over HTTP, 0 disables metrics.")
+	flag.StringVar(&parameters.CertFile, "tlsCertFile", "", "File containing the x509 Certificate for HTTPS, served instead of the Secret and reloaded when it changes.")
+	flag.StringVar(&parameters.KeyFile, "tlsKeyFile", "", "File containing the x509 private key to --tlsCertFile.")
+	flag.StringVar(&parameters.CAFile, "tlsCAFile", "", "File containing the CA which signed --tlsCertFile, set in the caBundle of the webhooks. Without it the caBundle is left to the user.")
+	flag.DurationVar(&parameters.CertFileCheckInterval, "tlsFileCheckInterval", 10*time.Second, "Interval at which --tlsCertFile, --tlsKeyFile and --tlsCAFile are checked for changes, 0 disables the reload.")
+	flag.StringVar(&tlsMinVersion, "tlsMinVersion", "1.2", "Minimum TLS version of the server, either 1.2 or 1.3.")
+	flag.StringVar(&tlsCipherSuites, "tlsCipherSuites", "", "Comma separated TLS 1.2 cipher suites of the server, i.e. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, the secure defaults of Go if empty. Insecure suites are rejected.")
+	flag.StringVar(&tlsCurves, "tlsCurves", "", "Comma separated curves of the key exchange in order of preference, among X25519, P-256, P-384 and P-521, the defaults of Go if empty.")
+	flag.StringVar(&tlsClientCAFile, "tlsClientCAFile", "", "File containing the CAs of the client certificate the API server must present to the validation endpoint, mutual TLS is disabled if empty.")
+	flag.DurationVar(&revalidationInterval, "revalidationInterval", 10*time.Minute, "Interval at which existing ChaosEngines are validated again, 0 disables revalidation.")
+	flag.StringVar(&protectionPolicy, "protectionFailurePolicy", "Ignore", "Failure policy of the webhook protecting the admission controller Secret and Service, either Ignore or Fail. Fail denies their updates while the admission controller is down, including its own ones at startup, i.e. on upgrades with a single replica.")
+	flag.StringVar(&adminGroups, "adminGroups", "system:masters", "Comma separated user groups allowed to modify the admission controller Secret and Service.")
+	flag.StringVar(&enabledValidators, "enableValidators", "", "Comma separated validators to run besides the mandatory ones, all validators run if empty.")
+	flag.IntVar(&parameters.ValidatorWorkers, "validatorWorkers", 8, "Number of validators run at once across all admission requests.")
+	flag.DurationVar(&parameters.ValidatorTimeout, "validatorTimeout", 0, "Timeout of every validator, 0 bounds validators by the timeout of the admission request only.")
+	flag.StringVar(&inconclusivePolicy, "inconclusivePolicy", string(webhook.InconclusiveAllow), "Whether validators which time out allow or deny the request, either allow or deny.")
+	flag.StringVar(&kubeconfig, "kubeconfig", "", "Path to a kubeconfig, only required if out-of-cluster.")
+	flag.StringVar(&masterURL, "master", "", "Address of the kubernetes API server, overrides the one of -kubeconfig. Only required if out-of-cluster.")
+	flag.StringVar(&parameters.DevHost, "devHost", "", "Run out of the cluster for development: serve a certificate minted for this host or IP, at which the API server reaches the webhook server, and register the webhooks with its URL. LITMUS_NAMESPACE defaults to litmus.")
+	flag.BoolVar(&skipBootstrap, "skipBootstrap", false, "Don't create the Secret, Service and ValidatingWebhookConfiguration, i.e. when they are applied from the manifests of the render subcommand.")
+	flag.BoolVar(&printErrorCodes, "printErrorCodes", false, "Print the catalog of the error codes returned with validation failures and exit.")
+	flag.StringVar(&modeConfig, "modeConfig", "", "File holding the enforce, warn or audit mode of the validators, all validators are enforced if empty.")
+	flag.StringVar(&disabledValidators, "disableValidators", "", "Comma separated validators not to run, mandatory validators can't be disabled.")
+	flag.StringVar(&auditSinks, "auditSinks", "", "Comma separated sinks the admission decisions are recorded to, either stdout, file:<path> or an http(s):// URL, auditing is disabled if empty.")
+	flag.IntVar(&audit.QueueSize, "auditQueueSize", 1000, "Number of decision records waiting for delivery, further records are dropped.")
+	flag.IntVar(&audit.BatchSize, "auditBatchSize", 100, "Maximum number of decision records delivered at once.")
+	flag.DurationVar(&audit.FlushInterval, "auditFlushInterval", 5*time.Second, "Interval at which partial batches of decision records are delivered.")
+	flag.IntVar(&audit.MaxRetries, "auditMaxRetries", 3, "Number of times a failed delivery of decision records is retried.")
+	flag.Int64Var(&auditFileMaxSizeMB, "auditFileMaxSizeMB", 100, "Size in megabytes at which the audit file is rotated.")
+	flag.IntVar(&audit.FileMaxBackups, "auditFileMaxBackups", 5, "Number of rotated audit files kept.")
+	flag.StringVar(&keyAlgorithm, "keyAlgorithm", webhook.KeyAlgorithmRSA, "Algorithm of the keys of the self-signed CA and certificates, either RSA or ECDSA. Certificates with another key are renewed at the next check.")
+	flag.IntVar(&keySize, "keySize", 2048, "Size in bits of the RSA keys, at least 2048.")
+	flag.StringVar(&keyCurve, "keyCurve", "P-256", "Curve of the ECDSA keys, either P-256 or P-384.")
+	flag.StringVar(&logFormat, "logFormat", string(webhook.LogFormatText), "Format of the logs, either text or json.")
+	flag.StringVar(&logVerbosity, "logVerbosity", "", "Comma separated subsystem=verbosity pairs overriding -v for the bootstrap, tls, http, validators and revalidation subsystems, i.e. validators=4.")
 
 	klog.InitFlags(nil)
 	err := flag.Set("logtostderr", "true")
@@ -52,76 +144,250 @@ func main() {
 		klog.Info(err, "failed to set logtostderr flag")
 	}
 	flag.Parse()
+	if err := configureLogging(logFormat, logVerbosity); err != nil {
+		klog.Fatal(err)
+	}
+	log := webhook.Logger(webhook.SubsystemBootstrap)
+	if printErrorCodes {
+		if err := webhook.WriteErrorCodes(os.Stdout); err != nil {
+			fatal(err, "Failed to print the error codes")
+		}
+		return
+	}
+	keyOptions, err := webhook.ParseKeyOptions(keyAlgorithm, keySize, keyCurve)
+	if err != nil {
+		fatal(err, "Invalid key options")
+	}
+	webhook.SetKeyOptions(keyOptions)
+	parameters.TLS, err = webhook.ParseTLSOptions(tlsMinVersion, splitList(tlsCipherSuites), splitList(tlsCurves), tlsClientCAFile)
+	if err != nil {
+		fatal(err, "Invalid TLS options")
+	}
+	certificateMode, err := parameters.CertificateMode()
+	if err != nil {
+		fatal(err, "Invalid certificate options")
+	}
+	if err := webhook.SetProtectionFailurePolicy(protectionPolicy); err != nil {
+		fatal(err, "Invalid -protectionFailurePolicy")
+	}
+	parameters.AdminGroups = splitList(adminGroups)
+	parameters.EnabledValidators = splitList(enabledValidators)
+	parameters.DisabledValidators = splitList(disabledValidators)
+	parameters.InconclusivePolicy, err = webhook.ParseInconclusivePolicy(inconclusivePolicy)
+	if err != nil {
+		fatal(err, "Invalid -inconclusivePolicy")
+	}
+	if modeConfig != "" {
+		parameters.Modes, err = webhook.LoadModeConfig(modeConfig)
+		if err != nil {
+			fatal(err, "Failed to load -modeConfig", "file", modeConfig)
+		}
+	}
+
+	audit.Sinks = splitList(auditSinks)
+	audit.FileMaxSize = auditFileMaxSizeMB << 20
+	parameters.Auditor, err = webhook.NewAuditor(audit)
+	if err != nil {
+		fatal(err, "Invalid -auditSinks")
+	}
 
-	// Get in cluster config
-	cfg, err := getClusterConfig(kubeconfig)
+	shutdownTracing, err := webhook.InitTracing(context.Background(), tracing)
 	if err != nil {
-		klog.Fatalf("Error building kubeconfig: %s", err.Error())
+		fatal(err, "Failed to init tracing")
+	}
+
+	if _, found := os.LookupEnv("LITMUS_NAMESPACE"); !found && parameters.DevHost != "" {
+		os.Setenv("LITMUS_NAMESPACE", "litmus")
+	}
+
+	// Get in cluster config, or the one of -kubeconfig
+	cfg, err := getClusterConfig(masterURL, kubeconfig)
+	if err != nil {
+		fatal(err, "Error building kubeconfig")
+	}
+	if tracing.Endpoint != "" {
+		cfg.WrapTransport = transport.Wrappers(cfg.WrapTransport, webhook.TracingTransport)
 	}
 	// Building Kubernetes Clientset
 	kubeClient, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
-		klog.Fatalf("Error building kubernetes clientset: %s", err.Error())
+		fatal(err, "Error building kubernetes clientset")
 	}
 
 	// Building Litmus Clientset
 	litmusClient, err := litmuschaosv1alpha1.NewForConfig(cfg)
 	if err != nil {
-		klog.Fatalf("Error building litmus clientset: %s", err.Error())
-	}
-	// Fetch a reference to the admission server deployment object
-	ownerReference, err := webhook.GetAdmissionReference(kubeClient)
-	if err != nil {
-		klog.Fatal(err, "failed to get a reference to the admission deployment object")
+		fatal(err, "Error building litmus clientset")
 	}
-	validatorErr := webhook.InitValidationServer(*ownerReference, kubeClient)
-	if validatorErr != nil {
-		klog.Fatal(validatorErr, "failed to initialize validation server")
+	if skipBootstrap || parameters.DevHost != "" {
+		log.Info("Skipping the creation of the Secret, Service and ValidatingWebhookConfiguration")
+	} else {
+		// Fetch a reference to the admission server deployment object
+		ownerReference, err := webhook.GetAdmissionReference(kubeClient)
+		if err != nil {
+			fatal(err, "Failed to get a reference to the admission deployment object")
+		}
+		var validatorErr error
+		switch certificateMode {
+		case webhook.CertificateModeFiles:
+			validatorErr = webhook.InitCertFileServer(*ownerReference, parameters.CAFile, kubeClient)
+		case webhook.CertificateModeCertManager:
+			dynamicClient, err := dynamic.NewForConfig(cfg)
+			if err != nil {
+				fatal(err, "Error building dynamic client")
+			}
+			validatorErr = webhook.InitCertManagerServer(*ownerReference, parameters.CertManager, kubeClient, dynamicClient)
+		case webhook.CertificateModeCSR:
+			validatorErr = webhook.InitCSRServer(*ownerReference, parameters.CSR, parameters.CAGracePeriod, kubeClient)
+		default:
+			validatorErr = webhook.InitValidationServer(*ownerReference, kubeClient)
+		}
+		if validatorErr != nil {
+			fatal(validatorErr, "Failed to initialize validation server")
+		}
 	}
 
 	wh, err := webhook.New(parameters, kubeClient, litmusClient)
 	if err != nil {
-		klog.Fatalf("failed to create validation webhook: %s", err.Error())
+		fatal(err, "Failed to create validation webhook")
 	}
+	// revalidate existing chaosengines once the informers are synced
+	stopCh := make(chan struct{})
+	if revalidationInterval > 0 {
+		revalidator := webhook.NewRevalidator(wh, revalidationInterval)
+		go func() {
+			if err := revalidator.Run(revalidationWorkers, stopCh); err != nil {
+				log.Error(err, "Failed to run chaosengine revalidation")
+			}
+		}()
+	}
+
+	// serve metrics over plain HTTP, apart from the webhook server
+	var metricsServer *http.Server
+	if metricsPort > 0 {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", webhook.MetricsHandler())
+		metricsServer = &http.Server{Addr: fmt.Sprintf(":%v", metricsPort), Handler: metricsMux}
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Error(err, "Failed to listen and serve metrics server")
+			}
+		}()
+	}
+
 	// define http server and server handler
 	mux := http.NewServeMux()
 	mux.HandleFunc("/validate", wh.Serve)
+	mux.HandleFunc("/healthz", wh.ServeLiveness)
+	mux.HandleFunc("/readyz", wh.ServeReadiness)
 	wh.Server.Handler = mux
 
-	// start webhook server in new routine
+	// start webhook server in new routine, it isn't ready and gets no
+	// admission requests until the informer caches are synced
 	go func() {
 		if err := wh.Server.ListenAndServeTLS("", ""); err != nil {
-			klog.Errorf("Failed to listen and serve webhook server: %v", err)
+			log.Error(err, "Failed to listen and serve webhook server")
 		}
 	}()
 
-	klog.Info("Webhook server started")
+	// the readiness probe reads the outcome of the periodic check of the
+	// webhook configuration
+	go wh.RunWebhookConfigurationCheck(stopCh)
+
+	// validations read from the informer caches
+	if err := wh.Start(stopCh); err != nil {
+		fatal(err, "Failed to start informers")
+	}
+
+	// renew the certificates before they expire and keep the caBundle in sync,
+	// the server picks up a renewed certificate without a restart
+	go wh.RunCertRotation(stopCh)
+
+	log.Info("Webhook server started")
 
 	// listening OS shutdown singal
 	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, syscall.SIGKILL, syscall.SIGTERM)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGKILL, syscall.SIGTERM)
 	<-signalChan
 
-	klog.Infof("Got OS shutdown signal, shutting down webhook server gracefully...")
+	log.Info("Got OS shutdown signal, shutting down webhook server gracefully")
+	close(stopCh)
 	err = wh.Server.Shutdown(context.Background())
 	if err != nil {
-		klog.Errorf("failed to shutdown server: error {%v}", err)
+		log.Error(err, "Failed to shutdown server")
+	}
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(context.Background()); err != nil {
+			log.Error(err, "Failed to shutdown metrics server")
+		}
+	}
+	if parameters.DevHost != "" {
+		if err := wh.RemoveDevWebhooks(); err != nil {
+			log.Error(err, "Failed to remove the development webhooks")
+		}
+	}
+	if err := shutdownTracing(context.Background()); err != nil {
+		log.Error(err, "Failed to flush traces")
+	}
+	auditCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := parameters.Auditor.Close(auditCtx); err != nil {
+		log.Error(err, "Failed to flush decision records")
 	}
 }
 
-// GetClusterConfig return the config for k8s.
-func getClusterConfig(kubeconfig string) (*rest.Config, error) {
-	var masterURL string
-	cfg, err := rest.InClusterConfig()
-	if err != nil {
-		klog.Errorf("Failed to get k8s Incluster config. %+v", err)
-		if kubeconfig == "" {
-			return nil, fmt.Errorf("Kubeconfig is empty: %v", err.Error())
-		}
-		cfg, err = clientcmd.BuildConfigFromFlags(masterURL, kubeconfig)
+// GetClusterConfig return the config for k8s, the in-cluster one unless a
+// kubeconfig or master URL is given.
+func getClusterConfig(masterURL, kubeconfig string) (*rest.Config, error) {
+	if kubeconfig != "" || masterURL != "" {
+		cfg, err := clientcmd.BuildConfigFromFlags(masterURL, kubeconfig)
 		if err != nil {
 			return nil, fmt.Errorf("Error building kubeconfig: %s", err.Error())
 		}
+		return cfg, nil
+	}
+	cfg, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get k8s Incluster config, -kubeconfig is required out of the cluster: %v", err)
+	}
+	return cfg, nil
+}
+
+// configureLogging sets the format of the logs and the verbosity of the
+// subsystems, the ones missing from logVerbosity log at the verbosity of -v
+func configureLogging(logFormat, logVerbosity string) error {
+	format, err := webhook.ParseLogFormat(logFormat)
+	if err != nil {
+		return err
+	}
+	subsystems, err := webhook.ParseLogVerbosity(logVerbosity)
+	if err != nil {
+		return err
+	}
+	verbosity, err := strconv.Atoi(flag.Lookup("v").Value.String())
+	if err != nil {
+		return fmt.Errorf("invalid verbosity -v: %v", err)
+	}
+	return webhook.ConfigureLogging(os.Stderr, webhook.LogOptions{
+		Format:     format,
+		Verbosity:  verbosity,
+		Subsystems: subsystems,
+	})
+}
+
+// fatal logs the error as a bootstrap failure and exits
+func fatal(err error, msg string, keysAndValues ...interface{}) {
+	webhook.Logger(webhook.SubsystemBootstrap).Error(err, msg, keysAndValues...)
+	os.Exit(1)
+}
+
+// splitList returns the non empty items of a comma separated list
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
-	return cfg, err
+	return items
 }
@@ -0,0 +1,89 @@
+// Copyright © 2019 The LitmusChaos Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/litmuschaos/admission-controllers/pkg/webhook"
+)
+
+// runRender writes the manifests of the admission controller to stdout and
+// returns the exit code
+func runRender(args []string) int {
+	var (
+		opts       webhook.RenderOptions
+		operations string
+		serverArgs string
+		timeout    int
+		algorithm  string
+		keySize    int
+		curve      string
+	)
+	flags := flag.NewFlagSet("render", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s render [flags]\n\n"+
+			"Prints the Deployment, Service, ValidatingWebhookConfiguration and RBAC of the admission\n"+
+			"controller as YAML. The rendered server runs with -skipBootstrap and creates none of them.\n"+
+			"The Service, Secret and ValidatingWebhookConfiguration keep the names the server looks for,\n"+
+			"admission-controller-svc, admission-controller-secret and litmuschaos-validation-webhook-cfg.\n\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&opts.Namespace, "namespace", "litmus", "Namespace of the admission controller.")
+	flags.StringVar(&opts.Name, "name", "litmus-admission-controllers", "Name of the Deployment, ServiceAccount, ClusterRole and ClusterRoleBinding.")
+	flags.StringVar(&opts.Image, "image", "litmuschaos/admission-controllers:ci", "Image of the admission controller.")
+	flags.StringVar(&operations, "operations", strings.Join(webhook.DefaultOperations, ","), "Comma separated ChaosEngine operations sent to the webhook, CREATE and UPDATE. Without UPDATE engines can be retargeted once created.")
+	flags.StringVar(&opts.FailurePolicy, "failurePolicy", "Ignore", "Failure policy of the webhooks but the protection one, either Ignore or Fail.")
+	flags.StringVar(&opts.ProtectionFailurePolicy, "protectionFailurePolicy", "Fail", "Failure policy of the webhook protecting the Secret and Service, either Ignore or Fail.")
+	flags.IntVar(&timeout, "timeoutSeconds", 5, "Timeout of the webhook calls, between 1 and 30 seconds.")
+	flags.BoolVar(&opts.Certificates, "certificates", false, "Print a Secret holding a new self-signed certificate and set its CA in the caBundle of the webhooks. Otherwise the Secret and the caBundle must be provided.")
+	flags.BoolVar(&opts.Rotation, "rotation", false, "Keep the renewal of the certificate in the Secret and the sync of the caBundle of the webhooks, which then differ from the printed manifests. Otherwise the server only reads them.")
+	flags.BoolVar(&opts.CSR, "csr", false, "Request the certificate of the Secret from the signer of the cluster, with -rotation, and grant the CertificateSigningRequests.")
+	flags.BoolVar(&opts.CSRAutoApprove, "csrAutoApprove", false, "Approve the CertificateSigningRequests, with -csr, and grant their approval for the kubernetes.io/legacy-unknown signer.")
+	flags.StringVar(&algorithm, "keyAlgorithm", webhook.KeyAlgorithmRSA, "Algorithm of the keys of the -certificates Secret, either RSA or ECDSA.")
+	flags.IntVar(&keySize, "keySize", 2048, "Size in bits of the RSA keys, at least 2048.")
+	flags.StringVar(&curve, "keyCurve", "P-256", "Curve of the ECDSA keys, either P-256 or P-384.")
+	flags.StringVar(&serverArgs, "serverArgs", "", "Comma separated arguments added to the admission controller, i.e. -v=2.")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	opts.Operations = splitList(operations)
+	opts.Args = splitList(serverArgs)
+	opts.TimeoutSeconds = int32(timeout)
+	keyOptions, err := webhook.ParseKeyOptions(algorithm, keySize, curve)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid key options: %v\n", err)
+		return 2
+	}
+	webhook.SetKeyOptions(keyOptions)
+	// the server renews the certificates with the same keys
+	var keyArgs []string
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "keyAlgorithm", "keySize", "keyCurve":
+			keyArgs = append(keyArgs, fmt.Sprintf("-%s=%s", f.Name, f.Value))
+		}
+	})
+	opts.Args = append(keyArgs, opts.Args...)
+
+	if err := webhook.Render(os.Stdout, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to render manifests: %v\n", err)
+		return 1
+	}
+	return 0
+}
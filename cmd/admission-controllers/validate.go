@@ -0,0 +1,177 @@
+// Copyright © 2019 The LitmusChaos Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	litmuschaosv1alpha1 "github.com/litmuschaos/chaos-operator/pkg/client/clientset/versioned"
+
+	"github.com/litmuschaos/admission-controllers/pkg/webhook"
+)
+
+// Exit codes of the validate subcommand
+const (
+	validateAllowed = 0
+	validateDenied  = 1
+	validateFailed  = 2
+)
+
+// validatedKinds are the kinds of the manifests read by the validate
+// subcommand, the other manifests are left out. The ChaosExperiments are only
+// fixtures of the ChaosEngines, and reported as skipped.
+var validatedKinds = map[string]bool{"ChaosEngine": true, "ChaosExperiment": true}
+
+// runValidate runs the validators against the ChaosEngines and
+// ChaosExperiments of the given files and directories, and returns the exit
+// code: 1 if one of them is denied, 2 if the validation could not run. The
+// skipped manifests don't change the exit code.
+func runValidate(args []string) int {
+	var (
+		parameters         webhook.Parameters
+		kubeconfig         string
+		fixtures           string
+		output             string
+		namespace          string
+		litmusNamespace    string
+		enabledValidators  string
+		disabledValidators string
+		modeConfig         string
+	)
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s validate [flags] <file or directory>...\n\n"+
+			"Validates the ChaosEngines of the given YAML or JSON manifests, against the cluster\n"+
+			"of -kubeconfig or against the objects of -fixtures. Their ChaosExperiments are\n"+
+			"reported as skipped, no validator runs against them.\n\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&kubeconfig, "kubeconfig", "", "Kubeconfig of the cluster the manifests are validated against.")
+	flags.StringVar(&fixtures, "fixtures", "", "File or directory holding the cluster objects the manifests are validated against, instead of a cluster.")
+	flags.StringVar(&output, "output", string(webhook.ReportFormatText), "Format of the verdicts, either text, json or junit.")
+	flags.StringVar(&namespace, "namespace", "default", "Namespace of the manifests which have none.")
+	flags.StringVar(&litmusNamespace, "litmusNamespace", "litmus", "Namespace of the litmus control plane, unless set by LITMUS_NAMESPACE.")
+	flags.StringVar(&enabledValidators, "enableValidators", "", "Comma separated validators to run besides the mandatory ones, all validators run if empty.")
+	flags.StringVar(&disabledValidators, "disableValidators", "", "Comma separated validators not to run, mandatory validators can't be disabled.")
+	flags.StringVar(&modeConfig, "modeConfig", "", "File holding the enforce, warn or audit mode of the validators, all validators are enforced if empty.")
+	flags.IntVar(&parameters.ValidatorWorkers, "validatorWorkers", 8, "Number of validators run at once.")
+	if err := flags.Parse(args); err != nil {
+		return validateFailed
+	}
+	fail := func(err error, msg string) int {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", msg, err)
+		return validateFailed
+	}
+
+	format, err := webhook.ParseReportFormat(output)
+	if err != nil {
+		return fail(err, "Invalid -output")
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return validateFailed
+	}
+	if (kubeconfig == "") == (fixtures == "") {
+		return fail(fmt.Errorf("exactly one of -kubeconfig and -fixtures must be set"), "Invalid flags")
+	}
+	if _, found := os.LookupEnv("LITMUS_NAMESPACE"); !found {
+		os.Setenv("LITMUS_NAMESPACE", litmusNamespace)
+	}
+	parameters.EnabledValidators = splitList(enabledValidators)
+	parameters.DisabledValidators = splitList(disabledValidators)
+	if modeConfig != "" {
+		if parameters.Modes, err = webhook.LoadModeConfig(modeConfig); err != nil {
+			return fail(err, "Failed to load -modeConfig")
+		}
+	}
+
+	loaded, err := webhook.LoadManifests(flags.Args())
+	if err != nil {
+		return fail(err, "Failed to load manifests")
+	}
+	var manifests []webhook.Manifest
+	for _, manifest := range loaded {
+		if !validatedKinds[manifest.Object.GetKind()] {
+			continue
+		}
+		if manifest.Object.GetNamespace() == "" {
+			manifest.Object.SetNamespace(namespace)
+		}
+		manifests = append(manifests, manifest)
+	}
+
+	var (
+		kubeClient   kubernetes.Interface
+		litmusClient litmuschaosv1alpha1.Interface
+	)
+	if fixtures != "" {
+		objects, err := webhook.LoadManifests([]string{fixtures})
+		if err != nil {
+			return fail(err, "Failed to load -fixtures")
+		}
+		// the ChaosExperiments under validation may be used by the
+		// ChaosEngines under validation
+		for _, manifest := range manifests {
+			if manifest.Object.GetKind() == "ChaosExperiment" {
+				objects = append(objects, manifest)
+			}
+		}
+		kubeClient, litmusClient, err = webhook.NewFakeClients(objects)
+		if err != nil {
+			return fail(err, "Failed to load -fixtures")
+		}
+	} else {
+		cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+		if err != nil {
+			return fail(err, "Error building kubeconfig")
+		}
+		if kubeClient, err = kubernetes.NewForConfig(cfg); err != nil {
+			return fail(err, "Error building kubernetes clientset")
+		}
+		if litmusClient, err = litmuschaosv1alpha1.NewForConfig(cfg); err != nil {
+			return fail(err, "Error building litmus clientset")
+		}
+	}
+
+	validator, err := webhook.NewManifestValidator(parameters, kubeClient, litmusClient)
+	if err != nil {
+		return fail(err, "Failed to create validators")
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	if err := validator.Start(stopCh); err != nil {
+		return fail(err, "Failed to start informers")
+	}
+
+	code := validateAllowed
+	verdicts := make([]webhook.Verdict, 0, len(manifests))
+	for _, manifest := range manifests {
+		verdict := validator.Validate(context.Background(), manifest)
+		if !verdict.Allowed() && !verdict.Skipped() {
+			code = validateDenied
+		}
+		verdicts = append(verdicts, verdict)
+	}
+	if err := webhook.WriteVerdicts(os.Stdout, format, verdicts); err != nil {
+		return fail(err, "Failed to write verdicts")
+	}
+	return code
+}
@@ -17,7 +17,6 @@ limitations under the License.
 package version
 
 import (
-	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -113,14 +112,11 @@ func GetVersion() string {
 		return Version
 	}
 	path := filepath.Join(os.Getenv("GOPATH") + versionFile)
-	fmt.Printf("Path: %v\n", path)
 	vBytes, err := ioutil.ReadFile(path)
 	if err != nil {
-		fmt.Printf("Error while reading: %v\n", err)
 		// ignore error
 		return ""
 	}
-	fmt.Printf("vBytes: %v\n", vBytes)
 	return strings.TrimSpace(string(vBytes))
 }
 
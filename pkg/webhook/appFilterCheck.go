@@ -21,59 +21,66 @@ import (
 	"strings"
 
 	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	appslisters "k8s.io/client-go/listers/apps/v1"
 
 	"github.com/litmuschaos/chaos-operator/pkg/apis/litmuschaos/v1alpha1"
 )
 
 func (wh *webhook) ValidateChaosExperimentInApplicationNamespaces(chaosEngine *v1alpha1.ChaosEngine) error {
-	for _, experiment := range chaosEngine.Spec.Experiments {
+	experimentErrors := FieldErrors{}
+	for i, experiment := range chaosEngine.Spec.Experiments {
 		if err := wh.checkExperimentInNamespace(experiment.Name, chaosEngine.Spec.Appinfo.Appns); err != nil {
-			return err
+			experimentErrors = append(experimentErrors, NewFieldError(experimentsPath.Index(i).Child("name"), CodeChaosExperimentNotFound,
+				"Unable to find ChaosExperiment %s in the application namespace %s, please check the following error: %v", experiment.Name, chaosEngine.Spec.Appinfo.Appns, err))
 		}
 	}
-	return nil
+	if len(experimentErrors) == 0 {
+		return nil
+	}
+	return experimentErrors
 }
 
 func (wh *webhook) ValidateChaosExperimentsConfigMaps(chaosEngine *v1alpha1.ChaosEngine) error {
-	configMapErrors := make([]string, 0)
-	for _, experiment := range chaosEngine.Spec.Experiments {
-		for _, expectedConfigMap := range experiment.Spec.Components.ConfigMaps {
-			_, err := wh.kubeClient.CoreV1().ConfigMaps(chaosEngine.Spec.Appinfo.Appns).Get(expectedConfigMap.Name, metav1.GetOptions{})
+	configMapErrors := FieldErrors{}
+	for i, experiment := range chaosEngine.Spec.Experiments {
+		for j, expectedConfigMap := range experiment.Spec.Components.ConfigMaps {
+			_, err := wh.cache.configMaps.ConfigMaps(chaosEngine.Spec.Appinfo.Appns).Get(expectedConfigMap.Name)
 			if err != nil {
-				configMapErrors = append(configMapErrors,
-					fmt.Sprintf("Unable to find ConfigMap %s needed for ChaosExperiment %s, please check the following error: %v", expectedConfigMap.Name, experiment.Name, err))
+				configMapErrors = append(configMapErrors, NewFieldError(experimentConfigMapsPath(i).Index(j).Child("name"), CodeConfigMapNotFound,
+					"Unable to find ConfigMap %s needed for ChaosExperiment %s, please check the following error: %v", expectedConfigMap.Name, experiment.Name, err))
 			}
 		}
 	}
 	if len(configMapErrors) == 0 {
 		return nil
 	}
-	return fmt.Errorf(strings.Join(configMapErrors, "\n"))
+	return configMapErrors
 }
 
 func (wh *webhook) ValidateChaosExperimentsSecrets(chaosEngine *v1alpha1.ChaosEngine) error {
-	secretsErrors := make([]string, 0)
-	for _, experiment := range chaosEngine.Spec.Experiments {
-		for _, expectedSecret := range experiment.Spec.Components.Secrets {
-			_, err := wh.kubeClient.CoreV1().Secrets(chaosEngine.Spec.Appinfo.Appns).Get(expectedSecret.Name, metav1.GetOptions{})
+	secretsErrors := FieldErrors{}
+	for i, experiment := range chaosEngine.Spec.Experiments {
+		for j, expectedSecret := range experiment.Spec.Components.Secrets {
+			_, err := wh.cache.secrets.Secrets(chaosEngine.Spec.Appinfo.Appns).Get(expectedSecret.Name)
 			if err != nil {
-				secretsErrors = append(secretsErrors,
-					fmt.Sprintf("Unable to find Secret %s needed for ChaosExperiment %s, please check the following error: %v", expectedSecret.Name, experiment.Name, err))
+				secretsErrors = append(secretsErrors, NewFieldError(experimentSecretsPath(i).Index(j).Child("name"), CodeSecretNotFound,
+					"Unable to find Secret %s needed for ChaosExperiment %s, please check the following error: %v", expectedSecret.Name, experiment.Name, err))
 			}
 		}
 	}
 	if len(secretsErrors) == 0 {
 		return nil
 	}
-	return fmt.Errorf(strings.Join(secretsErrors, "\n"))
+	return secretsErrors
 }
 
 func (wh *webhook) ValidateApplicationNamespace(chaosEngine *v1alpha1.ChaosEngine) error {
-	_, err := wh.kubeClient.CoreV1().Namespaces().Get(chaosEngine.Spec.Appinfo.Appns, metav1.GetOptions{})
+	_, err := wh.cache.namespaces.Get(chaosEngine.Spec.Appinfo.Appns)
 	if err != nil {
-		return fmt.Errorf("Unable to find the application namespace %s as specfied in the AppInfo, please check the following error %v", chaosEngine.Spec.Appinfo.Appns, err)
+		return NewFieldError(appnsPath, CodeNamespaceNotFound,
+			"Unable to find the application namespace %s as specfied in the AppInfo, please check the following error %v", chaosEngine.Spec.Appinfo.Appns, err)
 	}
 	return nil
 }
@@ -81,30 +88,32 @@ func (wh *webhook) ValidateApplicationNamespace(chaosEngine *v1alpha1.ChaosEngin
 func (wh *webhook) ValidateChaosTarget(chaosEngine *v1alpha1.ChaosEngine) error {
 	switch resourceType := strings.ToLower(chaosEngine.Spec.Appinfo.AppKind); resourceType {
 	case "deployment", "deployments":
-		return validateDeployment(chaosEngine.Spec.Appinfo, wh.kubeClient)
+		return validateDeployment(chaosEngine.Spec.Appinfo, wh.cache.deployments)
 	case "statefulset", "statefulsets":
-		return validateStatefulSet(chaosEngine.Spec.Appinfo, wh.kubeClient)
+		return validateStatefulSet(chaosEngine.Spec.Appinfo, wh.cache.statefulSets)
 	case "daemonset", "daemonsets":
-		return validateDaemonSet(chaosEngine.Spec.Appinfo, wh.kubeClient)
+		return validateDaemonSet(chaosEngine.Spec.Appinfo, wh.cache.daemonSets)
 	default:
-		return fmt.Errorf("Unable to validate resourceType: %v, unsupported resource", resourceType)
+		return NewFieldError(appkindPath, CodeUnsupportedAppKind, "Unable to validate resourceType: %v, unsupported resource", resourceType)
 	}
 }
 
-func validateDeployment(appInfo v1alpha1.ApplicationParams, kubeClient kubernetes.Interface) error {
-	deployments, err := kubeClient.AppsV1().Deployments(appInfo.Appns).List(metav1.ListOptions{
-		LabelSelector: appInfo.Applabel,
-	})
+func validateDeployment(appInfo v1alpha1.ApplicationParams, lister appslisters.DeploymentLister) error {
+	selector, err := labels.Parse(appInfo.Applabel)
+	if err != nil {
+		return NewFieldError(applabelPath, CodeInvalidAppLabel, "unable to parse applabel %q, please check the following error: %v", appInfo.Applabel, err)
+	}
+	deployments, err := lister.Deployments(appInfo.Appns).List(selector)
 	if err != nil {
 		return fmt.Errorf("unable to list deployments with matching labels, please check the following error: %v", err)
 	}
-	if len(deployments.Items) == 0 {
-		return fmt.Errorf("unable to find deployment specified in ChaosEngine")
+	if len(deployments) == 0 {
+		return NewFieldError(applabelPath, CodeApplicationNotFound, "unable to find deployment specified in ChaosEngine")
 	}
 
-	for _, deployment := range deployments.Items {
+	for _, deployment := range deployments {
 		if err := validatePodTemplateSpec(appInfo, deployment.Spec.Template); err != nil {
-			return fmt.Errorf("unable to find labels in pod template of deployment provided")
+			return NewFieldError(applabelPath, CodeAppLabelNotInPodTemplate, "unable to find labels in pod template of deployment provided")
 		}
 	}
 
@@ -112,40 +121,44 @@ func validateDeployment(appInfo v1alpha1.ApplicationParams, kubeClient kubernete
 
 }
 
-func validateStatefulSet(appInfo v1alpha1.ApplicationParams, kubeClient kubernetes.Interface) error {
-	statefulsets, err := kubeClient.AppsV1().StatefulSets(appInfo.Appns).List(metav1.ListOptions{
-		LabelSelector: appInfo.Applabel,
-	})
+func validateStatefulSet(appInfo v1alpha1.ApplicationParams, lister appslisters.StatefulSetLister) error {
+	selector, err := labels.Parse(appInfo.Applabel)
+	if err != nil {
+		return NewFieldError(applabelPath, CodeInvalidAppLabel, "unable to parse applabel %q, please check the following error: %v", appInfo.Applabel, err)
+	}
+	statefulsets, err := lister.StatefulSets(appInfo.Appns).List(selector)
 	if err != nil {
 		return fmt.Errorf("unable to list statefulsets with matching labels, please check the following error: %v", err)
 	}
-	if len(statefulsets.Items) == 0 {
-		return fmt.Errorf("unable to find statefulset specified in ChaosEngine")
+	if len(statefulsets) == 0 {
+		return NewFieldError(applabelPath, CodeApplicationNotFound, "unable to find statefulset specified in ChaosEngine")
 	}
 
-	for _, statefulset := range statefulsets.Items {
+	for _, statefulset := range statefulsets {
 		if err := validatePodTemplateSpec(appInfo, statefulset.Spec.Template); err != nil {
-			return fmt.Errorf("unable to find labels in pod template of statefulset provided")
+			return NewFieldError(applabelPath, CodeAppLabelNotInPodTemplate, "unable to find labels in pod template of statefulset provided")
 		}
 	}
 	return nil
 
 }
 
-func validateDaemonSet(appInfo v1alpha1.ApplicationParams, kubeClient kubernetes.Interface) error {
-	daemonsets, err := kubeClient.AppsV1().DaemonSets(appInfo.Appns).List(metav1.ListOptions{
-		LabelSelector: appInfo.Applabel,
-	})
+func validateDaemonSet(appInfo v1alpha1.ApplicationParams, lister appslisters.DaemonSetLister) error {
+	selector, err := labels.Parse(appInfo.Applabel)
+	if err != nil {
+		return NewFieldError(applabelPath, CodeInvalidAppLabel, "unable to parse applabel %q, please check the following error: %v", appInfo.Applabel, err)
+	}
+	daemonsets, err := lister.DaemonSets(appInfo.Appns).List(selector)
 	if err != nil {
 		return fmt.Errorf("unable to list daemonsets with matching labels, please check the following error: %v", err)
 	}
-	if len(daemonsets.Items) == 0 {
-		return fmt.Errorf("unable to find daemonset specified in ChaosEngine")
+	if len(daemonsets) == 0 {
+		return NewFieldError(applabelPath, CodeApplicationNotFound, "unable to find daemonset specified in ChaosEngine")
 	}
 
-	for _, daemonset := range daemonsets.Items {
+	for _, daemonset := range daemonsets {
 		if err := validatePodTemplateSpec(appInfo, daemonset.Spec.Template); err != nil {
-			return fmt.Errorf("unable to find labels in pod template of daemonset provided")
+			return NewFieldError(applabelPath, CodeAppLabelNotInPodTemplate, "unable to find labels in pod template of daemonset provided")
 		}
 	}
 
@@ -171,7 +184,19 @@ func checkLabelInMap(toCheck []string, labels map[string]string) bool {
 	return false
 }
 
+// experimentConfigMapsPath returns the path of the ConfigMaps of the given
+// experiment of a ChaosEngine
+func experimentConfigMapsPath(experiment int) *field.Path {
+	return experimentsPath.Index(experiment).Child("spec", "components", "configMaps")
+}
+
+// experimentSecretsPath returns the path of the Secrets of the given
+// experiment of a ChaosEngine
+func experimentSecretsPath(experiment int) *field.Path {
+	return experimentsPath.Index(experiment).Child("spec", "components", "secrets")
+}
+
 func (wh *webhook) checkExperimentInNamespace(experimentName, namespace string) error {
-	_, err := wh.litmusClient.LitmuschaosV1alpha1().ChaosExperiments(namespace).Get(experimentName, metav1.GetOptions{})
+	_, err := wh.cache.chaosExperiments.ChaosExperiments(namespace).Get(experimentName)
 	return err
 }
@@ -21,11 +21,9 @@ import (
 	"testing"
 
 	"github.com/litmuschaos/chaos-operator/pkg/apis/litmuschaos/v1alpha1"
-	fakelitmus "github.com/litmuschaos/chaos-operator/pkg/client/clientset/versioned/fake"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/client-go/kubernetes/fake"
 )
 
 var testNamespace = "test-ns"
@@ -174,9 +172,9 @@ func TestValidateChaosExperimentsConfigMaps(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.description, func(t *testing.T) {
-			webhook := webhook{
-				kubeClient: fake.NewSimpleClientset(test.k8sObjects...),
-			}
+			stopCh := make(chan struct{})
+			defer close(stopCh)
+			webhook := newTestWebhook(t, stopCh, test.k8sObjects, nil)
 			err := webhook.ValidateChaosExperimentsConfigMaps(&test.chaosEngine)
 			if test.isErrExpected && err == nil {
 				t.Fatalf("Test %q failed: expected error not to be nil.", test.description)
@@ -277,10 +275,9 @@ func TestValidateChaosExperimentInApplicationNamespaces(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.description, func(t *testing.T) {
-			webhook := webhook{
-				kubeClient:   fake.NewSimpleClientset(test.k8sObjects...),
-				litmusClient: fakelitmus.NewSimpleClientset(test.litmusObjects...),
-			}
+			stopCh := make(chan struct{})
+			defer close(stopCh)
+			webhook := newTestWebhook(t, stopCh, test.k8sObjects, test.litmusObjects)
 			err := webhook.ValidateChaosExperimentInApplicationNamespaces(&test.chaosEngine)
 			if test.isErrExpected && err == nil {
 				t.Fatalf("Test %q failed: expected error not to be nil.", test.description)
@@ -439,9 +436,9 @@ func TestValidateChaosExperimentsSecrets(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.description, func(t *testing.T) {
-			webhook := webhook{
-				kubeClient: fake.NewSimpleClientset(test.k8sObjects...),
-			}
+			stopCh := make(chan struct{})
+			defer close(stopCh)
+			webhook := newTestWebhook(t, stopCh, test.k8sObjects, nil)
 			err := webhook.ValidateChaosExperimentsSecrets(&test.chaosEngine)
 			if test.isErrExpected && err == nil {
 				t.Fatalf("Test %q failed: expected error not to be nil.", test.description)
@@ -494,9 +491,9 @@ func TestValidateApplicationNamespace(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.description, func(t *testing.T) {
-			webhook := webhook{
-				kubeClient: fake.NewSimpleClientset(test.k8sObjects...),
-			}
+			stopCh := make(chan struct{})
+			defer close(stopCh)
+			webhook := newTestWebhook(t, stopCh, test.k8sObjects, nil)
 			err := webhook.ValidateApplicationNamespace(&test.chaosEngine)
 			if test.isErrExpected && err == nil {
 				t.Fatalf("Test %q failed: expected error not to be nil.", test.description)
@@ -0,0 +1,505 @@
+/*
+Copyright 2019 The LitmusChaos Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DecisionRecord is the audit record of an admission decision
+type DecisionRecord struct {
+	Timestamp time.Time                 `json:"timestamp"`
+	UID       string                    `json:"uid"`
+	Kind      metav1.GroupVersionKind   `json:"kind"`
+	Namespace string                    `json:"namespace,omitempty"`
+	Name      string                    `json:"name,omitempty"`
+	Operation string                    `json:"operation"`
+	User      authenticationv1.UserInfo `json:"user"`
+	// ObjectDigest is the sha256 digest of the object of the request, or of
+	// the old object on deletion
+	ObjectDigest string `json:"objectDigest,omitempty"`
+	// Validators are the results of the validators run on the request
+	Validators []ValidatorRecord `json:"validators"`
+	// Decision is allowed, denied or error
+	Decision string   `json:"decision"`
+	Code     int32    `json:"code,omitempty"`
+	Message  string   `json:"message,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+	TraceID  string   `json:"traceID,omitempty"`
+}
+
+// ValidatorRecord is the result of a validator in a DecisionRecord
+type ValidatorRecord struct {
+	Name string `json:"name"`
+	Mode Mode   `json:"mode,omitempty"`
+	// Result is passed, failed or inconclusive
+	Result   string   `json:"result"`
+	Codes    []string `json:"codes,omitempty"`
+	Message  string   `json:"message,omitempty"`
+	Duration string   `json:"duration"`
+}
+
+// newDecisionRecord returns the audit record of the given request answered
+// with the given response
+func newDecisionRecord(req *v1beta1.AdmissionRequest, response *admissionResponse, traceID string) DecisionRecord {
+	record := DecisionRecord{
+		Timestamp:  time.Now().UTC(),
+		UID:        string(req.UID),
+		Kind:       req.Kind,
+		Namespace:  req.Namespace,
+		Name:       req.Name,
+		Operation:  string(req.Operation),
+		User:       req.UserInfo,
+		Validators: []ValidatorRecord{},
+		Decision:   responseResult(response),
+		TraceID:    traceID,
+	}
+	raw := req.Object.Raw
+	if len(raw) == 0 {
+		raw = req.OldObject.Raw
+	}
+	if len(raw) != 0 {
+		record.ObjectDigest = fmt.Sprintf("sha256:%x", sha256.Sum256(raw))
+	}
+	if response == nil {
+		return record
+	}
+	record.Warnings = response.Warnings
+	if response.Result != nil {
+		record.Code = response.Result.Code
+		record.Message = response.Result.Message
+	}
+	for _, result := range response.results {
+		validator := ValidatorRecord{
+			Name:     result.Validator.Name(),
+			Mode:     result.Mode,
+			Result:   resultPassed,
+			Duration: result.Duration.String(),
+		}
+		if result.Err != nil {
+			validator.Result = resultFailed
+			if result.Inconclusive {
+				validator.Result = resultInconclusive
+			}
+			validator.Codes = resultCodes([]Result{result})
+			validator.Message = result.Err.Error()
+		}
+		record.Validators = append(record.Validators, validator)
+	}
+	return record
+}
+
+// AuditSink receives batches of decision records
+type AuditSink interface {
+	// Write delivers the records, it is retried on error
+	Write(ctx context.Context, records []DecisionRecord) error
+	// Close releases the resources of the sink
+	Close() error
+}
+
+// writerSink writes the records as JSON lines, i.e. to stdout
+type writerSink struct {
+	w io.Writer
+}
+
+// NewWriterSink returns a sink writing the records to w, one JSON object per
+// line
+func NewWriterSink(w io.Writer) AuditSink {
+	return &writerSink{w: w}
+}
+
+func (s *writerSink) Write(ctx context.Context, records []DecisionRecord) error {
+	lines, err := encodeRecords(records)
+	if err != nil {
+		return err
+	}
+	_, err = s.w.Write(lines)
+	return err
+}
+
+func (s *writerSink) Close() error {
+	return nil
+}
+
+// encodeRecords returns the records as JSON lines
+func encodeRecords(records []DecisionRecord) ([]byte, error) {
+	var lines bytes.Buffer
+	encoder := json.NewEncoder(&lines)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return nil, fmt.Errorf("failed to encode decision record: %v", err)
+		}
+	}
+	return lines.Bytes(), nil
+}
+
+// fileSink writes the records as JSON lines to a file, rotated once it
+// reaches its maximum size
+type fileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	file *os.File
+	size int64
+}
+
+// NewFileSink returns a sink appending the records to the file at path. The
+// file is renamed to path.1 once it reaches maxSize bytes, up to maxBackups
+// rotated files are kept.
+func NewFileSink(path string, maxSize int64, maxBackups int) (AuditSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %v", err)
+	}
+	s := &fileSink{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat audit log: %v", err)
+	}
+	s.file, s.size = file, info.Size()
+	return nil
+}
+
+// rotate renames the file to path.1, shifting the older backups, and opens a
+// new file
+func (s *fileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("failed to close audit log: %v", err)
+	}
+	os.Remove(fmt.Sprintf("%s.%d", s.path, s.maxBackups))
+	for i := s.maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+	}
+	if s.maxBackups > 0 {
+		if err := os.Rename(s.path, s.path+".1"); err != nil {
+			return fmt.Errorf("failed to rotate audit log: %v", err)
+		}
+	} else if err := os.Remove(s.path); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %v", err)
+	}
+	return s.open()
+}
+
+func (s *fileSink) Write(ctx context.Context, records []DecisionRecord) error {
+	lines, err := encodeRecords(records)
+	if err != nil {
+		return err
+	}
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(lines)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(lines)
+	s.size += int64(n)
+	return err
+}
+
+func (s *fileSink) Close() error {
+	return s.file.Close()
+}
+
+// httpSink posts the records as a JSON array to an HTTP endpoint
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPSink returns a sink posting every batch of records as a JSON array
+// to the given URL
+func NewHTTPSink(url string, timeout time.Duration) AuditSink {
+	return &httpSink{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (s *httpSink) Write(ctx context.Context, records []DecisionRecord) error {
+	body, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("failed to encode decision records: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("audit endpoint %s answered %s", s.url, resp.Status)
+	}
+	return nil
+}
+
+func (s *httpSink) Close() error {
+	return nil
+}
+
+// AuditOptions configure the delivery of the decision records
+type AuditOptions struct {
+	// Sinks are stdout, file:<path> or http(s)://<url>, auditing is disabled
+	// if empty
+	Sinks []string
+	// QueueSize bounds the records waiting for delivery, further records are
+	// dropped
+	QueueSize int
+	// BatchSize is the maximum number of records delivered at once
+	BatchSize int
+	// FlushInterval is the time after which a partial batch is delivered
+	FlushInterval time.Duration
+	// MaxRetries is the number of times a failed delivery is retried
+	MaxRetries int
+	// FileMaxSize is the size in bytes at which the audit file is rotated
+	FileMaxSize int64
+	// FileMaxBackups is the number of rotated audit files kept
+	FileMaxBackups int
+}
+
+// newAuditSink returns the sink of the given specification
+func newAuditSink(spec string, opts AuditOptions) (string, AuditSink, error) {
+	switch {
+	case spec == "stdout":
+		return spec, NewWriterSink(os.Stdout), nil
+	case strings.HasPrefix(spec, "file:"):
+		sink, err := NewFileSink(strings.TrimPrefix(spec, "file:"), opts.FileMaxSize, opts.FileMaxBackups)
+		return "file", sink, err
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		return "http", NewHTTPSink(spec, 10*time.Second), nil
+	}
+	return "", nil, fmt.Errorf("unknown audit sink %s, expected stdout, file:<path> or http(s)://<url>", spec)
+}
+
+// auditRetryBackoff is the wait before the first retry of a delivery, doubled
+// on every retry
+var auditRetryBackoff = 500 * time.Millisecond
+
+var (
+	auditRecordsDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "audit_records_dropped_total",
+		Help:      "Number of decision records dropped because the audit queue was full.",
+	})
+	auditDeliveryFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "audit_delivery_failures_total",
+		Help:      "Number of batches of decision records which could not be delivered to a sink, after the retries.",
+	}, []string{"sink"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(auditRecordsDropped, auditDeliveryFailures)
+}
+
+// namedSink is a sink along with the name used in logs and metrics
+type namedSink struct {
+	name string
+	AuditSink
+}
+
+// Auditor delivers the decision records to the sinks in the background. It
+// never blocks the admission requests, records are dropped once its queue is
+// full.
+type Auditor struct {
+	queue         chan DecisionRecord
+	sinks         []namedSink
+	batchSize     int
+	flushInterval time.Duration
+	maxRetries    int
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// NewAuditor returns an Auditor delivering to the configured sinks, or nil if
+// there are none. It runs until Close is called.
+func NewAuditor(opts AuditOptions) (*Auditor, error) {
+	if len(opts.Sinks) == 0 {
+		return nil, nil
+	}
+	var sinks []namedSink
+	for _, spec := range opts.Sinks {
+		name, sink, err := newAuditSink(spec, opts)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, namedSink{name: name, AuditSink: sink})
+	}
+	return newAuditor(sinks, opts), nil
+}
+
+func newAuditor(sinks []namedSink, opts AuditOptions) *Auditor {
+	if opts.QueueSize < 1 {
+		opts.QueueSize = 1
+	}
+	if opts.BatchSize < 1 {
+		opts.BatchSize = 1
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	a := &Auditor{
+		queue:         make(chan DecisionRecord, opts.QueueSize),
+		sinks:         sinks,
+		batchSize:     opts.BatchSize,
+		flushInterval: opts.FlushInterval,
+		maxRetries:    opts.MaxRetries,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// Record queues a record for delivery, it drops the record if the queue is
+// full or the Auditor is closed
+func (a *Auditor) Record(record DecisionRecord) {
+	if a == nil {
+		return
+	}
+	select {
+	case <-a.stop:
+		auditRecordsDropped.Inc()
+		return
+	default:
+	}
+	select {
+	case a.queue <- record:
+	default:
+		auditRecordsDropped.Inc()
+		Logger(SubsystemHTTP).V(2).Info("Audit queue is full, dropping decision record", "uid", record.UID)
+	}
+}
+
+// Close delivers the queued records and closes the sinks, or gives up on the
+// records once ctx is done
+func (a *Auditor) Close(ctx context.Context) error {
+	if a == nil {
+		return nil
+	}
+	a.once.Do(func() { close(a.stop) })
+	select {
+	case <-a.done:
+	case <-ctx.Done():
+		return fmt.Errorf("failed to deliver pending decision records: %v", ctx.Err())
+	}
+	var errs []string
+	for _, sink := range a.sinks {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", sink.name, err))
+		}
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf("failed to close audit sinks: %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// run batches the queued records until the Auditor is closed, then delivers
+// the remaining ones
+func (a *Auditor) run() {
+	defer close(a.done)
+	ticker := time.NewTicker(a.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]DecisionRecord, 0, a.batchSize)
+	flush := func() {
+		if len(batch) != 0 {
+			a.deliver(batch)
+			batch = make([]DecisionRecord, 0, a.batchSize)
+		}
+	}
+	for {
+		select {
+		case record := <-a.queue:
+			batch = append(batch, record)
+			if len(batch) >= a.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-a.stop:
+			for {
+				select {
+				case record := <-a.queue:
+					batch = append(batch, record)
+					if len(batch) >= a.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver writes the batch to every sink, retrying with an exponential
+// backoff
+func (a *Auditor) deliver(batch []DecisionRecord) {
+	for _, sink := range a.sinks {
+		backoff := auditRetryBackoff
+		var err error
+		for attempt := 0; attempt <= a.maxRetries; attempt++ {
+			if attempt > 0 {
+				time.Sleep(backoff)
+				backoff *= 2
+			}
+			if err = sink.Write(context.Background(), batch); err == nil {
+				break
+			}
+			Logger(SubsystemHTTP).V(2).Info("Failed to deliver decision records", "sink", sink.name, "attempt", attempt+1, "error", err.Error())
+		}
+		if err != nil {
+			auditDeliveryFailures.WithLabelValues(sink.name).Inc()
+			Logger(SubsystemHTTP).Error(err, "Dropping decision records which could not be delivered", "sink", sink.name, "records", len(batch))
+		}
+	}
+}
@@ -0,0 +1,314 @@
+/*
+Copyright 2019 LitmusChaos Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/litmuschaos/chaos-operator/pkg/apis/litmuschaos/v1alpha1"
+	"k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// fakeAuditSink records the batches written to it, failing the given number
+// of writes first
+type fakeAuditSink struct {
+	mu       sync.Mutex
+	failures int
+	writes   int
+	batches  [][]DecisionRecord
+	block    chan struct{}
+}
+
+func (s *fakeAuditSink) Write(ctx context.Context, records []DecisionRecord) error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writes++
+	if s.writes <= s.failures {
+		return fmt.Errorf("sink unavailable")
+	}
+	s.batches = append(s.batches, records)
+	return nil
+}
+
+func (s *fakeAuditSink) Close() error {
+	return nil
+}
+
+func (s *fakeAuditSink) records() []DecisionRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var records []DecisionRecord
+	for _, batch := range s.batches {
+		records = append(records, batch...)
+	}
+	return records
+}
+
+func TestAuditRecord(t *testing.T) {
+	os.Setenv("LITMUS_NAMESPACE", litmusNamespace)
+	defer os.Unsetenv("LITMUS_NAMESPACE")
+
+	raw, err := json.Marshal(&v1alpha1.ChaosEngine{
+		ObjectMeta: metav1.ObjectMeta{Name: "engine", Namespace: testNamespace},
+		Spec: v1alpha1.ChaosEngineSpec{
+			Appinfo: v1alpha1.ApplicationParams{Appns: testNamespace, Applabel: "app=nginx", AppKind: "deployment"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal ChaosEngine: %v", err)
+	}
+	body, err := json.Marshal(&v1beta1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1beta1", Kind: "AdmissionReview"},
+		Request: &v1beta1.AdmissionRequest{
+			UID:       "request-uid",
+			Kind:      metav1.GroupVersionKind{Group: "litmuschaos.io", Version: "v1alpha1", Kind: "ChaosEngine"},
+			Name:      "engine",
+			Namespace: testNamespace,
+			Operation: v1beta1.Create,
+			UserInfo:  authenticationv1.UserInfo{Username: "jane"},
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal AdmissionReview: %v", err)
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	webhook := newTestWebhook(t, stopCh,
+		[]runtime.Object{&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespace}}}, nil)
+	sink := &fakeAuditSink{}
+	webhook.auditor = newAuditor([]namedSink{{name: "fake", AuditSink: sink}}, AuditOptions{QueueSize: 10, BatchSize: 10})
+
+	request := httptest.NewRequest("POST", "/validate", bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	webhook.Serve(httptest.NewRecorder(), request)
+	if err := webhook.auditor.Close(context.Background()); err != nil {
+		t.Fatalf("failed to close auditor: %v", err)
+	}
+
+	records := sink.records()
+	if len(records) != 1 {
+		t.Fatalf("expected a decision record, got %v", records)
+	}
+	record := records[0]
+	if record.UID != "request-uid" || record.Name != "engine" || record.User.Username != "jane" {
+		t.Fatalf("expected the record to identify the request, got %+v", record)
+	}
+	if digest := fmt.Sprintf("sha256:%x", sha256.Sum256(raw)); record.ObjectDigest != digest {
+		t.Fatalf("expected object digest %s, got %s", digest, record.ObjectDigest)
+	}
+	if record.Decision != resultDenied || record.Code != http.StatusBadRequest {
+		t.Fatalf("expected the denial to be recorded, got %+v", record)
+	}
+	failed := false
+	for _, validator := range record.Validators {
+		if validator.Name == ChaosTargetValidator {
+			failed = validator.Result == resultFailed && len(validator.Codes) != 0
+		}
+	}
+	if !failed {
+		t.Fatalf("expected the failure of %s to be recorded, got %+v", ChaosTargetValidator, record.Validators)
+	}
+}
+
+func TestAuditorDelivery(t *testing.T) {
+	defer func(backoff time.Duration) { auditRetryBackoff = backoff }(auditRetryBackoff)
+	auditRetryBackoff = time.Millisecond
+
+	var tests = []struct {
+		description     string
+		failures        int
+		maxRetries      int
+		records         int
+		batchSize       int
+		expectedRecords int
+		expectedBatches int
+	}{
+		{
+			description:     "Records are delivered in batches.",
+			records:         5,
+			batchSize:       2,
+			expectedRecords: 5,
+			expectedBatches: 3,
+		},
+		{
+			description:     "Failed deliveries are retried.",
+			failures:        2,
+			maxRetries:      2,
+			records:         1,
+			batchSize:       1,
+			expectedRecords: 1,
+			expectedBatches: 1,
+		},
+		{
+			description:     "Records are dropped once the retries are exhausted.",
+			failures:        2,
+			maxRetries:      1,
+			records:         1,
+			batchSize:       1,
+			expectedRecords: 0,
+			expectedBatches: 0,
+		},
+	}
+	for _, test := range tests {
+		sink := &fakeAuditSink{failures: test.failures}
+		auditor := newAuditor([]namedSink{{name: "fake", AuditSink: sink}},
+			AuditOptions{QueueSize: 10, BatchSize: test.batchSize, FlushInterval: time.Hour, MaxRetries: test.maxRetries})
+		for i := 0; i < test.records; i++ {
+			auditor.Record(DecisionRecord{UID: fmt.Sprint(i)})
+		}
+		if err := auditor.Close(context.Background()); err != nil {
+			t.Fatalf("Test %q failed: %v", test.description, err)
+		}
+		if records := sink.records(); len(records) != test.expectedRecords {
+			t.Fatalf("Test %q failed: expected %d records, got %v", test.description, test.expectedRecords, records)
+		}
+		if len(sink.batches) != test.expectedBatches {
+			t.Fatalf("Test %q failed: expected %d batches, got %d", test.description, test.expectedBatches, len(sink.batches))
+		}
+	}
+}
+
+func TestAuditorQueueFull(t *testing.T) {
+	sink := &fakeAuditSink{block: make(chan struct{})}
+	auditor := newAuditor([]namedSink{{name: "fake", AuditSink: sink}}, AuditOptions{QueueSize: 1, BatchSize: 1})
+	dropped := metricValue(t, "litmuschaos_admission_controller_audit_records_dropped_total", nil)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// the first record blocks the sink, the second fills the queue
+		for i := 0; i < 5; i++ {
+			auditor.Record(DecisionRecord{UID: fmt.Sprint(i)})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected recording to never block on a full queue")
+	}
+	close(sink.block)
+	if err := auditor.Close(context.Background()); err != nil {
+		t.Fatalf("failed to close auditor: %v", err)
+	}
+	if delivered := len(sink.records()); delivered == 5 || delivered == 0 {
+		t.Fatalf("expected part of the records to be dropped, got %d delivered", delivered)
+	}
+	if metricValue(t, "litmuschaos_admission_controller_audit_records_dropped_total", nil) == dropped {
+		t.Fatalf("expected the dropped records to be counted")
+	}
+}
+
+func TestAuditSinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		mu       sync.Mutex
+		received []DecisionRecord
+	)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var records []DecisionRecord
+		if err := json.NewDecoder(r.Body).Decode(&records); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		received = append(received, records...)
+	}))
+	defer endpoint.Close()
+
+	path := filepath.Join(dir, "audit.log")
+	fileSink, err := NewFileSink(path, 200, 2)
+	if err != nil {
+		t.Fatalf("failed to create file sink: %v", err)
+	}
+	var output bytes.Buffer
+	var tests = []struct {
+		description string
+		sink        AuditSink
+		delivered   func() int
+	}{
+		{
+			description: "The writer sink writes JSON lines.",
+			sink:        NewWriterSink(&output),
+			delivered:   func() int { return bytes.Count(output.Bytes(), []byte("\n")) },
+		},
+		{
+			description: "The HTTP sink posts JSON arrays.",
+			sink:        NewHTTPSink(endpoint.URL, time.Second),
+			delivered: func() int {
+				mu.Lock()
+				defer mu.Unlock()
+				return len(received)
+			},
+		},
+		{
+			description: "The file sink keeps the rotated files.",
+			sink:        fileSink,
+			delivered: func() int {
+				lines := 0
+				for _, name := range []string{path, path + ".1", path + ".2"} {
+					data, err := ioutil.ReadFile(name)
+					if err != nil {
+						return 0
+					}
+					lines += bytes.Count(data, []byte("\n"))
+				}
+				return lines
+			},
+		},
+	}
+	for _, test := range tests {
+		for i := 0; i < 3; i++ {
+			record := DecisionRecord{UID: fmt.Sprint(i), Decision: resultAllowed, Validators: []ValidatorRecord{}}
+			if err := test.sink.Write(context.Background(), []DecisionRecord{record}); err != nil {
+				t.Fatalf("Test %q failed: %v", test.description, err)
+			}
+		}
+		if err := test.sink.Close(); err != nil {
+			t.Fatalf("Test %q failed: %v", test.description, err)
+		}
+		if delivered := test.delivered(); delivered != 3 {
+			t.Fatalf("Test %q failed: expected 3 records, got %d", test.description, delivered)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2019 The LitmusChaos Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/litmuschaos/chaos-operator/pkg/apis/litmuschaos/v1alpha1"
+	litmuschaosv1alpha1 "github.com/litmuschaos/chaos-operator/pkg/client/clientset/versioned"
+	litmusinformers "github.com/litmuschaos/chaos-operator/pkg/client/informers/externalversions"
+	litmuslisters "github.com/litmuschaos/chaos-operator/pkg/client/listers/litmuschaos/v1alpha1"
+)
+
+const (
+	// referencesIndex indexes the active ChaosEngines by the keys of the
+	// resources they use, see engineReferences
+	referencesIndex = "references"
+	// appNamespaceIndex indexes the ChaosEngines by their application namespace
+	appNamespaceIndex = "appns"
+)
+
+// clusterCache holds the shared informers the validations read from, instead
+// of calling the API server on every admission request.
+type clusterCache struct {
+	kubeFactory   informers.SharedInformerFactory
+	litmusFactory litmusinformers.SharedInformerFactory
+
+	namespaces       corelisters.NamespaceLister
+	configMaps       corelisters.ConfigMapLister
+	secrets          corelisters.SecretLister
+	services         corelisters.ServiceLister
+	deployments      appslisters.DeploymentLister
+	statefulSets     appslisters.StatefulSetLister
+	daemonSets       appslisters.DaemonSetLister
+	chaosExperiments litmuslisters.ChaosExperimentLister
+	chaosEngines     litmuslisters.ChaosEngineLister
+
+	// chaosEngineInformer is indexed with referencesIndex and appNamespaceIndex
+	chaosEngineInformer cache.SharedIndexInformer
+	// secretInformer notifies the changes of the cert-manager issued Secret
+	secretInformer cache.SharedIndexInformer
+	// workloadInformers are the informers of the kinds a ChaosEngine targets
+	workloadInformers []cache.SharedIndexInformer
+
+	informersSynced []cache.InformerSynced
+	synced          int32
+}
+
+// newClusterCache registers the informers of all the resources read during
+// validation. The informers only run once Start is called.
+func newClusterCache(kubeClient kubernetes.Interface, litmusClient litmuschaosv1alpha1.Interface) (*clusterCache, error) {
+	kubeFactory := informers.NewSharedInformerFactory(kubeClient, 0)
+	litmusFactory := litmusinformers.NewSharedInformerFactory(litmusClient, 0)
+
+	namespaces := kubeFactory.Core().V1().Namespaces()
+	configMaps := kubeFactory.Core().V1().ConfigMaps()
+	secrets := kubeFactory.Core().V1().Secrets()
+	services := kubeFactory.Core().V1().Services()
+	deployments := kubeFactory.Apps().V1().Deployments()
+	statefulSets := kubeFactory.Apps().V1().StatefulSets()
+	daemonSets := kubeFactory.Apps().V1().DaemonSets()
+	chaosExperiments := litmusFactory.Litmuschaos().V1alpha1().ChaosExperiments()
+	chaosEngines := litmusFactory.Litmuschaos().V1alpha1().ChaosEngines()
+
+	c := &clusterCache{
+		kubeFactory:         kubeFactory,
+		litmusFactory:       litmusFactory,
+		namespaces:          namespaces.Lister(),
+		configMaps:          configMaps.Lister(),
+		secrets:             secrets.Lister(),
+		services:            services.Lister(),
+		deployments:         deployments.Lister(),
+		statefulSets:        statefulSets.Lister(),
+		daemonSets:          daemonSets.Lister(),
+		chaosExperiments:    chaosExperiments.Lister(),
+		chaosEngines:        chaosEngines.Lister(),
+		chaosEngineInformer: chaosEngines.Informer(),
+		secretInformer:      secrets.Informer(),
+		workloadInformers: []cache.SharedIndexInformer{
+			deployments.Informer(),
+			statefulSets.Informer(),
+			daemonSets.Informer(),
+		},
+	}
+
+	err := c.chaosEngineInformer.AddIndexers(cache.Indexers{
+		referencesIndex:   referencesIndexFunc,
+		appNamespaceIndex: appNamespaceIndexFunc,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to index chaosengines: %v", err)
+	}
+
+	c.informersSynced = []cache.InformerSynced{
+		namespaces.Informer().HasSynced,
+		configMaps.Informer().HasSynced,
+		secrets.Informer().HasSynced,
+		services.Informer().HasSynced,
+		deployments.Informer().HasSynced,
+		statefulSets.Informer().HasSynced,
+		daemonSets.Informer().HasSynced,
+		chaosExperiments.Informer().HasSynced,
+		chaosEngines.Informer().HasSynced,
+	}
+	return c, nil
+}
+
+// referencesIndexFunc indexes an active ChaosEngine by the resources it uses
+func referencesIndexFunc(obj interface{}) ([]string, error) {
+	chaosEngine, ok := obj.(*v1alpha1.ChaosEngine)
+	if !ok || !isEngineActive(chaosEngine) {
+		return []string{}, nil
+	}
+	return engineReferences(chaosEngine), nil
+}
+
+// appNamespaceIndexFunc indexes a ChaosEngine by its application namespace
+func appNamespaceIndexFunc(obj interface{}) ([]string, error) {
+	chaosEngine, ok := obj.(*v1alpha1.ChaosEngine)
+	if !ok {
+		return []string{}, nil
+	}
+	return []string{chaosEngine.Spec.Appinfo.Appns}, nil
+}
+
+// Start runs the informers and blocks until their caches are synced or the
+// stop channel is closed.
+func (c *clusterCache) Start(stopCh <-chan struct{}) error {
+	c.kubeFactory.Start(stopCh)
+	c.litmusFactory.Start(stopCh)
+
+	log := Logger(SubsystemBootstrap)
+	log.Info("Waiting for informer caches to sync")
+	if !cache.WaitForCacheSync(stopCh, c.informersSynced...) {
+		return fmt.Errorf("failed to wait for informer caches to sync")
+	}
+	atomic.StoreInt32(&c.synced, 1)
+	log.Info("Informer caches are synced")
+	return nil
+}
+
+// HasSynced returns true once all the informer caches are synced
+func (c *clusterCache) HasSynced() bool {
+	return atomic.LoadInt32(&c.synced) == 1
+}
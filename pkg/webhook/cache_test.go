@@ -0,0 +1,97 @@
+/*
+Copyright 2019 LitmusChaos Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"testing"
+
+	"github.com/litmuschaos/chaos-operator/pkg/apis/litmuschaos/v1alpha1"
+	fakelitmus "github.com/litmuschaos/chaos-operator/pkg/client/clientset/versioned/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newTestWebhook returns a webhook backed by fake clientsets holding the given
+// objects, its informer caches are synced once it is returned and run until
+// the stop channel is closed.
+func newTestWebhook(t *testing.T, stopCh <-chan struct{}, k8sObjects []runtime.Object, litmusObjects []runtime.Object) *webhook {
+	kubeClient := fake.NewSimpleClientset(k8sObjects...)
+	litmusClient := fakelitmus.NewSimpleClientset(litmusObjects...)
+	clusterCache, err := newClusterCache(kubeClient, litmusClient)
+	if err != nil {
+		t.Fatalf("failed to create cluster cache: %v", err)
+	}
+
+	if err := clusterCache.Start(stopCh); err != nil {
+		t.Fatalf("failed to start cluster cache: %v", err)
+	}
+	wh := &webhook{
+		kubeClient:    kubeClient,
+		litmusClient:  litmusClient,
+		cache:         clusterCache,
+		pipeline:      newPipeline(1, 0),
+		webhookConfig: validatorWebhook,
+	}
+	wh.registry, err = newValidatorRegistry(wh)
+	if err != nil {
+		t.Fatalf("failed to create validator registry: %v", err)
+	}
+	return wh
+}
+
+func TestReferencesIndex(t *testing.T) {
+	chaosEngine := &v1alpha1.ChaosEngine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "engine",
+			Namespace: litmusNamespace,
+		},
+		Spec: v1alpha1.ChaosEngineSpec{
+			Appinfo: v1alpha1.ApplicationParams{
+				Appns: testNamespace,
+			},
+			Experiments: []v1alpha1.ExperimentList{
+				{
+					Name: "pod-delete",
+					Spec: v1alpha1.ExperimentAttributes{
+						Components: v1alpha1.ExperimentComponents{
+							ConfigMaps: []v1alpha1.ConfigMap{{Name: "configmap-1"}},
+						},
+					},
+				},
+			},
+		},
+	}
+	stoppedEngine := chaosEngine.DeepCopy()
+	stoppedEngine.Name = "stopped-engine"
+	stoppedEngine.Spec.EngineState = v1alpha1.EngineStateStop
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	webhook := newTestWebhook(t, stopCh, nil, []runtime.Object{chaosEngine, stoppedEngine})
+	if !webhook.cache.HasSynced() {
+		t.Fatalf("expected the cache to be synced")
+	}
+
+	engines, err := webhook.referencingEngines(referenceKey("ConfigMap", testNamespace, "configmap-1"))
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %v", err)
+	}
+	if len(engines) != 1 || engines[0] != litmusNamespace+"/engine" {
+		t.Fatalf("expected only the active engine to be indexed, got %v", engines)
+	}
+}
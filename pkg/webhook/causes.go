@@ -0,0 +1,145 @@
+/*
+Copyright 2019 The LitmusChaos Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// Paths of the ChaosEngine fields checked by the validators
+var (
+	appinfoPath     = field.NewPath("spec", "appinfo")
+	appnsPath       = appinfoPath.Child("appns")
+	applabelPath    = appinfoPath.Child("applabel")
+	appkindPath     = appinfoPath.Child("appkind")
+	experimentsPath = field.NewPath("spec", "experiments")
+)
+
+// FieldError is a validation failure on a field of the object under
+// validation
+type FieldError struct {
+	// Field is the path of the field, i.e. spec.appinfo.applabel, empty if the
+	// failure is about the whole object
+	Field string
+	// Code identifies the failure in the error code catalog
+	Code Code
+	// Message describes the failure to the user
+	Message string
+}
+
+// NewFieldError returns a FieldError on the given field, which may be nil
+func NewFieldError(path *field.Path, code Code, format string, args ...interface{}) *FieldError {
+	fieldError := &FieldError{Code: code, Message: fmt.Sprintf(format, args...)}
+	if path != nil {
+		fieldError.Field = path.String()
+	}
+	return fieldError
+}
+
+// Error returns the message prefixed by the code and the field, as shown by
+// kubectl
+func (e *FieldError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("[%s] %s", e.Code, e.Message)
+	}
+	return fmt.Sprintf("[%s] %s: %s", e.Code, e.Field, e.Message)
+}
+
+// FieldErrors are the validation failures of a validator
+type FieldErrors []*FieldError
+
+// Error returns the messages of the failures, one per line
+func (e FieldErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, fieldError := range e {
+		messages = append(messages, fieldError.Error())
+	}
+	return strings.Join(messages, "\n")
+}
+
+// toFieldErrors returns the failures held by the given error. Errors of other
+// types are failures on the whole object with the given code.
+func toFieldErrors(err error, code Code) FieldErrors {
+	switch e := err.(type) {
+	case *FieldError:
+		return FieldErrors{e}
+	case FieldErrors:
+		return e
+	}
+	return FieldErrors{{Code: code, Message: err.Error()}}
+}
+
+// resultErrors returns the failures of a result
+func resultErrors(result Result) FieldErrors {
+	code := CodeValidationFailed
+	if result.Inconclusive {
+		code = CodeValidationInconclusive
+	}
+	return toFieldErrors(result.Err, code)
+}
+
+// resultCodes returns the sorted codes of the failures of the given results
+func resultCodes(results []Result) []string {
+	seen := map[Code]bool{}
+	codes := make([]string, 0)
+	for _, result := range results {
+		for _, fieldError := range resultErrors(result) {
+			if !seen[fieldError.Code] {
+				seen[fieldError.Code] = true
+				codes = append(codes, string(fieldError.Code))
+			}
+		}
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// statusCauses returns the causes of the failed results
+func statusCauses(results []Result) []metav1.StatusCause {
+	causes := make([]metav1.StatusCause, 0)
+	for _, result := range results {
+		for _, fieldError := range resultErrors(result) {
+			causes = append(causes, metav1.StatusCause{
+				Type:    metav1.CauseType(fieldError.Code),
+				Message: fieldError.Message,
+				Field:   fieldError.Field,
+			})
+		}
+	}
+	return causes
+}
+
+// denialStatus returns the status of a request denied by the given results
+func denialStatus(attr *Attributes, code int32, reason metav1.StatusReason, results []Result) *metav1.Status {
+	return &metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    code,
+		Reason:  reason,
+		Message: joinErrors(results).Error(),
+		Details: &metav1.StatusDetails{
+			Name:   attr.Request.Name,
+			Group:  attr.Request.Kind.Group,
+			Kind:   attr.Request.Kind.Kind,
+			Causes: statusCauses(results),
+		},
+	}
+}
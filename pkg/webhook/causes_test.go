@@ -0,0 +1,142 @@
+/*
+Copyright 2019 LitmusChaos Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/litmuschaos/chaos-operator/pkg/apis/litmuschaos/v1alpha1"
+	"k8s.io/api/admission/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestDenialCauses(t *testing.T) {
+	os.Setenv("LITMUS_NAMESPACE", litmusNamespace)
+	defer os.Unsetenv("LITMUS_NAMESPACE")
+
+	chaosExperiment := &v1alpha1.ChaosExperiment{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod-delete", Namespace: testNamespace},
+	}
+	raw, err := json.Marshal(&v1alpha1.ChaosEngine{
+		ObjectMeta: metav1.ObjectMeta{Name: "engine", Namespace: testNamespace},
+		Spec: v1alpha1.ChaosEngineSpec{
+			Appinfo: v1alpha1.ApplicationParams{Appns: testNamespace, Applabel: "app=nginx", AppKind: "deployment"},
+			Experiments: []v1alpha1.ExperimentList{
+				{
+					Name: "pod-delete",
+					Spec: v1alpha1.ExperimentAttributes{
+						Components: v1alpha1.ExperimentComponents{
+							ConfigMaps: []v1alpha1.ConfigMap{{Name: "configmap-1"}},
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal ChaosEngine: %v", err)
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	webhook := newTestWebhook(t, stopCh,
+		[]runtime.Object{&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespace}}},
+		[]runtime.Object{chaosExperiment})
+
+	response := webhook.validate(context.Background(), &v1beta1.AdmissionReview{
+		Request: &v1beta1.AdmissionRequest{
+			Kind:      metav1.GroupVersionKind{Group: "litmuschaos.io", Version: "v1alpha1", Kind: "ChaosEngine"},
+			Name:      "engine",
+			Namespace: testNamespace,
+			Operation: v1beta1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	})
+	if response.Allowed {
+		t.Fatalf("expected the ChaosEngine to be denied")
+	}
+	if response.Result.Details == nil {
+		t.Fatalf("expected the denial to hold details, got %+v", response.Result)
+	}
+
+	type cause struct {
+		code  Code
+		field string
+	}
+	causes := make([]cause, 0)
+	for _, c := range response.Result.Details.Causes {
+		causes = append(causes, cause{code: Code(c.Type), field: c.Field})
+		if !strings.Contains(response.Result.Message, fmt.Sprintf("[%s] %s: %s", c.Type, c.Field, c.Message)) {
+			t.Fatalf("expected the message to hold the cause %+v, got %q", c, response.Result.Message)
+		}
+	}
+	expected := []cause{
+		{code: CodeApplicationNotFound, field: "spec.appinfo.applabel"},
+		{code: CodeConfigMapNotFound, field: "spec.experiments[0].spec.components.configMaps[0].name"},
+	}
+	if !reflect.DeepEqual(causes, expected) {
+		t.Fatalf("expected causes %v, got %v", expected, causes)
+	}
+	codes := response.AuditAnnotations[errorCodesAnnotation]
+	if codes != "LAC-CONFIGMAP-001,LAC-TARGET-001" {
+		t.Fatalf("expected the error codes to be audited, got %q", codes)
+	}
+}
+
+func TestToFieldErrors(t *testing.T) {
+	var tests = []struct {
+		description string
+		err         error
+		expected    FieldErrors
+	}{
+		{
+			description: "Plain errors are failures of the whole object.",
+			err:         fmt.Errorf("failed"),
+			expected:    FieldErrors{{Code: CodeValidationFailed, Message: "failed"}},
+		},
+		{
+			description: "Field errors keep their field and code.",
+			err:         NewFieldError(appnsPath, CodeNamespaceNotFound, "not found"),
+			expected:    FieldErrors{{Field: "spec.appinfo.appns", Code: CodeNamespaceNotFound, Message: "not found"}},
+		},
+		{
+			description: "Lists of field errors are kept.",
+			err: FieldErrors{
+				NewFieldError(appnsPath, CodeNamespaceNotFound, "not found"),
+				NewFieldError(appkindPath, CodeUnsupportedAppKind, "unsupported"),
+			},
+			expected: FieldErrors{
+				{Field: "spec.appinfo.appns", Code: CodeNamespaceNotFound, Message: "not found"},
+				{Field: "spec.appinfo.appkind", Code: CodeUnsupportedAppKind, Message: "unsupported"},
+			},
+		},
+	}
+	for _, test := range tests {
+		fieldErrors := toFieldErrors(test.err, CodeValidationFailed)
+		if !reflect.DeepEqual(fieldErrors, test.expected) {
+			t.Fatalf("Test %q failed: expected %v, got %v", test.description, test.expected, fieldErrors)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2019 The LitmusChaos Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	litmuschaosv1alpha1 "github.com/litmuschaos/chaos-operator/pkg/client/clientset/versioned"
+)
+
+// certFiles are the files the serving certificate is read from, i.e. mounted
+// by a Vault agent or a CSI driver
+type certFiles struct {
+	cert string
+	key  string
+	// ca is optional, the caBundle of the webhooks is synced with it if set
+	ca string
+	// interval is the interval at which the files are checked for changes
+	interval time.Duration
+}
+
+// read returns the content of the files, the CA being nil if it isn't set
+func (f *certFiles) read() (certBytes, keyBytes, signingCertBytes []byte, err error) {
+	if certBytes, err = ioutil.ReadFile(f.cert); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read certificate file: %v", err)
+	}
+	if keyBytes, err = ioutil.ReadFile(f.key); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read key file: %v", err)
+	}
+	if f.ca != "" {
+		if signingCertBytes, err = ioutil.ReadFile(f.ca); err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to read CA file: %v", err)
+		}
+	}
+	return certBytes, keyBytes, signingCertBytes, nil
+}
+
+// newCertFiles creates a webhook serving the certificate of the CertFile and
+// KeyFile files, reloaded whenever they change
+func newCertFiles(p Parameters, kubeClient kubernetes.Interface,
+	litmusClient litmuschaosv1alpha1.Interface) (*webhook, error) {
+	if p.KeyFile == "" {
+		return nil, fmt.Errorf("a key file must be given along with the certificate file %s", p.CertFile)
+	}
+	files := &certFiles{cert: p.CertFile, key: p.KeyFile, ca: p.CAFile, interval: p.CertFileCheckInterval}
+	certBytes, keyBytes, signingCertBytes, err := files.read()
+	if err != nil {
+		return nil, err
+	}
+
+	wh, err := newWebhook(p, kubeClient, litmusClient)
+	if err != nil {
+		return nil, err
+	}
+	if err := wh.setServingCertificate(p, certBytes, keyBytes, signingCertBytes); err != nil {
+		return nil, err
+	}
+	// whatever writes the files renews the certificate
+	wh.certCheckInterval = 0
+	wh.caBundleSyncInterval = 0
+	wh.certFiles = files
+	Logger(SubsystemTLS).Info("Loaded serving certificate", "file", p.CertFile,
+		"dnsNames", wh.serving().cert.DNSNames, "notAfter", wh.serving().cert.NotAfter.String())
+	return wh, nil
+}
+
+// reloadCertFiles serves the certificate of the files if they changed. A
+// certificate and key which don't match, i.e. while the files are being
+// written, are retried at the next check while the previous certificate is
+// still served.
+func (wh *webhook) reloadCertFiles() error {
+	certBytes, keyBytes, signingCertBytes, err := wh.certFiles.read()
+	if err != nil {
+		return err
+	}
+	if _, err := tls.X509KeyPair(certBytes, keyBytes); err != nil {
+		return fmt.Errorf("failed to load key pair: %v", err)
+	}
+	// the API server must trust a new CA before its certificate is served
+	if signingCertBytes != nil && !bytes.Equal(signingCertBytes, wh.serving().caBundle) {
+		if err := syncCABundle(validatorWebhook, signingCertBytes, wh.kubeClient); err != nil {
+			return fmt.Errorf("failed to sync the caBundle of %s: %v", validatorWebhook, err)
+		}
+	}
+	_, err = wh.reloadServingCertificate(certBytes, keyBytes, signingCertBytes, "file", wh.certFiles.cert)
+	return err
+}
+
+// InitCertFileServer creates the Service and the ValidatingWebhookConfiguration
+// of an admission server serving the certificate of files. The caBundle of
+// the webhooks is the content of the given CA file, or is left to the user
+// without one. No Secret is created.
+func InitCertFileServer(ownerReference metav1.OwnerReference, caFile string, kubeClient kubernetes.Interface) error {
+
+	// Fetch our namespace
+	litmusNamespace, err := getLitmusNamespace()
+	if err != nil {
+		return err
+	}
+
+	err = preUpgrade(litmusNamespace, kubeClient)
+	if err != nil {
+		return err
+	}
+
+	var signingCertBytes []byte
+	if caFile != "" {
+		if signingCertBytes, err = ioutil.ReadFile(caFile); err != nil {
+			return fmt.Errorf("failed to read CA file: %v", err)
+		}
+	}
+
+	serviceErr := createWebhookService(
+		ownerReference,
+		validatorServiceName,
+		litmusNamespace,
+		kubeClient,
+	)
+	if serviceErr != nil {
+		return fmt.Errorf(
+			"failed to create Service{%s}: %v",
+			validatorServiceName,
+			serviceErr,
+		)
+	}
+
+	validatorErr := createAdmissionService(
+		ownerReference,
+		validatorWebhook,
+		litmusNamespace,
+		validatorServiceName,
+		signingCertBytes,
+		kubeClient,
+	)
+	if validatorErr != nil {
+		return fmt.Errorf(
+			"failed to create validator{%s}: %v",
+			validatorWebhook,
+			validatorErr,
+		)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2019 LitmusChaos Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	fakelitmus "github.com/litmuschaos/chaos-operator/pkg/client/clientset/versioned/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCertFiles(t *testing.T) {
+	os.Setenv("LITMUS_NAMESPACE", litmusNamespace)
+	defer os.Unsetenv("LITMUS_NAMESPACE")
+	os.Setenv(ServiceAccountEnvVar, "litmus")
+	defer os.Unsetenv(ServiceAccountEnvVar)
+
+	dir := t.TempDir()
+	p := Parameters{
+		CertFile: filepath.Join(dir, "tls.crt"),
+		KeyFile:  filepath.Join(dir, "tls.key"),
+		CAFile:   filepath.Join(dir, "ca.crt"),
+	}
+	type pemFiles struct{ cert, key, ca []byte }
+	issue := func() pemFiles {
+		ca, err := NewCA("vault-ca")
+		if err != nil {
+			t.Fatalf("failed to create CA: %v", err)
+		}
+		serverKeyPair, err := NewServerKeyPair(ca, "admission-controller", validatorServiceName, litmusNamespace, "cluster.local", nil, nil)
+		if err != nil {
+			t.Fatalf("failed to create server key pair: %v", err)
+		}
+		certBytes, keyBytes, err := serverKeyPair.encodePEM()
+		if err != nil {
+			t.Fatalf("failed to encode server key pair: %v", err)
+		}
+		return pemFiles{cert: certBytes, key: keyBytes, ca: EncodeCertPEM(ca.Cert)}
+	}
+	write := func(path string, data []byte) {
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+	}
+	initial := issue()
+	write(p.CertFile, initial.cert)
+	write(p.KeyFile, initial.key)
+	write(p.CAFile, initial.ca)
+
+	kubeClient := fake.NewSimpleClientset()
+	if err := InitCertFileServer(metav1.OwnerReference{}, p.CAFile, kubeClient); err != nil {
+		t.Fatalf("failed to init server: %v", err)
+	}
+	if _, err := GetSecret(litmusNamespace, validatorSecret, kubeClient); err == nil {
+		t.Fatalf("expected no Secret to be created")
+	}
+	wh, err := New(p, kubeClient, fakelitmus.NewSimpleClientset())
+	if err != nil {
+		t.Fatalf("failed to create webhook: %v", err)
+	}
+	renewed := issue()
+
+	var tests = []struct {
+		description     string
+		files           pemFiles
+		isErrorExpected bool
+		expected        pemFiles
+	}{
+		{
+			description: "Unchanged files keep the certificate.",
+			files:       initial,
+			expected:    initial,
+		},
+		{
+			description:     "A certificate written without its key isn't served.",
+			files:           pemFiles{cert: renewed.cert, key: initial.key, ca: renewed.ca},
+			isErrorExpected: true,
+			expected:        initial,
+		},
+		{
+			description: "A renewed certificate is served once its key is written.",
+			files:       renewed,
+			expected:    renewed,
+		},
+	}
+	for _, test := range tests {
+		write(p.CertFile, test.files.cert)
+		write(p.KeyFile, test.files.key)
+		write(p.CAFile, test.files.ca)
+
+		err := wh.reloadCertFiles()
+		if isError := err != nil; isError != test.isErrorExpected {
+			t.Fatalf("Test %q failed: expected error %v, got %v", test.description, test.isErrorExpected, err)
+		}
+		served, err := wh.getCertificate(nil)
+		if err != nil {
+			t.Fatalf("Test %q failed: %v", test.description, err)
+		}
+		if !bytes.Equal(EncodeCertPEM(wh.serving().cert), test.expected.cert) || !bytes.Equal(served.Certificate[0], wh.serving().cert.Raw) {
+			t.Fatalf("Test %q failed: expected the certificate of the files to be served", test.description)
+		}
+		config, err := GetValidatorWebhook(validatorWebhook, kubeClient)
+		if err != nil {
+			t.Fatalf("Test %q failed: %v", test.description, err)
+		}
+		for _, handler := range config.Webhooks {
+			if !bytes.Equal(handler.ClientConfig.CABundle, test.expected.ca) {
+				t.Fatalf("Test %q failed: expected the caBundle of %s to hold the CA file", test.description, handler.Name)
+			}
+		}
+	}
+}
@@ -0,0 +1,392 @@
+/*
+Copyright 2019 The LitmusChaos Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serror "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	certutil "k8s.io/client-go/util/cert"
+)
+
+// servingCertificate is the certificate served by the webhook along with the
+// PEM encoded CA which signed it
+type servingCertificate struct {
+	keyPair  *tls.Certificate
+	cert     *x509.Certificate
+	caBundle []byte
+}
+
+// serving returns the certificate currently served, nil until one is loaded
+func (wh *webhook) serving() *servingCertificate {
+	serving, _ := wh.certificate.Load().(*servingCertificate)
+	return serving
+}
+
+// getCertificate is the tls.Config GetCertificate of the server, called on
+// every handshake so new connections pick up a renewed certificate while the
+// established ones are left untouched
+func (wh *webhook) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	serving := wh.serving()
+	if serving == nil {
+		return nil, fmt.Errorf("serving certificate is not loaded")
+	}
+	return serving.keyPair, nil
+}
+
+// loadServingCertificate parses the given PEM encoded certificate, key and CA
+// and serves them to the new connections
+func (wh *webhook) loadServingCertificate(certBytes, keyBytes, signingCertBytes []byte) error {
+	keyPair, err := tls.X509KeyPair(certBytes, keyBytes)
+	if err != nil {
+		return fmt.Errorf("failed to load key pair: %v", err)
+	}
+	cert, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("failed to parse serving certificate: %v", err)
+	}
+	if err := setCertificateMetrics(cert, signingCertBytes); err != nil {
+		return err
+	}
+	wh.certificate.Store(&servingCertificate{keyPair: &keyPair, cert: cert, caBundle: signingCertBytes})
+	return nil
+}
+
+// secretKeys are the keys of the serving certificate, its key and its CA in a
+// Secret
+type secretKeys struct {
+	cert string
+	key  string
+	ca   string
+	// caOptional accepts a Secret without the CA, the caBundle is then left
+	// to the user
+	caOptional bool
+}
+
+// selfSignedKeys are the keys of the Secret created by InitValidationServer
+var selfSignedKeys = secretKeys{cert: appCrt, key: appKey, ca: rootCrt}
+
+// secretCertificates returns the PEM encoded serving certificate, key and CA
+// held by the given Secret, the CA is nil if it is optional and missing
+func secretCertificates(secret *corev1.Secret, keys secretKeys) (certBytes, keyBytes, signingCertBytes []byte, err error) {
+	required := []string{keys.cert, keys.key}
+	if !keys.caOptional {
+		required = append(required, keys.ca)
+	}
+	for _, key := range required {
+		if _, ok := secret.Data[key]; !ok {
+			return nil, nil, nil, fmt.Errorf(
+				"%s value not found in %s secret",
+				key,
+				secret.Name,
+			)
+		}
+	}
+	return secret.Data[keys.cert], secret.Data[keys.key], secret.Data[keys.ca], nil
+}
+
+// RunCertRotation checks the certificates every certCheckInterval until
+// stopCh is closed. A certificate renewed in the Secret, by another replica
+// or by hand, is reloaded. A certificate expiring within certRenewBefore is
+// reissued from the CA stored in the Secret, or requested again from the
+// signer of the cluster, and a CA expiring within caRenewBefore is replaced.
+// The caBundle of the webhooks is synced with the Secret every
+// caBundleSyncInterval meanwhile. A certificate read from files is reloaded
+// whenever they change instead.
+func (wh *webhook) RunCertRotation(stopCh <-chan struct{}) {
+	if wh.certFiles != nil && wh.certFiles.interval > 0 {
+		go wait.Until(func() {
+			if err := wh.reloadCertFiles(); err != nil {
+				Logger(SubsystemTLS).Error(err, "Failed to reload serving certificate", "file", wh.certFiles.cert)
+			}
+		}, wh.certFiles.interval, stopCh)
+	}
+	if wh.caBundleSyncInterval > 0 {
+		go wait.Until(func() {
+			if err := wh.syncCABundle(); err != nil {
+				Logger(SubsystemTLS).Error(err, "Failed to sync caBundle", "name", validatorWebhook)
+			}
+		}, wh.caBundleSyncInterval, stopCh)
+	}
+	if wh.certCheckInterval <= 0 {
+		return
+	}
+	Logger(SubsystemTLS).Info("Starting certificate rotation", "interval", wh.certCheckInterval.String(),
+		"renewBefore", wh.certRenewBefore.String(), "caRenewBefore", wh.caRenewBefore.String())
+	wait.Until(func() {
+		if err := wh.rotateCertificate(); err != nil {
+			Logger(SubsystemTLS).Error(err, "Failed to rotate certificates", "secret", validatorSecret)
+		}
+	}, wh.certCheckInterval, stopCh)
+}
+
+// syncCABundle sets the caBundle of the webhooks to the CAs of the Secret
+func (wh *webhook) syncCABundle() error {
+	namespace, err := getLitmusNamespace()
+	if err != nil {
+		return err
+	}
+	secret, err := GetSecret(namespace, validatorSecret, wh.kubeClient)
+	if err != nil {
+		return fmt.Errorf("failed to read secret(%s) object %v", validatorSecret, err)
+	}
+	return syncCABundle(validatorWebhook, secretCABundle(secret), wh.kubeClient)
+}
+
+// rotateCertificate reloads the serving certificate from the Secret and
+// renews the certificates of the Secret which are due, from the signer of the
+// cluster in the CSR mode
+func (wh *webhook) rotateCertificate() error {
+	namespace, err := getLitmusNamespace()
+	if err != nil {
+		return err
+	}
+	secret, err := GetSecret(namespace, validatorSecret, wh.kubeClient)
+	if err != nil {
+		return fmt.Errorf("failed to read secret(%s) object %v", validatorSecret, err)
+	}
+	// the API server must trust the CA of a certificate before it is served
+	if err := syncCABundle(validatorWebhook, secretCABundle(secret), wh.kubeClient); err != nil {
+		return fmt.Errorf("failed to sync the caBundle of %s: %v", validatorWebhook, err)
+	}
+	if err := wh.reloadCertificate(secret, selfSignedKeys); err != nil {
+		return err
+	}
+
+	policy := rotationPolicy{
+		certRenewBefore: wh.certRenewBefore,
+		caRenewBefore:   wh.caRenewBefore,
+		caGracePeriod:   wh.caGracePeriod,
+	}
+	var renewed *corev1.Secret
+	if wh.csr != nil {
+		renewed, err = wh.csr.renewSecret(secret, validatorServiceName, namespace, policy)
+	} else {
+		renewed, err = renewCertsSecret(secret, validatorServiceName, namespace, policy)
+	}
+	if err != nil || renewed == nil {
+		return err
+	}
+	updated, err := wh.kubeClient.CoreV1().Secrets(namespace).Update(renewed)
+	if err != nil {
+		if k8serror.IsConflict(err) {
+			// another replica renewed it first, its certificates are
+			// reloaded on the next check
+			Logger(SubsystemTLS).Info("Secret was updated concurrently, reloading on the next check", "secret", validatorSecret)
+			return nil
+		}
+		return fmt.Errorf("failed to update secret(%s) object %v", validatorSecret, err)
+	}
+	if err := syncCABundle(validatorWebhook, secretCABundle(updated), wh.kubeClient); err != nil {
+		return fmt.Errorf("failed to sync the caBundle of %s: %v", validatorWebhook, err)
+	}
+	return wh.reloadCertificate(updated, selfSignedKeys)
+}
+
+// reloadCertificate serves the certificate of the given Secret if it differs
+// from the one currently served
+func (wh *webhook) reloadCertificate(secret *corev1.Secret, keys secretKeys) error {
+	certBytes, keyBytes, signingCertBytes, err := secretCertificates(secret, keys)
+	if err != nil {
+		return err
+	}
+	_, err = wh.reloadServingCertificate(certBytes, keyBytes, signingCertBytes, "secret", secret.Name)
+	return err
+}
+
+// reloadServingCertificate serves the given PEM encoded certificate if it, or
+// its CA, differs from the one currently served, and tells if it did. The
+// source of the certificate is logged with the given key and value.
+func (wh *webhook) reloadServingCertificate(certBytes, keyBytes, signingCertBytes []byte, sourceKey string, source string) (bool, error) {
+	// the certificate may be followed by its chain
+	if certs, err := certutil.ParseCertsPEM(certBytes); err == nil {
+		if serving := wh.serving(); serving != nil && bytes.Equal(certs[0].Raw, serving.cert.Raw) &&
+			bytes.Equal(signingCertBytes, serving.caBundle) {
+			return false, nil
+		}
+	}
+	if err := wh.loadServingCertificate(certBytes, keyBytes, signingCertBytes); err != nil {
+		return false, err
+	}
+	Logger(SubsystemTLS).Info("Reloaded serving certificate", sourceKey, source,
+		"notAfter", wh.serving().cert.NotAfter.String())
+	return true, nil
+}
+
+// rotationPolicy tells when the certificates of the Secret are renewed
+type rotationPolicy struct {
+	// certRenewBefore is the time before the expiry of the serving
+	// certificate from which it is reissued
+	certRenewBefore time.Duration
+	// caRenewBefore is the time before the expiry of the CA from which it is
+	// replaced
+	caRenewBefore time.Duration
+	// caGracePeriod is how long the replaced CA stays trusted
+	caGracePeriod time.Duration
+}
+
+// renewCertsSecret returns a copy of the given Secret with the certificates
+// due according to the policy renewed, or nil if none of them is due. A new
+// CA is minted when the stored one is close to expiry or can't sign, i.e.
+// Secrets created before the CA key was stored. The replaced CA is kept in
+// the Secret, and so in the caBundle, for the grace period: replicas still
+// serving a certificate it signed are trusted until they reload.
+func renewCertsSecret(secret *corev1.Secret, serviceName string, namespace string, policy rotationPolicy) (*corev1.Secret, error) {
+	renewed := secret.DeepCopy()
+	if renewed.Data == nil {
+		renewed.Data = map[string][]byte{}
+	}
+	if renewed.Annotations == nil {
+		renewed.Annotations = map[string]string{}
+	}
+	renewCert := false
+
+	changed := dropPreviousCA(renewed)
+
+	caKeyPair, err := secretCA(secret)
+	if err == nil && time.Until(caKeyPair.Cert.NotAfter) < policy.caRenewBefore {
+		err = fmt.Errorf("CA expires at %v", caKeyPair.Cert.NotAfter)
+	} else if err == nil && !keyOptions.matches(caKeyPair.Cert.PublicKey) {
+		err = fmt.Errorf("CA key isn't %v", keyOptions)
+	}
+	if err != nil {
+		Logger(SubsystemTLS).Info("Rotating the CA", "secret", secret.Name, "reason", err.Error())
+		caKeyPair, err = NewCA(fmt.Sprintf("%s-ca", serviceName))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create root-ca: %v", err)
+		}
+		if previous, ok := secret.Data[rootCrt]; ok {
+			keepPreviousCA(renewed, previous, policy.caGracePeriod)
+		}
+		if renewed.Data[rootCrt], renewed.Data[rootKey], err = caKeyPair.encodePEM(); err != nil {
+			return nil, err
+		}
+		changed = true
+		renewCert = true
+	} else if certs, err := certutil.ParseCertsPEM(secret.Data[appCrt]); err != nil {
+		Logger(SubsystemTLS).Info("Renewing the serving certificate", "secret", secret.Name, "reason", err.Error())
+		renewCert = true
+	} else if notAfter := certs[0].NotAfter; time.Until(notAfter) < policy.certRenewBefore {
+		Logger(SubsystemTLS).Info("Renewing the serving certificate", "secret", secret.Name, "notAfter", notAfter.String())
+		renewCert = true
+	} else if !keyOptions.matches(certs[0].PublicKey) {
+		Logger(SubsystemTLS).Info("Renewing the serving certificate", "secret", secret.Name, "reason", fmt.Sprintf("key isn't %v", keyOptions))
+		renewCert = true
+	}
+
+	if renewCert {
+		serverKeyPair, err := newServiceKeyPair(caKeyPair, serviceName, namespace)
+		if err != nil {
+			return nil, err
+		}
+		if renewed.Data[appCrt], renewed.Data[appKey], err = serverKeyPair.encodePEM(); err != nil {
+			return nil, err
+		}
+		changed = true
+	}
+	if !changed {
+		return nil, nil
+	}
+	return renewed, nil
+}
+
+// dropPreviousCA removes the previous CA from the given Secret once its grace
+// period is over, and tells if it did
+func dropPreviousCA(secret *corev1.Secret) bool {
+	expiry, ok := secret.Annotations[previousCAExpiryAnnotation]
+	if !ok {
+		return false
+	}
+	if t, err := time.Parse(time.RFC3339, expiry); err == nil && time.Now().Before(t) {
+		return false
+	}
+	Logger(SubsystemTLS).Info("Dropping the previous CA", "secret", secret.Name, "expiry", expiry)
+	delete(secret.Data, previousRootCrt)
+	delete(secret.Annotations, previousCAExpiryAnnotation)
+	return true
+}
+
+// keepPreviousCA keeps the given replaced CA in the Secret, and so in the
+// caBundle, for the grace period
+func keepPreviousCA(secret *corev1.Secret, previous []byte, gracePeriod time.Duration) {
+	secret.Data[previousRootCrt] = previous
+	secret.Annotations[previousCAExpiryAnnotation] = time.Now().Add(gracePeriod).UTC().Format(time.RFC3339)
+}
+
+// secretCABundle returns the CAs trusted for the certificates of the given
+// Secret, its CA and the previous one during the grace period of a rotation
+func secretCABundle(secret *corev1.Secret) []byte {
+	caBundle := append([]byte{}, secret.Data[rootCrt]...)
+	if previous, ok := secret.Data[previousRootCrt]; ok {
+		caBundle = append(caBundle, previous...)
+	}
+	return caBundle
+}
+
+// secretCA returns the CA stored in the given Secret
+func secretCA(secret *corev1.Secret) (*KeyPair, error) {
+	caKey, ok := secret.Data[rootKey]
+	if !ok {
+		return nil, fmt.Errorf("%s value not found in %s secret", rootKey, secret.Name)
+	}
+	keyPair, err := tls.X509KeyPair(secret.Data[rootCrt], caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load CA key pair: %v", err)
+	}
+	cert, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA certificate: %v", err)
+	}
+	key, ok := keyPair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported CA key type %T", keyPair.PrivateKey)
+	}
+	return &KeyPair{Key: key, Cert: cert}, nil
+}
+
+// syncCABundle sets the caBundle of the webhooks of the given configuration,
+// if it exists
+func syncCABundle(
+	validatorWebhook string,
+	caBundle []byte,
+	kubeClient kubernetes.Interface,
+) error {
+
+	existing, err := GetValidatorWebhook(validatorWebhook, kubeClient)
+	if err != nil {
+		if k8serror.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	config := existing.DeepCopy()
+	outdated := setCABundle(config, caBundle)
+	if outdated == 0 {
+		return nil
+	}
+	Logger(SubsystemTLS).Info("Syncing caBundle of ValidatingWebhookConfiguration", "name", validatorWebhook, "webhooks", outdated)
+	_, err = kubeClient.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().Update(config)
+	return err
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2019 LitmusChaos Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"crypto/x509"
+	"os"
+	"testing"
+	"time"
+
+	"k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestCertRotation(t *testing.T) {
+	os.Setenv("LITMUS_NAMESPACE", litmusNamespace)
+	defer os.Unsetenv("LITMUS_NAMESPACE")
+
+	secret, err := newCertsSecret(validatorSecret, validatorServiceName, litmusNamespace)
+	if err != nil {
+		t.Fatalf("failed to create secret: %v", err)
+	}
+	legacySecret := secret.DeepCopy()
+	delete(legacySecret.Data, rootKey)
+	replicaSecret, err := renewCertsSecret(secret, validatorServiceName, litmusNamespace, rotationPolicy{certRenewBefore: 2 * duration365d})
+	if err != nil {
+		t.Fatalf("failed to renew secret: %v", err)
+	}
+	rotatedSecret, err := renewCertsSecret(secret, validatorServiceName, litmusNamespace, rotationPolicy{caRenewBefore: 20 * duration365d, caGracePeriod: -time.Minute})
+	if err != nil {
+		t.Fatalf("failed to rotate CA: %v", err)
+	}
+
+	var tests = []struct {
+		description       string
+		served            *corev1.Secret
+		stored            *corev1.Secret
+		staleCABundle     bool
+		renewBefore       time.Duration
+		caRenewBefore     time.Duration
+		isRenewalExpected bool
+		isCARenewExpected bool
+		isPreviousCAKept  bool
+	}{
+		{
+			description: "A certificate far from expiry is kept.",
+			served:      secret,
+			stored:      secret,
+			renewBefore: 24 * time.Hour,
+		},
+		{
+			description:       "A certificate close to expiry is reissued from the stored CA.",
+			served:            secret,
+			stored:            secret,
+			renewBefore:       2 * duration365d,
+			isRenewalExpected: true,
+		},
+		{
+			description:       "A Secret without the CA key gets a new CA in the caBundle.",
+			served:            legacySecret,
+			stored:            legacySecret,
+			renewBefore:       24 * time.Hour,
+			isRenewalExpected: true,
+			isCARenewExpected: true,
+			isPreviousCAKept:  true,
+		},
+		{
+			description:       "A CA close to expiry is replaced, the previous one stays in the caBundle.",
+			served:            secret,
+			stored:            secret,
+			renewBefore:       24 * time.Hour,
+			caRenewBefore:     20 * duration365d,
+			isRenewalExpected: true,
+			isCARenewExpected: true,
+			isPreviousCAKept:  true,
+		},
+		{
+			description: "The previous CA is dropped from the caBundle after its grace period.",
+			served:      rotatedSecret,
+			stored:      rotatedSecret,
+			renewBefore: 24 * time.Hour,
+		},
+		{
+			description:   "A stale caBundle is synced with the Secret.",
+			served:        secret,
+			stored:        secret,
+			staleCABundle: true,
+			renewBefore:   24 * time.Hour,
+		},
+		{
+			description: "A certificate renewed in the Secret by another replica is reloaded.",
+			served:      secret,
+			stored:      replicaSecret,
+			renewBefore: 24 * time.Hour,
+		},
+	}
+	for _, test := range tests {
+		stopCh := make(chan struct{})
+		caBundle := secretCABundle(test.stored)
+		if test.staleCABundle {
+			caBundle = []byte("stale")
+		}
+		config := &v1beta1.ValidatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: validatorWebhook},
+			Webhooks:   getWebhookHandlers(litmusNamespace, validatorServiceName, caBundle),
+		}
+		wh := newTestWebhook(t, stopCh, []runtime.Object{test.stored.DeepCopy(), config}, nil)
+		close(stopCh)
+		if err := wh.reloadCertificate(test.served, selfSignedKeys); err != nil {
+			t.Fatalf("Test %q failed: failed to load certificate: %v", test.description, err)
+		}
+		wh.certRenewBefore = test.renewBefore
+		wh.caRenewBefore = test.caRenewBefore
+
+		if err := wh.rotateCertificate(); err != nil {
+			t.Fatalf("Test %q failed: %v", test.description, err)
+		}
+
+		stored, err := GetSecret(litmusNamespace, validatorSecret, wh.kubeClient)
+		if err != nil {
+			t.Fatalf("Test %q failed: %v", test.description, err)
+		}
+		if isRenewed := !bytes.Equal(stored.Data[appCrt], test.stored.Data[appCrt]); isRenewed != test.isRenewalExpected {
+			t.Fatalf("Test %q failed: expected renewal %v, got %v", test.description, test.isRenewalExpected, isRenewed)
+		}
+		if isCARenewed := !bytes.Equal(stored.Data[rootCrt], test.stored.Data[rootCrt]); isCARenewed != test.isCARenewExpected {
+			t.Fatalf("Test %q failed: expected CA renewal %v, got %v", test.description, test.isCARenewExpected, isCARenewed)
+		}
+		if previous, isKept := stored.Data[previousRootCrt]; isKept != test.isPreviousCAKept {
+			t.Fatalf("Test %q failed: expected the previous CA to be kept %v, got %v", test.description, test.isPreviousCAKept, isKept)
+		} else if isKept && !bytes.Equal(previous, test.stored.Data[rootCrt]) {
+			t.Fatalf("Test %q failed: expected the previous CA to be the replaced one", test.description)
+		}
+
+		// new connections are served the certificate of the Secret
+		served, err := wh.getCertificate(nil)
+		if err != nil {
+			t.Fatalf("Test %q failed: %v", test.description, err)
+		}
+		if !bytes.Equal(EncodeCertPEM(wh.serving().cert), stored.Data[appCrt]) || !bytes.Equal(served.Certificate[0], wh.serving().cert.Raw) {
+			t.Fatalf("Test %q failed: expected the certificate of the Secret to be served", test.description)
+		}
+		roots := x509.NewCertPool()
+		roots.AppendCertsFromPEM(stored.Data[rootCrt])
+		if _, err := wh.serving().cert.Verify(x509.VerifyOptions{Roots: roots}); err != nil {
+			t.Fatalf("Test %q failed: expected the served certificate to be signed by the stored CA: %v", test.description, err)
+		}
+
+		config, err = GetValidatorWebhook(validatorWebhook, wh.kubeClient)
+		if err != nil {
+			t.Fatalf("Test %q failed: %v", test.description, err)
+		}
+		for _, handler := range config.Webhooks {
+			if !bytes.Equal(handler.ClientConfig.CABundle, secretCABundle(stored)) {
+				t.Fatalf("Test %q failed: expected the caBundle of %s to hold the CAs of the Secret", test.description, handler.Name)
+			}
+		}
+	}
+}
@@ -0,0 +1,318 @@
+/*
+Copyright 2019 The LitmusChaos Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	version "github.com/litmuschaos/admission-controllers/pkg/version"
+	litmuschaosv1alpha1 "github.com/litmuschaos/chaos-operator/pkg/client/clientset/versioned"
+)
+
+// injectCAFromAnnotation asks the cert-manager CA injector to set the
+// caBundle of the webhooks to the CA of the given namespace/Certificate
+const injectCAFromAnnotation = "cert-manager.io/inject-ca-from"
+
+var (
+	// certificateResource is the cert-manager Certificate resource
+	certificateResource = schema.GroupVersionResource{Group: "cert-manager.io", Version: "v1", Resource: "certificates"}
+
+	// certManagerKeys are the keys of a Secret issued by cert-manager, which
+	// omits the CA for ACME and some external issuers
+	certManagerKeys = secretKeys{cert: corev1.TLSCertKey, key: corev1.TLSPrivateKeyKey, ca: rootCrt, caOptional: true}
+
+	// certManagerIssueTimeout is how long the admission server waits for
+	// cert-manager to issue the Secret at startup
+	certManagerIssueTimeout = 2 * time.Minute
+	certManagerPollInterval = 2 * time.Second
+)
+
+// CertManagerOptions configures the serving certificate issued by
+// cert-manager, instead of a self-signed one
+type CertManagerOptions struct {
+	// Enabled serves the certificate of Secret
+	Enabled bool
+	// Secret is the Secret cert-manager issues the serving certificate to
+	Secret string
+	// Certificate is the cert-manager Certificate issuing Secret, the CA
+	// injector sets the caBundle of the webhooks from it
+	Certificate string
+	// Issuer is the issuer of the Certificate, as Issuer/<name> or
+	// ClusterIssuer/<name>. The Certificate is created if set, otherwise it
+	// must exist.
+	Issuer string
+}
+
+// InitCertManagerServer creates the Service and the ValidatingWebhookConfiguration
+// of the admission server, the caBundle of the webhooks being injected by
+// cert-manager from the Certificate. The Certificate is created if an issuer
+// is given. No self-signed certificate is created.
+func InitCertManagerServer(
+	ownerReference metav1.OwnerReference,
+	opts CertManagerOptions,
+	kubeClient kubernetes.Interface,
+	dynamicClient dynamic.Interface,
+) error {
+
+	litmusNamespace, err := getLitmusNamespace()
+	if err != nil {
+		return err
+	}
+
+	err = preUpgrade(litmusNamespace, kubeClient)
+	if err != nil {
+		return err
+	}
+
+	if opts.Issuer != "" {
+		if err := createCertificate(ownerReference, opts, validatorServiceName, litmusNamespace, dynamicClient); err != nil {
+			return fmt.Errorf("failed to create certificate(%s) resource %v", opts.Certificate, err)
+		}
+	}
+
+	serviceErr := createWebhookService(
+		ownerReference,
+		validatorServiceName,
+		litmusNamespace,
+		kubeClient,
+	)
+	if serviceErr != nil {
+		return fmt.Errorf(
+			"failed to create Service{%s}: %v",
+			validatorServiceName,
+			serviceErr,
+		)
+	}
+
+	validatorErr := createInjectedAdmissionService(
+		ownerReference,
+		validatorWebhook,
+		litmusNamespace,
+		validatorServiceName,
+		opts.Certificate,
+		kubeClient,
+	)
+	if validatorErr != nil {
+		return fmt.Errorf(
+			"failed to create validator{%s}: %v",
+			validatorWebhook,
+			validatorErr,
+		)
+	}
+	return nil
+}
+
+// createCertificate creates the cert-manager Certificate of the webhook
+// service if it does not exist
+func createCertificate(
+	ownerReference metav1.OwnerReference,
+	opts CertManagerOptions,
+	serviceName string,
+	namespace string,
+	dynamicClient dynamic.Interface,
+) error {
+
+	certificates := dynamicClient.Resource(certificateResource).Namespace(namespace)
+	_, err := certificates.Get(opts.Certificate, metav1.GetOptions{})
+	if err == nil || !k8serror.IsNotFound(err) {
+		return err
+	}
+
+	certificate, err := newCertificate(opts, serviceName, namespace)
+	if err != nil {
+		return err
+	}
+	certificate.SetOwnerReferences([]metav1.OwnerReference{ownerReference})
+	Logger(SubsystemBootstrap).Info("Creating cert-manager Certificate", "namespace", namespace,
+		"name", opts.Certificate, "issuer", opts.Issuer)
+	_, err = certificates.Create(certificate, metav1.CreateOptions{})
+	return err
+}
+
+// newCertificate returns the cert-manager Certificate issuing the serving
+// certificate of the given service to the Secret
+func newCertificate(opts CertManagerOptions, serviceName string, namespace string) (*unstructured.Unstructured, error) {
+	issuerKind, issuerName, err := parseIssuer(opts.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": certificateResource.GroupVersion().String(),
+		"kind":       "Certificate",
+		"metadata": map[string]interface{}{
+			"name":      opts.Certificate,
+			"namespace": namespace,
+			"labels": map[string]interface{}{
+				"app":                           "admission-controller",
+				"litmuschaos.io/component-name": "admission-controller",
+				string(litmuschaosVersion):      version.Current(),
+			},
+		},
+		"spec": map[string]interface{}{
+			"secretName": opts.Secret,
+			"commonName": strings.Join([]string{serviceName, namespace, "svc"}, "."),
+			"dnsNames": []interface{}{
+				serviceName,
+				strings.Join([]string{serviceName, namespace}, "."),
+				strings.Join([]string{serviceName, namespace, "svc"}, "."),
+				strings.Join([]string{serviceName, namespace, "svc", "cluster.local"}, "."),
+			},
+			"usages": []interface{}{"digital signature", "key encipherment", "server auth"},
+			"issuerRef": map[string]interface{}{
+				"group": certificateResource.Group,
+				"kind":  issuerKind,
+				"name":  issuerName,
+			},
+		},
+	}}, nil
+}
+
+// parseIssuer splits an issuer given as Issuer/<name> or ClusterIssuer/<name>,
+// a bare name being an Issuer
+func parseIssuer(issuer string) (kind string, name string, err error) {
+	kind, name = "Issuer", issuer
+	if i := strings.Index(issuer, "/"); i >= 0 {
+		kind, name = issuer[:i], issuer[i+1:]
+	}
+	if (kind != "Issuer" && kind != "ClusterIssuer") || name == "" {
+		return "", "", fmt.Errorf("invalid issuer %q, expected Issuer/<name> or ClusterIssuer/<name>", issuer)
+	}
+	return kind, name, nil
+}
+
+// createInjectedAdmissionService creates our ValidatingWebhookConfiguration
+// resource annotated for the cert-manager CA injector if it does not exist,
+// else annotates it and registers the webhooks missing from it. The caBundle
+// is left to the CA injector.
+func createInjectedAdmissionService(
+	ownerReference metav1.OwnerReference,
+	validatorWebhook string,
+	namespace string,
+	serviceName string,
+	certificate string,
+	kubeClient kubernetes.Interface,
+) error {
+
+	webhookHandlers := getWebhookHandlers(namespace, serviceName, nil)
+	injectFrom := strings.Join([]string{namespace, certificate}, "/")
+
+	existing, err := GetValidatorWebhook(validatorWebhook, kubeClient)
+	if err == nil {
+		if existing.Annotations[injectCAFromAnnotation] != injectFrom {
+			config := existing.DeepCopy()
+			if config.Annotations == nil {
+				config.Annotations = map[string]string{}
+			}
+			config.Annotations[injectCAFromAnnotation] = injectFrom
+			Logger(SubsystemBootstrap).Info("Annotating ValidatingWebhookConfiguration for the CA injector",
+				"name", validatorWebhook, "certificate", injectFrom)
+			existing, err = kubeClient.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().Update(config)
+			if err != nil {
+				return err
+			}
+		}
+		return reconcileHandlers(existing, webhookHandlers, nil, kubeClient)
+	}
+	if !k8serror.IsNotFound(err) {
+		return fmt.Errorf("failed to get webhook validator {%v}: %v", validatorWebhook, err)
+	}
+
+	validator := newValidatorWebhook(validatorWebhook, webhookHandlers)
+	validator.Annotations = map[string]string{injectCAFromAnnotation: injectFrom}
+	validator.OwnerReferences = []metav1.OwnerReference{ownerReference}
+
+	Logger(SubsystemBootstrap).Info("Creating ValidatingWebhookConfiguration", "name", validatorWebhook, "certificate", injectFrom)
+	_, err = kubeClient.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().Create(validator)
+	return err
+}
+
+// newCertManager creates a webhook serving the certificate issued by
+// cert-manager, reloaded whenever cert-manager renews the Secret
+func newCertManager(p Parameters, kubeClient kubernetes.Interface,
+	litmusClient litmuschaosv1alpha1.Interface) (*webhook, error) {
+	opts := p.CertManager
+
+	admNamespace, err := getLitmusNamespace()
+	if err != nil {
+		return nil, err
+	}
+
+	// cert-manager may not have issued the certificate yet
+	var secret *corev1.Secret
+	err = wait.PollImmediate(certManagerPollInterval, certManagerIssueTimeout, func() (bool, error) {
+		secret, err = GetSecret(admNamespace, opts.Secret, kubeClient)
+		if k8serror.IsNotFound(err) {
+			Logger(SubsystemTLS).Info("Waiting for cert-manager to issue the serving certificate", "secret", opts.Secret)
+			return false, nil
+		}
+		return err == nil, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret(%s) object %v", opts.Secret, err)
+	}
+	certBytes, keyBytes, signingCertBytes, err := secretCertificates(secret, certManagerKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	wh, err := newWebhook(p, kubeClient, litmusClient)
+	if err != nil {
+		return nil, err
+	}
+	if err := wh.setServingCertificate(p, certBytes, keyBytes, signingCertBytes); err != nil {
+		return nil, err
+	}
+	// cert-manager renews the certificate and the CA injector the caBundle
+	wh.certCheckInterval = 0
+	wh.caBundleSyncInterval = 0
+	wh.watchCertManagerSecret(admNamespace, opts.Secret)
+	Logger(SubsystemTLS).Info("Loaded cert-manager serving certificate", "secret", opts.Secret,
+		"dnsNames", wh.serving().cert.DNSNames, "notAfter", wh.serving().cert.NotAfter.String())
+	return wh, nil
+}
+
+// watchCertManagerSecret reloads the serving certificate whenever the given
+// Secret changes, once the informers are started
+func (wh *webhook) watchCertManagerSecret(namespace string, name string) {
+	reload := func(obj interface{}) {
+		if err := wh.reloadCertificate(obj.(*corev1.Secret), certManagerKeys); err != nil {
+			Logger(SubsystemTLS).Error(err, "Failed to reload cert-manager serving certificate", "secret", name)
+		}
+	}
+	wh.cache.secretInformer.AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			secret, ok := obj.(*corev1.Secret)
+			return ok && secret.Namespace == namespace && secret.Name == name
+		},
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc:    reload,
+			UpdateFunc: func(_, obj interface{}) { reload(obj) },
+		},
+	})
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2019 LitmusChaos Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	fakelitmus "github.com/litmuschaos/chaos-operator/pkg/client/clientset/versioned/fake"
+	"k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestInitCertManagerServer(t *testing.T) {
+	os.Setenv("LITMUS_NAMESPACE", litmusNamespace)
+	defer os.Unsetenv("LITMUS_NAMESPACE")
+
+	injected := []byte("injected")
+	var tests = []struct {
+		description           string
+		existing              []runtime.Object
+		issuer                string
+		expectedIssuerKind    string
+		expectedCABundle      []byte
+		isCertificateExpected bool
+		isErrorExpected       bool
+	}{
+		{
+			description:           "The Certificate is created for the issuer and the caBundle left to the CA injector.",
+			issuer:                "ClusterIssuer/selfsigned",
+			expectedIssuerKind:    "ClusterIssuer",
+			isCertificateExpected: true,
+		},
+		{
+			description: "An existing configuration is annotated and keeps its injected caBundle.",
+			existing: []runtime.Object{&v1beta1.ValidatingWebhookConfiguration{
+				ObjectMeta: metav1.ObjectMeta{Name: validatorWebhook},
+				Webhooks:   getWebhookHandlers(litmusNamespace, validatorServiceName, injected),
+			}},
+			expectedCABundle: injected,
+		},
+		{
+			description:     "Unknown issuer kinds are rejected.",
+			issuer:          "Vault/issuer",
+			isErrorExpected: true,
+		},
+	}
+	for _, test := range tests {
+		kubeClient := fake.NewSimpleClientset(test.existing...)
+		dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme())
+		opts := CertManagerOptions{Enabled: true, Secret: "admission-controller-tls", Certificate: "admission-controller-certificate", Issuer: test.issuer}
+
+		err := InitCertManagerServer(metav1.OwnerReference{}, opts, kubeClient, dynamicClient)
+		if isError := err != nil; isError != test.isErrorExpected {
+			t.Fatalf("Test %q failed: expected error %v, got %v", test.description, test.isErrorExpected, err)
+		}
+		if err != nil {
+			continue
+		}
+
+		certificate, err := dynamicClient.Resource(certificateResource).Namespace(litmusNamespace).Get(opts.Certificate, metav1.GetOptions{})
+		if isCreated := err == nil; isCreated != test.isCertificateExpected {
+			t.Fatalf("Test %q failed: expected the Certificate to be created %v, got %v", test.description, test.isCertificateExpected, err)
+		}
+		if certificate != nil {
+			secretName, _, _ := unstructured.NestedString(certificate.Object, "spec", "secretName")
+			issuerKind, _, _ := unstructured.NestedString(certificate.Object, "spec", "issuerRef", "kind")
+			if secretName != opts.Secret || issuerKind != test.expectedIssuerKind {
+				t.Fatalf("Test %q failed: expected a Certificate issued by a %s to %s, got %v", test.description, test.expectedIssuerKind, opts.Secret, certificate.Object["spec"])
+			}
+		}
+
+		config, err := GetValidatorWebhook(validatorWebhook, kubeClient)
+		if err != nil {
+			t.Fatalf("Test %q failed: %v", test.description, err)
+		}
+		if injectFrom := config.Annotations[injectCAFromAnnotation]; injectFrom != litmusNamespace+"/"+opts.Certificate {
+			t.Fatalf("Test %q failed: expected the configuration to be injected from the Certificate, got %q", test.description, injectFrom)
+		}
+		if len(config.Webhooks) != 3 {
+			t.Fatalf("Test %q failed: expected 3 webhooks, got %d", test.description, len(config.Webhooks))
+		}
+		for _, handler := range config.Webhooks {
+			if !bytes.Equal(handler.ClientConfig.CABundle, test.expectedCABundle) {
+				t.Fatalf("Test %q failed: expected the caBundle of %s to be left to the CA injector, got %q", test.description, handler.Name, handler.ClientConfig.CABundle)
+			}
+		}
+	}
+}
+
+func TestCertManagerReload(t *testing.T) {
+	os.Setenv("LITMUS_NAMESPACE", litmusNamespace)
+	defer os.Unsetenv("LITMUS_NAMESPACE")
+	os.Setenv(ServiceAccountEnvVar, "litmus")
+	defer os.Unsetenv(ServiceAccountEnvVar)
+	defer func(timeout time.Duration) { certManagerIssueTimeout = timeout }(certManagerIssueTimeout)
+	certManagerIssueTimeout = 10 * time.Millisecond
+
+	issue := func() *corev1.Secret {
+		ca, err := NewCA("cert-manager-ca")
+		if err != nil {
+			t.Fatalf("failed to create CA: %v", err)
+		}
+		serverKeyPair, err := NewServerKeyPair(ca, "admission-controller", validatorServiceName, litmusNamespace, "cluster.local", nil, nil)
+		if err != nil {
+			t.Fatalf("failed to create server key pair: %v", err)
+		}
+		certBytes, keyBytes, err := serverKeyPair.encodePEM()
+		if err != nil {
+			t.Fatalf("failed to encode server key pair: %v", err)
+		}
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "admission-controller-tls", Namespace: litmusNamespace},
+			Type:       corev1.SecretTypeTLS,
+			Data: map[string][]byte{
+				corev1.TLSCertKey:       certBytes,
+				corev1.TLSPrivateKeyKey: keyBytes,
+				rootCrt:                 EncodeCertPEM(ca.Cert),
+			},
+		}
+	}
+	p := Parameters{CertManager: CertManagerOptions{Enabled: true, Secret: "admission-controller-tls"}}
+
+	if _, err := New(p, fake.NewSimpleClientset(), fakelitmus.NewSimpleClientset()); err == nil {
+		t.Fatalf("expected an error until cert-manager issues the Secret")
+	}
+
+	kubeClient := fake.NewSimpleClientset(issue())
+	wh, err := New(p, kubeClient, fakelitmus.NewSimpleClientset())
+	if err != nil {
+		t.Fatalf("failed to create webhook: %v", err)
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	if err := wh.Start(stopCh); err != nil {
+		t.Fatalf("failed to start webhook: %v", err)
+	}
+
+	renewed := issue()
+	if _, err := kubeClient.CoreV1().Secrets(litmusNamespace).Update(renewed); err != nil {
+		t.Fatalf("failed to renew Secret: %v", err)
+	}
+	err = wait.Poll(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return bytes.Equal(EncodeCertPEM(wh.serving().cert), renewed.Data[corev1.TLSCertKey]), nil
+	})
+	if err != nil {
+		t.Fatalf("expected the renewed certificate to be served: %v", err)
+	}
+	if !bytes.Equal(wh.serving().caBundle, renewed.Data[rootCrt]) {
+		t.Fatalf("expected the CA of the renewed Secret to be served")
+	}
+}
+
+func TestCertManagerSecretWithoutCA(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "admission-controller-tls", Namespace: litmusNamespace},
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       []byte("cert"),
+			corev1.TLSPrivateKeyKey: []byte("key"),
+		},
+	}
+
+	var tests = []struct {
+		description     string
+		keys            secretKeys
+		isErrorExpected bool
+	}{
+		{
+			description: "The CA of a cert-manager Secret is optional, i.e. of ACME issuers.",
+			keys:        certManagerKeys,
+		},
+		{
+			description:     "The CA of the self-signed Secret is required.",
+			keys:            secretKeys{cert: corev1.TLSCertKey, key: corev1.TLSPrivateKeyKey, ca: rootCrt},
+			isErrorExpected: true,
+		},
+	}
+	for _, test := range tests {
+		certBytes, _, signingCertBytes, err := secretCertificates(secret, test.keys)
+		if isError := err != nil; isError != test.isErrorExpected {
+			t.Fatalf("Test %q failed: expected error %v, got %v", test.description, test.isErrorExpected, err)
+		}
+		if err == nil && (string(certBytes) != "cert" || signingCertBytes != nil) {
+			t.Fatalf("Test %q failed: expected the certificate without a CA, got %q and %q", test.description, certBytes, signingCertBytes)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2019 The LitmusChaos Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// Code identifies a validation failure in the error code catalog. Codes are
+// stable across releases, runbooks and alert rules may rely on them.
+type Code string
+
+// Codes of the failures of the built-in validators
+const (
+	CodeValidationFailed         Code = "LAC-GENERIC-001"
+	CodeValidationInconclusive   Code = "LAC-GENERIC-002"
+	CodeApplicationNotFound      Code = "LAC-TARGET-001"
+	CodeInvalidAppLabel          Code = "LAC-TARGET-002"
+	CodeUnsupportedAppKind       Code = "LAC-TARGET-003"
+	CodeAppLabelNotInPodTemplate Code = "LAC-TARGET-004"
+	CodeNamespaceNotFound        Code = "LAC-NAMESPACE-001"
+	CodeChaosExperimentNotFound  Code = "LAC-EXPERIMENT-001"
+	CodeConfigMapNotFound        Code = "LAC-CONFIGMAP-001"
+	CodeSecretNotFound           Code = "LAC-SECRET-001"
+	CodeProtectedComponent       Code = "LAC-PROTECT-001"
+	CodeProtectedSecret          Code = "LAC-PROTECT-002"
+	CodeProtectedResource        Code = "LAC-PROTECT-003"
+	CodeResourceInUse            Code = "LAC-REFERENCE-001"
+)
+
+// codeFormat is the format of the codes, LAC-<AREA>-<NUMBER>
+var codeFormat = regexp.MustCompile(`^LAC-[A-Z]+-[0-9]{3}$`)
+
+// ErrorCode describes a Code in the error code catalog
+type ErrorCode struct {
+	Code Code
+	// Title is a short summary of the failure
+	Title string
+	// Cause tells why the failure happens
+	Cause string
+	// Fix tells how to get the request admitted
+	Fix string
+}
+
+var (
+	errorCodesMu sync.RWMutex
+	errorCodes   = map[Code]ErrorCode{}
+)
+
+func init() {
+	for _, errorCode := range []ErrorCode{
+		{
+			Code:  CodeValidationFailed,
+			Title: "Validation failed",
+			Cause: "A validator failed without a more specific code, i.e. the admission controller could not read a resource from its caches.",
+			Fix:   "Check the message of the failure and the logs of the admission controller.",
+		},
+		{
+			Code:  CodeValidationInconclusive,
+			Title: "Validation inconclusive",
+			Cause: "A validator did not complete within the timeout of the admission request or -validatorTimeout, and -inconclusivePolicy is deny.",
+			Fix:   "Retry the request. If the failure persists, raise -validatorTimeout or -validatorWorkers, or check the load of the admission controller.",
+		},
+		{
+			Code:  CodeApplicationNotFound,
+			Title: "Application not found",
+			Cause: "No workload of the kind .spec.appinfo.appkind in the namespace .spec.appinfo.appns matches the label selector .spec.appinfo.applabel.",
+			Fix:   "Fix .spec.appinfo so that it selects the application under test, or deploy the application first.",
+		},
+		{
+			Code:  CodeInvalidAppLabel,
+			Title: "Invalid applabel",
+			Cause: ".spec.appinfo.applabel is not a valid label selector.",
+			Fix:   "Use a label selector such as app=nginx.",
+		},
+		{
+			Code:  CodeUnsupportedAppKind,
+			Title: "Unsupported appkind",
+			Cause: ".spec.appinfo.appkind is not a deployment, statefulset or daemonset.",
+			Fix:   "Set .spec.appinfo.appkind to deployment, statefulset or daemonset.",
+		},
+		{
+			Code:  CodeAppLabelNotInPodTemplate,
+			Title: "Applabel not in pod template",
+			Cause: "A workload matched by .spec.appinfo.applabel doesn't carry the label in its pod template, so chaos can't target its pods.",
+			Fix:   "Add the label to the pod template of the workload, or use a label of the pod template as .spec.appinfo.applabel.",
+		},
+		{
+			Code:  CodeNamespaceNotFound,
+			Title: "Application namespace not found",
+			Cause: "The namespace .spec.appinfo.appns doesn't exist.",
+			Fix:   "Fix .spec.appinfo.appns, or create the namespace first.",
+		},
+		{
+			Code:  CodeChaosExperimentNotFound,
+			Title: "ChaosExperiment not found",
+			Cause: "An experiment of .spec.experiments isn't installed in the application namespace.",
+			Fix:   "Install the ChaosExperiment in the application namespace, i.e. from the chaos hub, or fix its name.",
+		},
+		{
+			Code:  CodeConfigMapNotFound,
+			Title: "ConfigMap not found",
+			Cause: "A ConfigMap mounted by an experiment doesn't exist in the application namespace.",
+			Fix:   "Create the ConfigMap in the application namespace, or fix its name.",
+		},
+		{
+			Code:  CodeSecretNotFound,
+			Title: "Secret not found",
+			Cause: "A Secret mounted by an experiment doesn't exist in the application namespace.",
+			Fix:   "Create the Secret in the application namespace, or fix its name.",
+		},
+		{
+			Code:  CodeProtectedComponent,
+			Title: "Litmus control plane targeted",
+			Cause: ".spec.appinfo selects the chaos-operator or the admission controller in the litmus namespace.",
+			Fix:   "Target another application. The litmus control plane can't be the target of chaos.",
+		},
+		{
+			Code:  CodeProtectedSecret,
+			Title: "Admission controller Secret mounted",
+			Cause: "An experiment mounts admission-controller-secret, which holds the keys of the admission controller.",
+			Fix:   "Remove the Secret from the components of the experiment.",
+		},
+		{
+			Code:  CodeProtectedResource,
+			Title: "Admission controller resource modified",
+			Cause: "The Secret or Service of the admission controller is updated or deleted by a user which is neither the admission controller nor a member of -adminGroups.",
+			Fix:   "Let the admission controller manage its resources, or use a user of -adminGroups.",
+		},
+		{
+			Code:  CodeResourceInUse,
+			Title: "Resource used by an active ChaosEngine",
+			Cause: "The deleted ChaosExperiment, ConfigMap or Secret is still used by an active ChaosEngine.",
+			Fix:   "Stop the ChaosEngines named in the message, i.e. set their .spec.engineState to stop, then delete the resource.",
+		},
+	} {
+		if err := RegisterErrorCode(errorCode); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterErrorCode adds a code to the error code catalog, validators
+// registered with Register add the codes they return along with them
+func RegisterErrorCode(errorCode ErrorCode) error {
+	if !codeFormat.MatchString(string(errorCode.Code)) {
+		return fmt.Errorf("invalid error code %s, expected LAC-<AREA>-<NUMBER>", errorCode.Code)
+	}
+	errorCodesMu.Lock()
+	defer errorCodesMu.Unlock()
+	if _, ok := errorCodes[errorCode.Code]; ok {
+		return fmt.Errorf("error code %s is already registered", errorCode.Code)
+	}
+	errorCodes[errorCode.Code] = errorCode
+	return nil
+}
+
+// LookupErrorCode returns the catalog entry of the given code
+func LookupErrorCode(code Code) (ErrorCode, bool) {
+	errorCodesMu.RLock()
+	defer errorCodesMu.RUnlock()
+	errorCode, ok := errorCodes[code]
+	return errorCode, ok
+}
+
+// ErrorCodes returns the error code catalog sorted by code
+func ErrorCodes() []ErrorCode {
+	errorCodesMu.RLock()
+	defer errorCodesMu.RUnlock()
+	catalog := make([]ErrorCode, 0, len(errorCodes))
+	for _, errorCode := range errorCodes {
+		catalog = append(catalog, errorCode)
+	}
+	sort.Slice(catalog, func(i, j int) bool { return catalog[i].Code < catalog[j].Code })
+	return catalog
+}
+
+// WriteErrorCodes writes the error code catalog as markdown
+func WriteErrorCodes(w io.Writer) error {
+	if _, err := fmt.Fprint(w, "# Error codes\n\n"+
+		"Every failure returned by the litmus admission controller carries one of the following codes,\n"+
+		"in its message and as the type of its cause in `.details.causes` of the denial.\n"+
+		"This file is generated with `make error-codes`, do not edit it.\n"); err != nil {
+		return err
+	}
+	for _, errorCode := range ErrorCodes() {
+		if _, err := fmt.Fprintf(w, "\n## %s: %s\n\n- Cause: %s\n- Fix: %s\n",
+			errorCode.Code, errorCode.Title, errorCode.Cause, errorCode.Fix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2019 LitmusChaos Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestBuiltinErrorCodes(t *testing.T) {
+	codes := []Code{
+		CodeValidationFailed,
+		CodeValidationInconclusive,
+		CodeApplicationNotFound,
+		CodeInvalidAppLabel,
+		CodeUnsupportedAppKind,
+		CodeAppLabelNotInPodTemplate,
+		CodeNamespaceNotFound,
+		CodeChaosExperimentNotFound,
+		CodeConfigMapNotFound,
+		CodeSecretNotFound,
+		CodeProtectedComponent,
+		CodeProtectedSecret,
+		CodeProtectedResource,
+		CodeResourceInUse,
+	}
+	for _, code := range codes {
+		errorCode, ok := LookupErrorCode(code)
+		if !ok {
+			t.Fatalf("expected code %s to be in the catalog", code)
+		}
+		if errorCode.Title == "" || errorCode.Cause == "" || errorCode.Fix == "" {
+			t.Fatalf("expected code %s to have a title, a cause and a fix, got %+v", code, errorCode)
+		}
+	}
+}
+
+func TestRegisterErrorCode(t *testing.T) {
+	if err := RegisterErrorCode(ErrorCode{Code: CodeApplicationNotFound}); err == nil {
+		t.Fatalf("expected registering a duplicate code to fail")
+	}
+	if err := RegisterErrorCode(ErrorCode{Code: "TARGET-1"}); err == nil {
+		t.Fatalf("expected registering a malformed code to fail")
+	}
+}
+
+func TestErrorCodesDocIsGenerated(t *testing.T) {
+	doc, err := ioutil.ReadFile("../../docs/error-codes.md")
+	if err != nil {
+		t.Fatalf("failed to read the error code catalog: %v", err)
+	}
+	var catalog bytes.Buffer
+	if err := WriteErrorCodes(&catalog); err != nil {
+		t.Fatalf("failed to write the error code catalog: %v", err)
+	}
+	if !bytes.Equal(doc, catalog.Bytes()) {
+		t.Fatalf("docs/error-codes.md is out of date, run make error-codes")
+	}
+}
@@ -17,8 +17,10 @@ limitations under the License.
 package webhook
 
 import (
+	"bytes"
 	"fmt"
 	"os"
+	"reflect"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -39,17 +41,26 @@ const (
 	validatorWebhook     = "litmuschaos-validation-webhook-cfg"
 	validatorSecret      = "admission-controller-secret"
 	webhookHandlerName   = "admission-controller.litmuschaos.io"
-	validationPath       = "/validate"
-	validationPort       = 8443
-	webhookLabel         = "litmuschaos.io/component-name" + "=" + "admission-controller"
-	webhooksvcLabel      = "litmuschaos.io/component-name" + "=" + "admission-controller-svc"
+	// protectionHandlerName is the webhook guarding our own resources
+	protectionHandlerName = "protection.admission-controller.litmuschaos.io"
+	// referencesHandlerName is the webhook guarding resources used by ChaosEngines
+	referencesHandlerName = "references.admission-controller.litmuschaos.io"
+	validationPath        = "/validate"
+	validationPort        = 8443
+	webhookLabel          = "litmuschaos.io/component-name" + "=" + "admission-controller"
+	webhooksvcLabel       = "litmuschaos.io/component-name" + "=" + "admission-controller-svc"
 	// AdmissionNameEnvVar is the constant for env variable ADMISSION_WEBHOOK_NAME
 	// which is the name of the current admission webhook
 	AdmissionNameEnvVar = "ADMISSION_WEBHOOK_NAME"
 	appCrt              = "app.crt"
 	appKey              = "app.pem"
 	rootCrt             = "ca.crt"
+	rootKey             = "ca.key"
 	litmuschaosVersion  = "litmuschaos.io/version"
+	// previousRootCrt is the CA replaced by rootCrt, trusted until the
+	// previousCAExpiryAnnotation of the Secret
+	previousRootCrt            = "previous-ca.crt"
+	previousCAExpiryAnnotation = "litmuschaos.io/previous-ca-expiry"
 )
 
 type transformSvcFunc func(*corev1.Service)
@@ -64,6 +75,10 @@ var (
 	five = int32(5)
 	// Ignore means that an error calling the webhook is ignored.
 	Ignore = v1beta1.Ignore
+	// protectionFailurePolicy is the failure policy of the protection
+	// webhook. Fail denies the updates of the Secret and Service while the
+	// admission server is down, including its own ones at startup.
+	protectionFailurePolicy = v1beta1.Ignore
 	// transformation function lists to upgrade webhook resources
 	transformSecret = []transformSecretFunc{}
 	transformSvc    = []transformSvcFunc{}
@@ -96,8 +111,19 @@ func createWebhookService(
 	}
 
 	// create service resource that refers to admission server pod
+	svcObj := newWebhookService(serviceName, namespace)
+	svcObj.OwnerReferences = []metav1.OwnerReference{ownerReference}
+	Logger(SubsystemBootstrap).Info("Creating webhook Service", "namespace", namespace, "name", serviceName)
+	_, err = kubeClient.CoreV1().Services(namespace).
+		Create(svcObj)
+	return err
+}
+
+// newWebhookService returns the Service in front of the admission server
+// pods
+func newWebhookService(serviceName string, namespace string) *corev1.Service {
 	serviceLabels := map[string]string{"app": "admission-controller"}
-	svcObj := &corev1.Service{
+	return &corev1.Service{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Service",
 			APIVersion: "v1",
@@ -110,7 +136,6 @@ func createWebhookService(
 				"litmuschaos.io/component-name": "admission-controller-svc",
 				string(litmuschaosVersion):      version.Current(),
 			},
-			OwnerReferences: []metav1.OwnerReference{ownerReference},
 		},
 		Spec: corev1.ServiceSpec{
 			Selector: serviceLabels,
@@ -123,13 +148,10 @@ func createWebhookService(
 			},
 		},
 	}
-	_, err = kubeClient.CoreV1().Services(namespace).
-		Create(svcObj)
-	return err
 }
 
 // createAdmissionService creates our ValidatingWebhookConfiguration resource
-// if it does not exist.
+// if it does not exist, else registers the webhooks missing from it.
 func createAdmissionService(
 	ownerReference metav1.OwnerReference,
 	validatorWebhook string,
@@ -139,10 +161,13 @@ func createAdmissionService(
 	kubeClient kubernetes.Interface,
 ) error {
 
-	_, err := GetValidatorWebhook(validatorWebhook, kubeClient)
-	// validator object already present, no need to do anything
+	webhookHandlers := getWebhookHandlers(namespace, serviceName, signingCert)
+
+	existing, err := GetValidatorWebhook(validatorWebhook, kubeClient)
+	// validator object already present, register handlers missing from it and
+	// bring its caBundle in sync with the Secret
 	if err == nil {
-		return nil
+		return reconcileHandlers(existing, webhookHandlers, signingCert, kubeClient)
 	}
 
 	// error other than 'not found', return err
@@ -154,11 +179,55 @@ func createAdmissionService(
 		)
 	}
 
+	validator := newValidatorWebhook(validatorWebhook, webhookHandlers)
+	validator.OwnerReferences = []metav1.OwnerReference{ownerReference}
+
+	Logger(SubsystemBootstrap).Info("Creating ValidatingWebhookConfiguration", "name", validatorWebhook)
+	_, err = kubeClient.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().Create(validator)
+
+	return err
+}
+
+// newValidatorWebhook returns the ValidatingWebhookConfiguration registering
+// the given webhooks
+func newValidatorWebhook(validatorWebhook string, webhookHandlers []v1beta1.ValidatingWebhook) *v1beta1.ValidatingWebhookConfiguration {
+	return &v1beta1.ValidatingWebhookConfiguration{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ValidatingWebhookConfiguration",
+			APIVersion: "admissionregistration.k8s.io/v1beta1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: validatorWebhook,
+			Labels: map[string]string{
+				"app":                           "admission-controller",
+				"litmuschaos.io/component-name": "admission-controller",
+				string(litmuschaosVersion):      version.Current(),
+			},
+		},
+		Webhooks: webhookHandlers,
+	}
+}
+
+// getWebhookHandlers returns the webhooks registered by the admission server,
+// all of them served by the given service.
+func getWebhookHandlers(namespace string, serviceName string, signingCert []byte) []v1beta1.ValidatingWebhook {
+	clientConfig := v1beta1.WebhookClientConfig{
+		Service: &v1beta1.ServiceReference{
+			Namespace: namespace,
+			Name:      serviceName,
+			Path:      StrPtr(validationPath),
+		},
+		CABundle: signingCert,
+	}
+
+	// Updates are validated as well, otherwise an engine created with a
+	// harmless target could be retargeted at the litmus control plane
 	webhookHandler := v1beta1.ValidatingWebhook{
 		Name: webhookHandlerName,
 		Rules: []v1beta1.RuleWithOperations{{
 			Operations: []v1beta1.OperationType{
 				v1beta1.Create,
+				v1beta1.Update,
 			},
 			Rule: v1beta1.Rule{
 				APIGroups:   []string{"litmuschaos.io"},
@@ -167,40 +236,198 @@ func createAdmissionService(
 			},
 		},
 		},
-		ClientConfig: v1beta1.WebhookClientConfig{
-			Service: &v1beta1.ServiceReference{
-				Namespace: namespace,
-				Name:      serviceName,
-				Path:      StrPtr(validationPath),
-			},
-			CABundle: signingCert,
-		},
+		ClientConfig:   clientConfig,
 		TimeoutSeconds: &five,
 		FailurePolicy:  &Ignore,
 	}
 
-	validator := &v1beta1.ValidatingWebhookConfiguration{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "validatingWebhookConfiguration",
-			APIVersion: "admissionregistration.k8s.io/v1beta1",
+	// The protection webhook guards the Secret and Service of the admission
+	// server. Kubernetes never calls webhooks for webhook configurations, so
+	// the configuration itself is restored by InitValidationServer instead.
+	protectionPolicy := protectionFailurePolicy
+	protectionHandler := v1beta1.ValidatingWebhook{
+		Name: protectionHandlerName,
+		Rules: []v1beta1.RuleWithOperations{{
+			Operations: []v1beta1.OperationType{
+				v1beta1.Update,
+				v1beta1.Delete,
+			},
+			Rule: v1beta1.Rule{
+				APIGroups:   []string{""},
+				APIVersions: []string{"v1"},
+				Resources:   []string{"secrets", "services"},
+			},
 		},
-		ObjectMeta: metav1.ObjectMeta{
-			Name: validatorWebhook,
-			Labels: map[string]string{
-				"app":                           "admission-controller",
-				"litmuschaos.io/component-name": "admission-controller",
-				string(litmuschaosVersion):      version.Current(),
+		},
+		ObjectSelector: &metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{{
+				Key:      "litmuschaos.io/component-name",
+				Operator: metav1.LabelSelectorOpIn,
+				Values:   []string{"admission-controller", "admission-controller-svc"},
+			}},
+		},
+		ClientConfig:   clientConfig,
+		TimeoutSeconds: &five,
+		FailurePolicy:  &protectionPolicy,
+	}
+
+	// The references webhook keeps the resources used by active ChaosEngines
+	referencesHandler := v1beta1.ValidatingWebhook{
+		Name: referencesHandlerName,
+		Rules: []v1beta1.RuleWithOperations{{
+			Operations: []v1beta1.OperationType{
+				v1beta1.Delete,
+			},
+			Rule: v1beta1.Rule{
+				APIGroups:   []string{""},
+				APIVersions: []string{"v1"},
+				Resources:   []string{"configmaps", "secrets"},
+			},
+		}, {
+			Operations: []v1beta1.OperationType{
+				v1beta1.Delete,
+			},
+			Rule: v1beta1.Rule{
+				APIGroups:   []string{"litmuschaos.io"},
+				APIVersions: []string{"*"},
+				Resources:   []string{"chaosexperiments"},
 			},
-			OwnerReferences: []metav1.OwnerReference{ownerReference},
 		},
-		Webhooks: []v1beta1.ValidatingWebhook{webhookHandler},
+		},
+		ClientConfig:   clientConfig,
+		TimeoutSeconds: &five,
+		FailurePolicy:  &Ignore,
 	}
 
-	_, err = kubeClient.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().Create(validator)
+	return []v1beta1.ValidatingWebhook{webhookHandler, protectionHandler, referencesHandler}
+}
 
+// getURLWebhookHandlers returns the webhooks registered by the admission
+// server, all of them served at the given URL instead of a Service, i.e. by a
+// server running outside of the cluster.
+func getURLWebhookHandlers(url string, signingCert []byte) []v1beta1.ValidatingWebhook {
+	webhookHandlers := getWebhookHandlers("", "", signingCert)
+	for i := range webhookHandlers {
+		webhookHandlers[i].ClientConfig = v1beta1.WebhookClientConfig{
+			URL:      StrPtr(url),
+			CABundle: signingCert,
+		}
+	}
+	return webhookHandlers
+}
+
+// SetProtectionFailurePolicy sets the failure policy of the protection webhook
+// registered from now on, either Ignore or Fail
+func SetProtectionFailurePolicy(policy string) error {
+	failurePolicy, err := parseFailurePolicy(policy)
+	if err != nil {
+		return err
+	}
+	protectionFailurePolicy = failurePolicy
+	return nil
+}
+
+// parseFailurePolicy returns the failure policy with the given name
+func parseFailurePolicy(policy string) (v1beta1.FailurePolicyType, error) {
+	switch p := v1beta1.FailurePolicyType(policy); p {
+	case v1beta1.Ignore, v1beta1.Fail:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown failure policy %s, expected %s or %s", policy, v1beta1.Ignore, v1beta1.Fail)
+}
+
+// reconcileHandlers registers the webhooks missing from the given
+// configuration, adds the operations missing from the rules of the registered
+// ones, sets the failure policy of the protection webhook, and sets the
+// caBundle of all of them. A nil caBundle is left to the cert-manager CA
+// injector.
+func reconcileHandlers(
+	config *v1beta1.ValidatingWebhookConfiguration,
+	webhookHandlers []v1beta1.ValidatingWebhook,
+	caBundle []byte,
+	kubeClient kubernetes.Interface,
+) error {
+
+	newConfig := config.DeepCopy()
+	registered := map[string]*v1beta1.ValidatingWebhook{}
+	for i := range newConfig.Webhooks {
+		registered[newConfig.Webhooks[i].Name] = &newConfig.Webhooks[i]
+	}
+
+	var added []v1beta1.ValidatingWebhook
+	outdatedRules, outdatedPolicies := 0, 0
+	for _, handler := range webhookHandlers {
+		existing, ok := registered[handler.Name]
+		if !ok {
+			added = append(added, handler)
+			continue
+		}
+		outdatedRules += addMissingOperations(existing, handler)
+		// the failure policies of the other webhooks are left to the user
+		if handler.Name == protectionHandlerName && !reflect.DeepEqual(existing.FailurePolicy, handler.FailurePolicy) {
+			existing.FailurePolicy = handler.FailurePolicy
+			outdatedPolicies++
+		}
+	}
+	newConfig.Webhooks = append(newConfig.Webhooks, added...)
+	outdated := 0
+	if caBundle != nil {
+		outdated = setCABundle(newConfig, caBundle)
+	}
+	if len(added) == 0 && outdatedRules == 0 && outdatedPolicies == 0 && outdated == 0 {
+		return nil
+	}
+	Logger(SubsystemBootstrap).Info("Reconciling webhooks", "name", config.Name,
+		"missing", len(added), "outdatedRules", outdatedRules,
+		"outdatedFailurePolicies", outdatedPolicies, "outdatedCABundles", outdated)
+
+	_, err := kubeClient.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().Update(newConfig)
 	return err
 }
 
+// addMissingOperations adds to the rules of the registered webhook the
+// operations of the same rules of the expected one, and returns how many
+// rules lacked some. Operations added by hand are kept.
+func addMissingOperations(registered *v1beta1.ValidatingWebhook, expected v1beta1.ValidatingWebhook) int {
+	outdated := 0
+	for _, expectedRule := range expected.Rules {
+		for i := range registered.Rules {
+			rule := &registered.Rules[i]
+			if !reflect.DeepEqual(rule.APIGroups, expectedRule.APIGroups) || !reflect.DeepEqual(rule.Resources, expectedRule.Resources) {
+				continue
+			}
+			operations := map[v1beta1.OperationType]bool{}
+			for _, operation := range rule.Operations {
+				operations[operation] = true
+			}
+			missing := false
+			for _, operation := range expectedRule.Operations {
+				if !operations[operation] && !operations[v1beta1.OperationAll] {
+					rule.Operations = append(rule.Operations, operation)
+					missing = true
+				}
+			}
+			if missing {
+				outdated++
+			}
+		}
+	}
+	return outdated
+}
+
+// setCABundle sets the caBundle of the webhooks of the given configuration
+// and returns how many of them held another one
+func setCABundle(config *v1beta1.ValidatingWebhookConfiguration, caBundle []byte) int {
+	outdated := 0
+	for i := range config.Webhooks {
+		if !bytes.Equal(config.Webhooks[i].ClientConfig.CABundle, caBundle) {
+			config.Webhooks[i].ClientConfig.CABundle = caBundle
+			outdated++
+		}
+	}
+	return outdated
+}
+
 // createCertsSecret creates a self-signed certificate and stores it as a
 // secret resource in Kubernetes.
 func createCertsSecret(
@@ -210,6 +437,17 @@ func createCertsSecret(
 	namespace string,
 	kubeClient kubernetes.Interface,
 ) (*corev1.Secret, error) {
+	secretObj, err := newCertsSecret(secretName, serviceName, namespace)
+	if err != nil {
+		return nil, err
+	}
+	secretObj.OwnerReferences = []metav1.OwnerReference{ownerReference}
+	return kubeClient.CoreV1().Secrets(namespace).Create(secretObj)
+}
+
+// newCertsSecret returns a Secret holding a new self-signed CA and a serving
+// certificate for the given service signed by it
+func newCertsSecret(secretName string, serviceName string, namespace string) (*corev1.Secret, error) {
 	// Create a signing certificate
 	caKeyPair, err := NewCA(fmt.Sprintf("%s-ca", serviceName))
 	if err != nil {
@@ -217,22 +455,33 @@ func createCertsSecret(
 	}
 
 	// Create app certs signed through the certificate created above
-	apiServerKeyPair, err := NewServerKeyPair(
-		caKeyPair,
-		strings.Join([]string{serviceName, namespace, "svc"}, "."),
-		serviceName,
-		namespace,
-		"cluster.local",
-		[]string{},
-		[]string{},
-	)
+	apiServerKeyPair, err := newServiceKeyPair(caKeyPair, serviceName, namespace)
+	if err != nil {
+		return nil, err
+	}
 
+	appCrtBytes, appKeyBytes, err := apiServerKeyPair.encodePEM()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create server key pair: %v", err)
+		return nil, err
+	}
+	rootCrtBytes, rootKeyBytes, err := caKeyPair.encodePEM()
+	if err != nil {
+		return nil, err
 	}
 
 	// create an opaque secret resource with certificate(s) created above
-	secretObj := &corev1.Secret{
+	return newSecret(secretName, namespace, map[string][]byte{
+		appCrt:  appCrtBytes,
+		appKey:  appKeyBytes,
+		rootCrt: rootCrtBytes,
+		rootKey: rootKeyBytes,
+	}), nil
+}
+
+// newSecret returns the Secret of the admission server holding the given
+// certificates
+func newSecret(secretName string, namespace string, data map[string][]byte) *corev1.Secret {
+	return &corev1.Secret{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Secret",
 			APIVersion: "v1",
@@ -245,16 +494,28 @@ func createCertsSecret(
 				"litmuschaos.io/component-name": "admission-controller",
 				string(litmuschaosVersion):      version.Current(),
 			},
-			OwnerReferences: []metav1.OwnerReference{ownerReference},
 		},
 		Type: corev1.SecretTypeOpaque,
-		Data: map[string][]byte{
-			appCrt:  EncodeCertPEM(apiServerKeyPair.Cert),
-			appKey:  EncodePrivateKeyPEM(apiServerKeyPair.Key),
-			rootCrt: EncodeCertPEM(caKeyPair.Cert),
-		},
+		Data: data,
 	}
-	return kubeClient.CoreV1().Secrets(namespace).Create(secretObj)
+}
+
+// newServiceKeyPair returns a serving certificate for the given service
+// signed by the given CA
+func newServiceKeyPair(caKeyPair *KeyPair, serviceName string, namespace string) (*KeyPair, error) {
+	keyPair, err := NewServerKeyPair(
+		caKeyPair,
+		strings.Join([]string{serviceName, namespace, "svc"}, "."),
+		serviceName,
+		namespace,
+		"cluster.local",
+		[]string{},
+		[]string{},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create server key pair: %v", err)
+	}
+	return keyPair, nil
 }
 
 // GetValidatorWebhook fetches the webhook validator resource
@@ -292,6 +553,7 @@ func InitValidationServer(ownerReference metav1.OwnerReference, kubeClient kuber
 	if err != nil {
 		if k8serror.IsNotFound(err) {
 			// Secret not found, create certs and the secret object
+			Logger(SubsystemTLS).Info("Creating self-signed certificates", "namespace", litmusNamespace, "secret", validatorSecret)
 			certSecret, err = createCertsSecret(
 				ownerReference,
 				validatorSecret,
@@ -324,6 +586,8 @@ func InitValidationServer(ownerReference metav1.OwnerReference, kubeClient kuber
 			validatorSecret,
 		)
 	}
+	// the previous CA is trusted as well while it is rotated
+	signingCertBytes = secretCABundle(certSecret)
 
 	serviceErr := createWebhookService(
 		ownerReference,
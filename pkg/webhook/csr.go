@@ -0,0 +1,373 @@
+/*
+Copyright 2019 The LitmusChaos Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	k8serror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	certutil "k8s.io/client-go/util/cert"
+)
+
+// csrPollInterval is the interval at which a CertificateSigningRequest is
+// checked for its certificate
+var csrPollInterval = 2 * time.Second
+
+// CSROptions configures the serving certificate issued by the signer of the
+// cluster through a certificates.k8s.io/v1beta1 CertificateSigningRequest,
+// instead of a self-signed one. The request has no signer name, so it goes to
+// the kubernetes.io/legacy-unknown signer, which the clusters serving the
+// v1beta1 API only, Kubernetes 1.21 and older, have.
+type CSROptions struct {
+	// Enabled requests the serving certificate of the Secret from the signer
+	// of the cluster
+	Enabled bool
+	// AutoApprove approves the CertificateSigningRequest if the admission
+	// server is authorized to, otherwise it waits for its approval
+	AutoApprove bool
+	// CAFile holds the CA of the signer, i.e. the cluster CA mounted along
+	// with the service account token
+	CAFile string
+	// ApprovalTimeout is how long the certificate of a
+	// CertificateSigningRequest is waited for
+	ApprovalTimeout time.Duration
+}
+
+// csrIssuer issues the serving certificates of the Secret through
+// CertificateSigningRequests
+type csrIssuer struct {
+	opts       CSROptions
+	kubeClient kubernetes.Interface
+}
+
+const (
+	// csrSigner is the signer of the CertificateSigningRequests without a
+	// signer name
+	csrSigner = "kubernetes.io/legacy-unknown"
+	// csrServiceLabel and csrNamespaceLabel label the
+	// CertificateSigningRequests with the service they are created for
+	csrServiceLabel   = "litmuschaos.io/service-name"
+	csrNamespaceLabel = "litmuschaos.io/service-namespace"
+)
+
+// csrGenerateName returns the prefix of the names of the
+// CertificateSigningRequests of the given service, cluster scoped. Every
+// attempt has a name of its own, so that the replicas don't replace the
+// requests of each other.
+func csrGenerateName(serviceName string, namespace string) string {
+	return fmt.Sprintf("%s.%s-", serviceName, namespace)
+}
+
+// csrLabels returns the labels of the CertificateSigningRequests of the given
+// service
+func csrLabels(serviceName string, namespace string) map[string]string {
+	return map[string]string{
+		"app":                           "admission-controller",
+		"litmuschaos.io/component-name": "admission-controller",
+		csrServiceLabel:                 serviceName,
+		csrNamespaceLabel:               namespace,
+	}
+}
+
+// issue requests a serving certificate for the given service from the signer
+// of the cluster and returns it along with its key, once issued
+func (c *csrIssuer) issue(serviceName string, namespace string) (certBytes, keyBytes []byte, err error) {
+	key, err := newPrivateKey()
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create a server private key: %v", err)
+	}
+	request, err := certutil.MakeCSR(key,
+		&pkix.Name{CommonName: fmt.Sprintf("%s.%s.svc", serviceName, namespace)},
+		serviceDNSNames(serviceName, namespace, "cluster.local"), nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create certificate request: %v", err)
+	}
+	usages := []certificatesv1beta1.KeyUsage{certificatesv1beta1.UsageDigitalSignature, certificatesv1beta1.UsageServerAuth}
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		usages = append(usages, certificatesv1beta1.UsageKeyEncipherment)
+	}
+
+	labels := csrLabels(serviceName, namespace)
+	c.deleteStaleRequests(labels)
+	csrClient := c.kubeClient.CertificatesV1beta1().CertificateSigningRequests()
+	csr, err := csrClient.Create(&certificatesv1beta1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: csrGenerateName(serviceName, namespace),
+			Labels:       labels,
+		},
+		Spec: certificatesv1beta1.CertificateSigningRequestSpec{
+			Request: request,
+			Usages:  usages,
+		},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create certificatesigningrequest(%s) object %v", csrGenerateName(serviceName, namespace), err)
+	}
+	name := csr.Name
+	Logger(SubsystemTLS).Info("Requested serving certificate", "certificateSigningRequest", name,
+		"dnsNames", serviceDNSNames(serviceName, namespace, "cluster.local"))
+	// the request is of no use once this attempt ends, its key is lost
+	defer func() {
+		err := csrClient.Delete(name, &metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &csr.UID}})
+		if err != nil && !k8serror.IsNotFound(err) {
+			Logger(SubsystemTLS).Error(err, "Failed to delete certificatesigningrequest", "certificateSigningRequest", name)
+		}
+	}()
+
+	if c.opts.AutoApprove {
+		if err := c.approve(csr); err != nil {
+			if !k8serror.IsForbidden(err) {
+				return nil, nil, fmt.Errorf("failed to approve certificatesigningrequest(%s) object %v", name, err)
+			}
+			Logger(SubsystemTLS).Info("Not authorized to approve, waiting for the approval", "certificateSigningRequest", name)
+		}
+	}
+	if certBytes, err = c.waitForCertificate(name); err != nil {
+		return nil, nil, err
+	}
+	keyBytes, err = EncodePrivateKeyPEM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return certBytes, keyBytes, nil
+}
+
+// deleteStaleRequests deletes the CertificateSigningRequests with the given
+// labels left by previous attempts, i.e. of a restarted replica. Only the
+// ones older than the approval timeout are deleted, the others may still be
+// waited for by another replica.
+func (c *csrIssuer) deleteStaleRequests(labels map[string]string) {
+	if c.opts.ApprovalTimeout <= 0 {
+		// the requests are waited for until they are approved
+		return
+	}
+	csrClient := c.kubeClient.CertificatesV1beta1().CertificateSigningRequests()
+	list, err := csrClient.List(metav1.ListOptions{LabelSelector: metav1.FormatLabelSelector(&metav1.LabelSelector{MatchLabels: labels})})
+	if err != nil {
+		Logger(SubsystemTLS).Error(err, "Failed to list certificatesigningrequests")
+		return
+	}
+	for i := range list.Items {
+		csr := &list.Items[i]
+		if time.Since(csr.CreationTimestamp.Time) < c.opts.ApprovalTimeout {
+			continue
+		}
+		err := csrClient.Delete(csr.Name, &metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &csr.UID}})
+		if err != nil && !k8serror.IsNotFound(err) && !k8serror.IsConflict(err) {
+			Logger(SubsystemTLS).Error(err, "Failed to delete stale certificatesigningrequest", "certificateSigningRequest", csr.Name)
+			continue
+		}
+		Logger(SubsystemTLS).Info("Deleted stale certificatesigningrequest", "certificateSigningRequest", csr.Name)
+	}
+}
+
+// approve approves the given CertificateSigningRequest
+func (c *csrIssuer) approve(csr *certificatesv1beta1.CertificateSigningRequest) error {
+	approved := csr.DeepCopy()
+	approved.Status.Conditions = append(approved.Status.Conditions, certificatesv1beta1.CertificateSigningRequestCondition{
+		Type:           certificatesv1beta1.CertificateApproved,
+		Reason:         "AutoApproved",
+		Message:        "Serving certificate of the litmus admission controller",
+		LastUpdateTime: metav1.Now(),
+	})
+	if _, err := c.kubeClient.CertificatesV1beta1().CertificateSigningRequests().UpdateApproval(approved); err != nil {
+		return err
+	}
+	Logger(SubsystemTLS).Info("Approved certificatesigningrequest", "certificateSigningRequest", csr.Name)
+	return nil
+}
+
+// waitForCertificate returns the certificate issued to the
+// CertificateSigningRequest of the given name, once approved and signed
+func (c *csrIssuer) waitForCertificate(name string) ([]byte, error) {
+	var certBytes []byte
+	err := wait.PollImmediate(csrPollInterval, c.opts.ApprovalTimeout, func() (bool, error) {
+		csr, err := c.kubeClient.CertificatesV1beta1().CertificateSigningRequests().Get(name, metav1.GetOptions{})
+		if err != nil {
+			return false, fmt.Errorf("failed to read certificatesigningrequest(%s) object %v", name, err)
+		}
+		for _, condition := range csr.Status.Conditions {
+			if condition.Type == certificatesv1beta1.CertificateDenied {
+				return false, fmt.Errorf("certificatesigningrequest(%s) was denied: %s %s", name, condition.Reason, condition.Message)
+			}
+		}
+		certBytes = csr.Status.Certificate
+		return len(certBytes) > 0, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return nil, fmt.Errorf("certificatesigningrequest(%s) wasn't approved and signed within %v", name, c.opts.ApprovalTimeout)
+	}
+	return certBytes, err
+}
+
+// renewSecret returns a copy of the given Secret holding the CA of the signer
+// and a serving certificate it issued, or nil if neither is due. A certificate
+// is requested when the one of the Secret expires within the renewal time of
+// the policy or isn't signed by the CA, i.e. a self-signed one. A replaced CA
+// is kept in the Secret, and so in the caBundle, for the grace period.
+func (c *csrIssuer) renewSecret(secret *corev1.Secret, serviceName string, namespace string, policy rotationPolicy) (*corev1.Secret, error) {
+	signingCertBytes, err := ioutil.ReadFile(c.opts.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %v", err)
+	}
+	renewed := secret.DeepCopy()
+	if renewed.Data == nil {
+		renewed.Data = map[string][]byte{}
+	}
+	if renewed.Annotations == nil {
+		renewed.Annotations = map[string]string{}
+	}
+	changed := dropPreviousCA(renewed)
+
+	if !bytes.Equal(renewed.Data[rootCrt], signingCertBytes) {
+		Logger(SubsystemTLS).Info("Storing the CA of the signer", "secret", secret.Name, "file", c.opts.CAFile)
+		if previous, ok := secret.Data[rootCrt]; ok {
+			keepPreviousCA(renewed, previous, policy.caGracePeriod)
+		}
+		renewed.Data[rootCrt] = signingCertBytes
+		// the CA isn't self-signed anymore
+		delete(renewed.Data, rootKey)
+		changed = true
+	}
+
+	if reason := csrRenewalReason(renewed.Data[appCrt], signingCertBytes, policy.certRenewBefore); reason != "" {
+		Logger(SubsystemTLS).Info("Requesting a serving certificate from the signer", "secret", secret.Name, "reason", reason)
+		if renewed.Data[appCrt], renewed.Data[appKey], err = c.issue(serviceName, namespace); err != nil {
+			return nil, err
+		}
+		changed = true
+	}
+	if !changed {
+		return nil, nil
+	}
+	return renewed, nil
+}
+
+// csrRenewalReason tells why the given serving certificate must be requested
+// again from the signer of the given CA, empty if it needn't
+func csrRenewalReason(certBytes []byte, signingCertBytes []byte, renewBefore time.Duration) string {
+	certs, err := certutil.ParseCertsPEM(certBytes)
+	if err != nil {
+		return err.Error()
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(signingCertBytes) {
+		return "no certificate found in the CA file"
+	}
+	if _, err := certs[0].Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}); err != nil {
+		return fmt.Sprintf("certificate isn't issued by the signer: %v", err)
+	}
+	if notAfter := certs[0].NotAfter; time.Until(notAfter) < renewBefore {
+		return fmt.Sprintf("certificate expires at %v", notAfter)
+	}
+	if !keyOptions.matches(certs[0].PublicKey) {
+		return fmt.Sprintf("key isn't %v", keyOptions)
+	}
+	return ""
+}
+
+// InitCSRServer creates the Secret, the Service and the
+// ValidatingWebhookConfiguration of an admission server serving a certificate
+// issued by the signer of the cluster. The Secret holds the CA of the signer,
+// set in the caBundle of the webhooks, and no CA key. The CA of an existing
+// Secret, i.e. self-signed, stays in the caBundle for caGracePeriod.
+func InitCSRServer(ownerReference metav1.OwnerReference, opts CSROptions, caGracePeriod time.Duration, kubeClient kubernetes.Interface) error {
+
+	litmusNamespace, err := getLitmusNamespace()
+	if err != nil {
+		return err
+	}
+
+	err = preUpgrade(litmusNamespace, kubeClient)
+	if err != nil {
+		return err
+	}
+
+	issuer := &csrIssuer{opts: opts, kubeClient: kubeClient}
+	secrets := kubeClient.CoreV1().Secrets(litmusNamespace)
+	certSecret, err := GetSecret(litmusNamespace, validatorSecret, kubeClient)
+	if err != nil && !k8serror.IsNotFound(err) {
+		return fmt.Errorf(
+			"unable to read secret object %s: %v",
+			validatorSecret,
+			err,
+		)
+	}
+	if k8serror.IsNotFound(err) {
+		secret := newSecret(validatorSecret, litmusNamespace, nil)
+		secret.OwnerReferences = []metav1.OwnerReference{ownerReference}
+		renewed, err := issuer.renewSecret(secret, validatorServiceName, litmusNamespace, rotationPolicy{})
+		if err != nil {
+			return err
+		}
+		if certSecret, err = secrets.Create(renewed); err != nil {
+			return fmt.Errorf("failed to create secret(%s) resource %v", validatorSecret, err)
+		}
+	} else {
+		renewed, err := issuer.renewSecret(certSecret, validatorServiceName, litmusNamespace, rotationPolicy{caGracePeriod: caGracePeriod})
+		if err != nil {
+			return err
+		}
+		if renewed != nil {
+			if certSecret, err = secrets.Update(renewed); err != nil {
+				return fmt.Errorf("failed to update secret(%s) object %v", validatorSecret, err)
+			}
+		}
+	}
+
+	serviceErr := createWebhookService(
+		ownerReference,
+		validatorServiceName,
+		litmusNamespace,
+		kubeClient,
+	)
+	if serviceErr != nil {
+		return fmt.Errorf(
+			"failed to create Service{%s}: %v",
+			validatorServiceName,
+			serviceErr,
+		)
+	}
+
+	validatorErr := createAdmissionService(
+		ownerReference,
+		validatorWebhook,
+		litmusNamespace,
+		validatorServiceName,
+		secretCABundle(certSecret),
+		kubeClient,
+	)
+	if validatorErr != nil {
+		return fmt.Errorf(
+			"failed to create validator{%s}: %v",
+			validatorWebhook,
+			validatorErr,
+		)
+	}
+	return nil
+}
@@ -0,0 +1,319 @@
+/*
+Copyright 2019 LitmusChaos Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	cryptorand "crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	fakelitmus "github.com/litmuschaos/chaos-operator/pkg/client/clientset/versioned/fake"
+	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
+	k8serror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	certutil "k8s.io/client-go/util/cert"
+)
+
+// fakeSigner signs the approved CertificateSigningRequests of the given
+// client with its CA, as the signer of kube-controller-manager does
+type fakeSigner struct {
+	t  *testing.T
+	ca *KeyPair
+}
+
+// sign returns the certificate issued to the given PEM encoded request
+func (s *fakeSigner) sign(request []byte) []byte {
+	block, _ := pem.Decode(request)
+	if block == nil {
+		s.t.Fatalf("failed to decode certificate request")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		s.t.Fatalf("failed to parse certificate request: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      csr.Subject,
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(duration365d),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(cryptorand.Reader, template, s.ca.Cert, csr.PublicKey, s.ca.Key)
+	if err != nil {
+		s.t.Fatalf("failed to sign certificate request: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: CertificateBlockType, Bytes: der})
+}
+
+// signApproved signs the given CertificateSigningRequest if it is approved
+func (s *fakeSigner) signApproved(csr *certificatesv1beta1.CertificateSigningRequest) {
+	for _, condition := range csr.Status.Conditions {
+		if condition.Type == certificatesv1beta1.CertificateApproved {
+			csr.Status.Certificate = s.sign(csr.Spec.Request)
+		}
+	}
+}
+
+// newCSRClient returns a fake client signing the approved
+// CertificateSigningRequests. Their approval is forbidden if forbidApproval
+// is set, and onCreate, if set, is called on the created ones. The created
+// ones are named after their generateName, as the API server does.
+func newCSRClient(signer *fakeSigner, forbidApproval bool, onCreate func(*certificatesv1beta1.CertificateSigningRequest), objects ...runtime.Object) *fake.Clientset {
+	kubeClient := fake.NewSimpleClientset(objects...)
+	generated := 0
+	kubeClient.PrependReactor("update", "certificatesigningrequests", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "approval" {
+			return false, nil, nil
+		}
+		csr := action.(k8stesting.UpdateAction).GetObject().(*certificatesv1beta1.CertificateSigningRequest)
+		if forbidApproval {
+			return true, nil, k8serror.NewForbidden(schema.GroupResource{Group: "certificates.k8s.io", Resource: "certificatesigningrequests"}, csr.Name, nil)
+		}
+		signer.signApproved(csr)
+		return false, nil, nil
+	})
+	kubeClient.PrependReactor("create", "certificatesigningrequests", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		csr := action.(k8stesting.CreateAction).GetObject().(*certificatesv1beta1.CertificateSigningRequest)
+		if csr.Name == "" {
+			generated++
+			csr.Name = fmt.Sprintf("%s%d", csr.GenerateName, generated)
+		}
+		if onCreate != nil {
+			onCreate(csr)
+			signer.signApproved(csr)
+		}
+		return false, nil, nil
+	})
+	return kubeClient
+}
+
+func TestInitCSRServer(t *testing.T) {
+	os.Setenv("LITMUS_NAMESPACE", litmusNamespace)
+	defer os.Unsetenv("LITMUS_NAMESPACE")
+	defer func(interval time.Duration) { csrPollInterval = interval }(csrPollInterval)
+	csrPollInterval = 10 * time.Millisecond
+
+	clusterCA, err := NewCA("kubernetes")
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	if err := ioutil.WriteFile(caFile, EncodeCertPEM(clusterCA.Cert), 0600); err != nil {
+		t.Fatalf("failed to write CA file: %v", err)
+	}
+	selfSigned, err := newCertsSecret(validatorSecret, validatorServiceName, litmusNamespace)
+	if err != nil {
+		t.Fatalf("failed to create secret: %v", err)
+	}
+	signer := &fakeSigner{t: t, ca: clusterCA}
+	condition := func(conditionType certificatesv1beta1.RequestConditionType) func(*certificatesv1beta1.CertificateSigningRequest) {
+		return func(csr *certificatesv1beta1.CertificateSigningRequest) {
+			csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1beta1.CertificateSigningRequestCondition{Type: conditionType})
+		}
+	}
+
+	request := func(name string, created time.Time) *certificatesv1beta1.CertificateSigningRequest {
+		return &certificatesv1beta1.CertificateSigningRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Labels:            csrLabels(validatorServiceName, litmusNamespace),
+				CreationTimestamp: metav1.NewTime(created),
+			},
+		}
+	}
+
+	var tests = []struct {
+		description        string
+		existing           []runtime.Object
+		autoApprove        bool
+		forbidApproval     bool
+		onCreate           func(*certificatesv1beta1.CertificateSigningRequest)
+		expectedPreviousCA []byte
+		expectedRequests   []string
+		approvalTimeout    time.Duration
+		isErrorExpected    bool
+	}{
+		{
+			description: "The certificate is requested, approved and stored with the cluster CA.",
+			autoApprove: true,
+		},
+		{
+			description: "A request approved by someone else is stored as well.",
+			onCreate:    condition(certificatesv1beta1.CertificateApproved),
+		},
+		{
+			description:        "A self-signed certificate is replaced, its CA stays in the caBundle for the grace period.",
+			existing:           []runtime.Object{selfSigned},
+			autoApprove:        true,
+			expectedPreviousCA: selfSigned.Data[rootCrt],
+		},
+		{
+			description: "The stale request of a previous attempt is deleted, the pending one of another replica is kept.",
+			existing: []runtime.Object{
+				request("stale", time.Now().Add(-time.Hour)),
+				request("pending", time.Now()),
+			},
+			autoApprove:      true,
+			expectedRequests: []string{"pending"},
+			approvalTimeout:  time.Minute,
+		},
+		{
+			description:     "Without the authorization to approve, the request waits for its approval.",
+			autoApprove:     true,
+			forbidApproval:  true,
+			isErrorExpected: true,
+		},
+		{
+			description:     "A denied request fails.",
+			onCreate:        condition(certificatesv1beta1.CertificateDenied),
+			isErrorExpected: true,
+		},
+	}
+	for _, test := range tests {
+		kubeClient := newCSRClient(signer, test.forbidApproval, test.onCreate, test.existing...)
+		opts := CSROptions{Enabled: true, AutoApprove: test.autoApprove, CAFile: caFile, ApprovalTimeout: test.approvalTimeout}
+		if opts.ApprovalTimeout == 0 {
+			opts.ApprovalTimeout = 100 * time.Millisecond
+		}
+
+		err := InitCSRServer(metav1.OwnerReference{}, opts, time.Hour, kubeClient)
+		if isError := err != nil; isError != test.isErrorExpected {
+			t.Fatalf("Test %q failed: expected error %v, got %v", test.description, test.isErrorExpected, err)
+		}
+		if err != nil {
+			continue
+		}
+
+		secret, err := GetSecret(litmusNamespace, validatorSecret, kubeClient)
+		if err != nil {
+			t.Fatalf("Test %q failed: %v", test.description, err)
+		}
+		if !bytes.Equal(secret.Data[rootCrt], EncodeCertPEM(clusterCA.Cert)) {
+			t.Fatalf("Test %q failed: expected the cluster CA in the Secret", test.description)
+		}
+		if _, ok := secret.Data[rootKey]; ok {
+			t.Fatalf("Test %q failed: expected no CA key in the Secret", test.description)
+		}
+		if !bytes.Equal(secret.Data[previousRootCrt], test.expectedPreviousCA) {
+			t.Fatalf("Test %q failed: expected previous CA %q, got %q", test.description, test.expectedPreviousCA, secret.Data[previousRootCrt])
+		}
+		if reason := csrRenewalReason(secret.Data[appCrt], secret.Data[rootCrt], 0); reason != "" {
+			t.Fatalf("Test %q failed: expected a certificate issued by the cluster CA: %s", test.description, reason)
+		}
+		certs, err := certutil.ParseCertsPEM(secret.Data[appCrt])
+		if err != nil {
+			t.Fatalf("Test %q failed: %v", test.description, err)
+		}
+		if dnsNames := serviceDNSNames(validatorServiceName, litmusNamespace, "cluster.local"); len(certs[0].DNSNames) != len(dnsNames) {
+			t.Fatalf("Test %q failed: expected the DNS names %v, got %v", test.description, dnsNames, certs[0].DNSNames)
+		}
+		list, err := kubeClient.CertificatesV1beta1().CertificateSigningRequests().List(metav1.ListOptions{})
+		if err != nil {
+			t.Fatalf("Test %q failed: %v", test.description, err)
+		}
+		var requests []string
+		for _, csr := range list.Items {
+			requests = append(requests, csr.Name)
+		}
+		if !reflect.DeepEqual(requests, test.expectedRequests) {
+			t.Fatalf("Test %q failed: expected the certificatesigningrequests %v to be left, got %v", test.description, test.expectedRequests, requests)
+		}
+
+		config, err := GetValidatorWebhook(validatorWebhook, kubeClient)
+		if err != nil {
+			t.Fatalf("Test %q failed: %v", test.description, err)
+		}
+		for _, handler := range config.Webhooks {
+			if !bytes.Equal(handler.ClientConfig.CABundle, secretCABundle(secret)) {
+				t.Fatalf("Test %q failed: expected the caBundle of %s to hold the CAs of the Secret", test.description, handler.Name)
+			}
+		}
+	}
+}
+
+func TestCSRRenewal(t *testing.T) {
+	os.Setenv("LITMUS_NAMESPACE", litmusNamespace)
+	defer os.Unsetenv("LITMUS_NAMESPACE")
+	os.Setenv(ServiceAccountEnvVar, "litmus")
+	defer os.Unsetenv(ServiceAccountEnvVar)
+	defer func(interval time.Duration) { csrPollInterval = interval }(csrPollInterval)
+	csrPollInterval = 10 * time.Millisecond
+
+	clusterCA, err := NewCA("kubernetes")
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	if err := ioutil.WriteFile(caFile, EncodeCertPEM(clusterCA.Cert), 0600); err != nil {
+		t.Fatalf("failed to write CA file: %v", err)
+	}
+	kubeClient := newCSRClient(&fakeSigner{t: t, ca: clusterCA}, false, nil)
+	p := Parameters{CSR: CSROptions{Enabled: true, AutoApprove: true, CAFile: caFile, ApprovalTimeout: time.Second}}
+	if err := InitCSRServer(metav1.OwnerReference{}, p.CSR, time.Hour, kubeClient); err != nil {
+		t.Fatalf("failed to init server: %v", err)
+	}
+	wh, err := New(p, kubeClient, fakelitmus.NewSimpleClientset())
+	if err != nil {
+		t.Fatalf("failed to create webhook: %v", err)
+	}
+	issued := wh.serving().cert
+
+	// nothing is due
+	if err := wh.rotateCertificate(); err != nil {
+		t.Fatalf("failed to rotate certificates: %v", err)
+	}
+	if !bytes.Equal(wh.serving().cert.Raw, issued.Raw) {
+		t.Fatalf("expected the certificate to be kept until it is due")
+	}
+
+	wh.certRenewBefore = 2 * duration365d
+	if err := wh.rotateCertificate(); err != nil {
+		t.Fatalf("failed to rotate certificates: %v", err)
+	}
+	renewed := wh.serving().cert
+	if bytes.Equal(renewed.Raw, issued.Raw) {
+		t.Fatalf("expected the certificate to be requested again")
+	}
+	secret, err := GetSecret(litmusNamespace, validatorSecret, kubeClient)
+	if err != nil {
+		t.Fatalf("failed to read secret: %v", err)
+	}
+	if !bytes.Equal(secret.Data[appCrt], EncodeCertPEM(renewed)) {
+		t.Fatalf("expected the renewed certificate to be stored in the Secret")
+	}
+	if _, ok := secret.Data[rootKey]; ok {
+		t.Fatalf("expected the renewal not to mint a self-signed CA")
+	}
+	if !bytes.Equal(wh.serving().caBundle, EncodeCertPEM(clusterCA.Cert)) {
+		t.Fatalf("expected the cluster CA to be served as the caBundle")
+	}
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2019 The LitmusChaos Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+
+	"k8s.io/api/admissionregistration/v1beta1"
+	k8serror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	litmuschaosv1alpha1 "github.com/litmuschaos/chaos-operator/pkg/client/clientset/versioned"
+)
+
+const (
+	// devValidatorWebhook is the webhook configuration of the development
+	// server, apart from the one of the deployed admission controller
+	devValidatorWebhook = "litmuschaos-validation-webhook-cfg-dev"
+	// devSessionAnnotation identifies the development server which
+	// registered the webhook configuration
+	devSessionAnnotation = "litmuschaos.io/dev-session"
+)
+
+// devSession is the webhook configuration registered by a development server
+type devSession struct {
+	// id is the value of the devSessionAnnotation of the configuration
+	id string
+	// config is the configuration as registered
+	config *v1beta1.ValidatingWebhookConfiguration
+}
+
+// newDev creates a webhook served outside of the cluster, i.e. on the laptop
+// of a developer. It serves a certificate minted for the DevHost host or IP,
+// and registers the webhooks with a URL pointing at it instead of the
+// Service. Nothing is stored in the cluster besides a webhook configuration
+// of its own, which RemoveDevWebhooks deletes.
+func newDev(p Parameters, kubeClient kubernetes.Interface,
+	litmusClient litmuschaosv1alpha1.Interface) (*webhook, error) {
+	host := p.DevHost
+
+	admNamespace, err := getLitmusNamespace()
+	if err != nil {
+		return nil, err
+	}
+
+	// the API server reaches the webhook at host, local clients i.e. curl at
+	// localhost
+	ips := []string{"127.0.0.1"}
+	hostnames := []string{"localhost"}
+	if net.ParseIP(host) != nil {
+		ips = append(ips, host)
+	} else {
+		hostnames = append(hostnames, host)
+	}
+	caKeyPair, err := NewCA(fmt.Sprintf("%s-dev-ca", validatorServiceName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create root-ca: %v", err)
+	}
+	serverKeyPair, err := NewServerKeyPair(caKeyPair, host, validatorServiceName, admNamespace, "cluster.local", ips, hostnames)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create server key pair: %v", err)
+	}
+	signingCertBytes := EncodeCertPEM(caKeyPair.Cert)
+	certBytes, keyBytes, err := serverKeyPair.encodePEM()
+	if err != nil {
+		return nil, err
+	}
+
+	wh, err := newWebhook(p, kubeClient, litmusClient)
+	if err != nil {
+		return nil, err
+	}
+	if err := wh.setServingCertificate(p, certBytes, keyBytes, signingCertBytes); err != nil {
+		return nil, err
+	}
+	// the certificate is minted on every run and stored nowhere to renew
+	wh.certCheckInterval = 0
+	wh.caBundleSyncInterval = 0
+	Logger(SubsystemTLS).Info("Minted development serving certificate", "host", host,
+		"dnsNames", serverKeyPair.Cert.DNSNames, "ips", ips, "notAfter", serverKeyPair.Cert.NotAfter.String())
+
+	id := make([]byte, 8)
+	if _, err := cryptorand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to create development session: %v", err)
+	}
+	session := &devSession{id: hex.EncodeToString(id)}
+	url := fmt.Sprintf("https://%s%s", net.JoinHostPort(host, strconv.Itoa(p.Port)), validationPath)
+	session.config, err = registerURLWebhooks(devValidatorWebhook, session.id, url, signingCertBytes, kubeClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register webhooks at %s: %v", url, err)
+	}
+	wh.webhookConfig = devValidatorWebhook
+	wh.devSession = session
+	return wh, nil
+}
+
+// registerURLWebhooks creates the webhook configuration with webhooks served
+// at the given URL and annotated with the given session, or overwrites the
+// one left by a previous development server. The configuration of a deployed
+// admission controller is never overwritten.
+func registerURLWebhooks(
+	validatorWebhook string,
+	session string,
+	url string,
+	signingCert []byte,
+	kubeClient kubernetes.Interface,
+) (*v1beta1.ValidatingWebhookConfiguration, error) {
+
+	webhookHandlers := getURLWebhookHandlers(url, signingCert)
+	existing, err := GetValidatorWebhook(validatorWebhook, kubeClient)
+	if err != nil {
+		if !k8serror.IsNotFound(err) {
+			return nil, err
+		}
+		config := newValidatorWebhook(validatorWebhook, webhookHandlers)
+		config.Annotations = map[string]string{devSessionAnnotation: session}
+		Logger(SubsystemBootstrap).Info("Creating ValidatingWebhookConfiguration", "name", validatorWebhook, "url", url)
+		return kubeClient.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().Create(config)
+	}
+
+	if _, ok := existing.Annotations[devSessionAnnotation]; !ok || len(existing.OwnerReferences) != 0 {
+		return nil, fmt.Errorf("ValidatingWebhookConfiguration %s isn't registered by a development server, refusing to overwrite it", validatorWebhook)
+	}
+	config := existing.DeepCopy()
+	config.Webhooks = webhookHandlers
+	config.Annotations[devSessionAnnotation] = session
+	Logger(SubsystemBootstrap).Info("Pointing ValidatingWebhookConfiguration of a previous development server at this one", "name", validatorWebhook, "url", url)
+	return kubeClient.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().Update(config)
+}
+
+// RemoveDevWebhooks deletes the webhook configuration registered by newDev,
+// so the cluster doesn't call a server which is gone. A configuration which
+// another development server registered since is left untouched.
+func (wh *webhook) RemoveDevWebhooks() error {
+	if wh.devSession == nil {
+		return nil
+	}
+	name := wh.devSession.config.Name
+	existing, err := GetValidatorWebhook(name, wh.kubeClient)
+	if err != nil {
+		if k8serror.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if existing.UID != wh.devSession.config.UID || existing.Annotations[devSessionAnnotation] != wh.devSession.id {
+		Logger(SubsystemBootstrap).Info("ValidatingWebhookConfiguration was registered by another development server, leaving it", "name", name)
+		return nil
+	}
+	uid := existing.UID
+	err = wh.kubeClient.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().
+		Delete(name, &metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &uid}})
+	if err != nil && !k8serror.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2019 LitmusChaos Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+
+	fakelitmus "github.com/litmuschaos/chaos-operator/pkg/client/clientset/versioned/fake"
+	k8serror "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDevWebhook(t *testing.T) {
+	os.Setenv("LITMUS_NAMESPACE", litmusNamespace)
+	defer os.Unsetenv("LITMUS_NAMESPACE")
+	deployed := newValidatorWebhook(validatorWebhook, getWebhookHandlers(litmusNamespace, validatorServiceName, []byte("deployed")))
+	kubeClient := fake.NewSimpleClientset(deployed)
+	litmusClient := fakelitmus.NewSimpleClientset()
+
+	var tests = []struct {
+		description string
+		host        string
+		expectedURL string
+	}{
+		{
+			description: "The webhooks are registered at the URL of an IP.",
+			host:        "172.17.0.1",
+			expectedURL: "https://172.17.0.1:9443/validate",
+		},
+		{
+			description: "The webhooks of a previous run are pointed at the new host.",
+			host:        "host.docker.internal",
+			expectedURL: "https://host.docker.internal:9443/validate",
+		},
+	}
+	var servers []*webhook
+	for _, test := range tests {
+		wh, err := New(Parameters{Port: 9443, DevHost: test.host}, kubeClient, litmusClient)
+		if err != nil {
+			t.Fatalf("Test %q failed: %v", test.description, err)
+		}
+		servers = append(servers, wh)
+		if err := wh.serving().cert.VerifyHostname(test.host); err != nil {
+			t.Fatalf("Test %q failed: expected a certificate for %s: %v", test.description, test.host, err)
+		}
+		config, err := GetValidatorWebhook(devValidatorWebhook, kubeClient)
+		if err != nil {
+			t.Fatalf("Test %q failed: expected the webhook configuration to be registered: %v", test.description, err)
+		}
+		if len(config.Webhooks) != 3 {
+			t.Fatalf("Test %q failed: expected 3 webhooks, got %d", test.description, len(config.Webhooks))
+		}
+		for _, handler := range config.Webhooks {
+			clientConfig := handler.ClientConfig
+			if clientConfig.Service != nil || clientConfig.URL == nil || *clientConfig.URL != test.expectedURL {
+				t.Fatalf("Test %q failed: expected webhook %s at %s, got %+v", test.description, handler.Name, test.expectedURL, clientConfig)
+			}
+			if !bytes.Equal(clientConfig.CABundle, wh.serving().caBundle) {
+				t.Fatalf("Test %q failed: expected the caBundle of webhook %s to hold the minted CA", test.description, handler.Name)
+			}
+		}
+		existing, err := GetValidatorWebhook(validatorWebhook, kubeClient)
+		if err != nil || !reflect.DeepEqual(existing, deployed) {
+			t.Fatalf("Test %q failed: expected the deployed webhook configuration to be left untouched, got %v", test.description, err)
+		}
+	}
+
+	// the first server was taken over by the second one
+	if err := servers[0].RemoveDevWebhooks(); err != nil {
+		t.Fatalf("failed to remove the webhooks: %v", err)
+	}
+	if _, err := GetValidatorWebhook(devValidatorWebhook, kubeClient); err != nil {
+		t.Fatalf("expected the webhook configuration of another server to be left, got %v", err)
+	}
+	if err := servers[1].RemoveDevWebhooks(); err != nil {
+		t.Fatalf("failed to remove the webhooks: %v", err)
+	}
+	if _, err := GetValidatorWebhook(devValidatorWebhook, kubeClient); !k8serror.IsNotFound(err) {
+		t.Fatalf("expected the webhook configuration to be removed, got %v", err)
+	}
+	if _, err := GetValidatorWebhook(validatorWebhook, kubeClient); err != nil {
+		t.Fatalf("expected the deployed webhook configuration to be kept, got %v", err)
+	}
+}
+
+func TestDevWebhookOwnedByDeployment(t *testing.T) {
+	os.Setenv("LITMUS_NAMESPACE", litmusNamespace)
+	defer os.Unsetenv("LITMUS_NAMESPACE")
+	owned := newValidatorWebhook(devValidatorWebhook, getWebhookHandlers(litmusNamespace, validatorServiceName, nil))
+	kubeClient := fake.NewSimpleClientset(owned)
+
+	if _, err := New(Parameters{Port: 9443, DevHost: "172.17.0.1"}, kubeClient, fakelitmus.NewSimpleClientset()); err == nil {
+		t.Fatalf("expected a webhook configuration not registered by a development server not to be overwritten")
+	}
+	existing, err := GetValidatorWebhook(devValidatorWebhook, kubeClient)
+	if err != nil || !reflect.DeepEqual(existing, owned) {
+		t.Fatalf("expected the webhook configuration to be left untouched, got %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2019 The LitmusChaos Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// stallTimeout is the time after which the validators are deemed wedged if
+// all the workers are busy and none of them completed
+const stallTimeout = time.Minute
+
+// webhookConfigCheckInterval is the interval at which the webhook
+// configuration is checked, the probes read the outcome of the last check
+var webhookConfigCheckInterval = 30 * time.Second
+
+// webhookConfigStatus is the outcome of a check of the webhook configuration
+type webhookConfigStatus struct {
+	err error
+	// caBundleSkipped is set if the CA of the serving certificate is
+	// unknown, i.e. of a certificate file without a CA file or of a
+	// cert-manager Secret without ca.crt, so the caBundle isn't checked
+	caBundleSkipped bool
+}
+
+// healthCheck is a named check of the health of the admission controller
+type healthCheck struct {
+	name  string
+	check func() error
+}
+
+// livenessChecks fail if the admission controller must be restarted
+func (wh *webhook) livenessChecks() []healthCheck {
+	return []healthCheck{
+		{name: "validators", check: func() error { return wh.pipeline.stalled(stallTimeout) }},
+	}
+}
+
+// readinessChecks fail if the admission controller can't serve admission
+// requests yet, or can't serve them anymore
+func (wh *webhook) readinessChecks() []healthCheck {
+	return []healthCheck{
+		{name: "certificates", check: wh.checkCertificates},
+		{name: "informers", check: wh.checkInformers},
+		{name: "webhook-configuration", check: wh.checkWebhookConfiguration},
+	}
+}
+
+// checkCertificates fails if the serving certificate isn't loaded or expires
+// within the certificate expiry threshold
+func (wh *webhook) checkCertificates() error {
+	serving := wh.serving()
+	if serving == nil {
+		return fmt.Errorf("serving certificate is not loaded")
+	}
+	if left := time.Until(serving.cert.NotAfter); left < wh.certExpiryThreshold {
+		return fmt.Errorf("serving certificate expires at %v", serving.cert.NotAfter)
+	}
+	return nil
+}
+
+// checkInformers fails until the informer caches are synced
+func (wh *webhook) checkInformers() error {
+	if !wh.cache.HasSynced() {
+		return fmt.Errorf("informer caches are not synced")
+	}
+	return nil
+}
+
+// checkWebhookConfiguration returns the outcome of the last check of the
+// webhook configuration, the probes don't call the API server
+func (wh *webhook) checkWebhookConfiguration() error {
+	status, ok := wh.webhookConfigStatus.Load().(*webhookConfigStatus)
+	if !ok {
+		return fmt.Errorf("webhook configuration %s is not checked yet", wh.webhookConfig)
+	}
+	return status.err
+}
+
+// RunWebhookConfigurationCheck checks the webhook configuration every
+// webhookConfigCheckInterval until stopCh is closed
+func (wh *webhook) RunWebhookConfigurationCheck(stopCh <-chan struct{}) {
+	wait.Until(wh.refreshWebhookConfigStatus, webhookConfigCheckInterval, stopCh)
+}
+
+// refreshWebhookConfigStatus checks the webhook configuration and stores the
+// outcome for the readiness probe
+func (wh *webhook) refreshWebhookConfigStatus() {
+	status := wh.verifyWebhookConfiguration()
+	previous, _ := wh.webhookConfigStatus.Load().(*webhookConfigStatus)
+	if status.caBundleSkipped && (previous == nil || !previous.caBundleSkipped) {
+		Logger(SubsystemHTTP).Info("Not checking the caBundle of the webhooks, the CA of the serving certificate is unknown",
+			"name", wh.webhookConfig)
+	}
+	wh.webhookConfigStatus.Store(status)
+}
+
+// verifyWebhookConfiguration fails if a handler is missing from the webhook
+// configuration, or if its caBundle doesn't hold the CA of the serving
+// certificate. The caBundle is skipped if that CA is unknown.
+func (wh *webhook) verifyWebhookConfiguration() *webhookConfigStatus {
+	serving := wh.serving()
+	if serving == nil {
+		return &webhookConfigStatus{err: fmt.Errorf("serving certificate is not loaded")}
+	}
+	config, err := GetValidatorWebhook(wh.webhookConfig, wh.kubeClient)
+	if err != nil {
+		return &webhookConfigStatus{err: fmt.Errorf("failed to get webhook configuration %s: %v", wh.webhookConfig, err)}
+	}
+	caBundle := bytes.TrimSpace(serving.caBundle)
+	status := &webhookConfigStatus{caBundleSkipped: len(caBundle) == 0}
+	registered := map[string]bool{}
+	for _, handler := range config.Webhooks {
+		if !status.caBundleSkipped && !bytes.Contains(handler.ClientConfig.CABundle, caBundle) {
+			status.err = fmt.Errorf("caBundle of webhook %s doesn't hold the serving CA", handler.Name)
+			return status
+		}
+		registered[handler.Name] = true
+	}
+	for _, name := range []string{webhookHandlerName, protectionHandlerName, referencesHandlerName} {
+		if !registered[name] {
+			status.err = fmt.Errorf("webhook %s is not registered", name)
+			return status
+		}
+	}
+	return status
+}
+
+// ServeLiveness answers the liveness probe
+func (wh *webhook) ServeLiveness(w http.ResponseWriter, r *http.Request) {
+	serveHealthChecks(w, "liveness", wh.livenessChecks())
+}
+
+// ServeReadiness answers the readiness probe
+func (wh *webhook) ServeReadiness(w http.ResponseWriter, r *http.Request) {
+	serveHealthChecks(w, "readiness", wh.readinessChecks())
+}
+
+// serveHealthChecks runs the given checks and writes their outcome, in the
+// format of the health checks of the kubernetes components
+func serveHealthChecks(w http.ResponseWriter, probe string, checks []healthCheck) {
+	var output bytes.Buffer
+	failed := false
+	for _, c := range checks {
+		if err := c.check(); err != nil {
+			Logger(SubsystemHTTP).V(2).Info("Health check failed", "probe", probe, "check", c.name, "error", err.Error())
+			fmt.Fprintf(&output, "[-]%s failed: %v\n", c.name, err)
+			failed = true
+			continue
+		}
+		fmt.Fprintf(&output, "[+]%s ok\n", c.name)
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if failed {
+		fmt.Fprintf(&output, "%s check failed\n", probe)
+		w.WriteHeader(http.StatusInternalServerError)
+	} else {
+		fmt.Fprintf(&output, "%s check passed\n", probe)
+	}
+	if _, err := w.Write(output.Bytes()); err != nil {
+		Logger(SubsystemHTTP).Error(err, "Can't write health check response", "probe", probe)
+	}
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2019 LitmusChaos Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/api/admissionregistration/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestReadiness(t *testing.T) {
+	ca, err := NewCA("admission-controller-ca")
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+	otherCA, err := NewCA("other-ca")
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+	serverKeyPair, err := NewServerKeyPair(ca, "admission-controller", validatorServiceName, litmusNamespace, "cluster.local", nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create server key pair: %v", err)
+	}
+	webhookConfig := func(caBundle []byte, handlers []v1beta1.ValidatingWebhook) *v1beta1.ValidatingWebhookConfiguration {
+		config := &v1beta1.ValidatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: validatorWebhook},
+			Webhooks:   getWebhookHandlers(litmusNamespace, validatorServiceName, caBundle),
+		}
+		if handlers != nil {
+			config.Webhooks = handlers
+		}
+		return config
+	}
+
+	var tests = []struct {
+		description      string
+		config           *v1beta1.ValidatingWebhookConfiguration
+		unsynced         bool
+		unchecked        bool
+		unknownCA        bool
+		expiryThreshold  time.Duration
+		isReadyExpected  bool
+		expectedFailures []string
+	}{
+		{
+			description:     "Ready once everything is loaded, synced and reconciled.",
+			config:          webhookConfig(EncodeCertPEM(ca.Cert), nil),
+			isReadyExpected: true,
+		},
+		{
+			description:      "Not ready until the informer caches are synced.",
+			config:           webhookConfig(EncodeCertPEM(ca.Cert), nil),
+			unsynced:         true,
+			expectedFailures: []string{"informers"},
+		},
+		{
+			description:      "Not ready without the webhook configuration.",
+			expectedFailures: []string{"webhook-configuration"},
+		},
+		{
+			description:      "Not ready if the caBundle doesn't hold the serving CA.",
+			config:           webhookConfig(EncodeCertPEM(otherCA.Cert), nil),
+			expectedFailures: []string{"webhook-configuration"},
+		},
+		{
+			description:     "The caBundle isn't checked if the serving CA is unknown.",
+			config:          webhookConfig(EncodeCertPEM(otherCA.Cert), nil),
+			unknownCA:       true,
+			isReadyExpected: true,
+		},
+		{
+			description:      "Not ready until the webhook configuration is checked.",
+			config:           webhookConfig(EncodeCertPEM(ca.Cert), nil),
+			unchecked:        true,
+			expectedFailures: []string{"webhook-configuration"},
+		},
+		{
+			description:      "Not ready if a webhook is missing.",
+			config:           webhookConfig(EncodeCertPEM(ca.Cert), getWebhookHandlers(litmusNamespace, validatorServiceName, EncodeCertPEM(ca.Cert))[:1]),
+			expectedFailures: []string{"webhook-configuration"},
+		},
+		{
+			description:      "Not ready if the serving certificate is close to expiry.",
+			config:           webhookConfig(EncodeCertPEM(ca.Cert), nil),
+			expiryThreshold:  2 * duration365d,
+			expectedFailures: []string{"certificates"},
+		},
+	}
+	for _, test := range tests {
+		stopCh := make(chan struct{})
+		var objects []runtime.Object
+		if test.config != nil {
+			objects = append(objects, test.config)
+		}
+		webhook := newTestWebhook(t, stopCh, objects, nil)
+		serving := &servingCertificate{cert: serverKeyPair.Cert, caBundle: EncodeCertPEM(ca.Cert)}
+		if test.unknownCA {
+			serving.caBundle = nil
+		}
+		webhook.certificate.Store(serving)
+		webhook.certExpiryThreshold = test.expiryThreshold
+		if test.unsynced {
+			atomic.StoreInt32(&webhook.cache.synced, 0)
+		}
+		if !test.unchecked {
+			webhook.refreshWebhookConfigStatus()
+		}
+
+		kubeClient := webhook.kubeClient.(*fake.Clientset)
+		kubeClient.ClearActions()
+		recorder := httptest.NewRecorder()
+		webhook.ServeReadiness(recorder, httptest.NewRequest("GET", "/readyz", nil))
+		close(stopCh)
+		if actions := kubeClient.Actions(); len(actions) != 0 {
+			t.Fatalf("Test %q failed: expected the probe not to call the API server, got %v", test.description, actions)
+		}
+
+		if isReady := recorder.Code == http.StatusOK; isReady != test.isReadyExpected {
+			t.Fatalf("Test %q failed: expected ready %v, got %v: %s", test.description, test.isReadyExpected, isReady, recorder.Body.String())
+		}
+		for _, check := range test.expectedFailures {
+			if !strings.Contains(recorder.Body.String(), "[-]"+check+" failed") {
+				t.Fatalf("Test %q failed: expected check %s to fail, got %s", test.description, check, recorder.Body.String())
+			}
+		}
+	}
+}
+
+func TestLiveness(t *testing.T) {
+	var tests = []struct {
+		description     string
+		busyWorkers     int
+		lastDone        time.Duration
+		isAliveExpected bool
+	}{
+		{
+			description:     "Alive with idle workers.",
+			lastDone:        2 * stallTimeout,
+			isAliveExpected: true,
+		},
+		{
+			description:     "Alive while busy workers complete.",
+			busyWorkers:     2,
+			lastDone:        time.Second,
+			isAliveExpected: true,
+		},
+		{
+			description:     "Not alive if busy workers don't complete.",
+			busyWorkers:     2,
+			lastDone:        2 * stallTimeout,
+			isAliveExpected: false,
+		},
+	}
+	for _, test := range tests {
+		webhook := &webhook{pipeline: newPipeline(2, 0)}
+		for i := 0; i < test.busyWorkers; i++ {
+			webhook.pipeline.workers <- struct{}{}
+		}
+		webhook.pipeline.lastDone = time.Now().Add(-test.lastDone).UnixNano()
+
+		recorder := httptest.NewRecorder()
+		webhook.ServeLiveness(recorder, httptest.NewRequest("GET", "/healthz", nil))
+		if isAlive := recorder.Code == http.StatusOK; isAlive != test.isAliveExpected {
+			t.Fatalf("Test %q failed: expected alive %v, got %v: %s", test.description, test.isAliveExpected, isAlive, recorder.Body.String())
+		}
+	}
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2019 The LitmusChaos Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/api/admission/v1beta1"
+)
+
+// Subsystem is a part of the admission controller logging with its own
+// verbosity
+type Subsystem string
+
+// Subsystems of the admission controller
+const (
+	// SubsystemBootstrap logs the startup and shutdown, the creation of the
+	// Secret, Service and webhook configuration and the informers
+	SubsystemBootstrap Subsystem = "bootstrap"
+	// SubsystemTLS logs the loading of the certificates
+	SubsystemTLS Subsystem = "tls"
+	// SubsystemHTTP logs the requests served by the webhook server
+	SubsystemHTTP Subsystem = "http"
+	// SubsystemValidators logs the validators run on admission requests
+	SubsystemValidators Subsystem = "validators"
+	// SubsystemRevalidation logs the revalidation of existing ChaosEngines
+	SubsystemRevalidation Subsystem = "revalidation"
+)
+
+// subsystems are all the subsystems, in the order they are documented
+var subsystems = []Subsystem{SubsystemBootstrap, SubsystemTLS, SubsystemHTTP, SubsystemValidators, SubsystemRevalidation}
+
+// LogFormat is the format of the log lines
+type LogFormat string
+
+const (
+	// LogFormatText writes key="value" pairs
+	LogFormatText LogFormat = "text"
+	// LogFormatJSON writes a JSON object per line
+	LogFormatJSON LogFormat = "json"
+)
+
+// LogOptions configure the loggers of the subsystems
+type LogOptions struct {
+	// Format is the format of the log lines
+	Format LogFormat
+	// Verbosity is the verbosity of the subsystems missing from Subsystems
+	Verbosity int
+	// Subsystems holds the verbosity of every subsystem which doesn't log at
+	// the default Verbosity
+	Subsystems map[Subsystem]int
+}
+
+// ParseLogFormat returns the LogFormat with the given name
+func ParseLogFormat(format string) (LogFormat, error) {
+	switch f := LogFormat(format); f {
+	case LogFormatText, LogFormatJSON:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown log format %s, expected %s or %s", format, LogFormatText, LogFormatJSON)
+}
+
+// ParseLogVerbosity parses comma separated subsystem=verbosity pairs, i.e.
+// validators=4,http=2
+func ParseLogVerbosity(list string) (map[Subsystem]int, error) {
+	verbosity := map[Subsystem]int{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		pair := strings.SplitN(item, "=", 2)
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("invalid log verbosity %s, expected subsystem=verbosity", item)
+		}
+		subsystem := Subsystem(strings.TrimSpace(pair[0]))
+		if !containsSubsystem(subsystems, subsystem) {
+			return nil, fmt.Errorf("unknown log subsystem %s, expected one of %v", subsystem, subsystems)
+		}
+		level, err := strconv.Atoi(strings.TrimSpace(pair[1]))
+		if err != nil || level < 0 {
+			return nil, fmt.Errorf("invalid verbosity %s of log subsystem %s", pair[1], subsystem)
+		}
+		verbosity[subsystem] = level
+	}
+	return verbosity, nil
+}
+
+func containsSubsystem(list []Subsystem, s Subsystem) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	loggersMu sync.RWMutex
+	loggers   = newLoggers(os.Stderr, LogOptions{Format: LogFormatText})
+)
+
+// ConfigureLogging sets the format and the verbosity of the loggers of all
+// the subsystems, which write to the given writer
+func ConfigureLogging(w io.Writer, opts LogOptions) error {
+	if _, err := ParseLogFormat(string(opts.Format)); err != nil {
+		return err
+	}
+	loggersMu.Lock()
+	defer loggersMu.Unlock()
+	loggers = newLoggers(w, opts)
+	return nil
+}
+
+// newLoggers returns the loggers of all the subsystems
+func newLoggers(w io.Writer, opts LogOptions) map[Subsystem]logr.Logger {
+	var mu sync.Mutex
+	write := func(line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintln(w, line)
+	}
+
+	subsystemLoggers := map[Subsystem]logr.Logger{}
+	for _, subsystem := range subsystems {
+		funcrOptions := funcr.Options{LogTimestamp: true, Verbosity: opts.Verbosity}
+		if verbosity, ok := opts.Subsystems[subsystem]; ok {
+			funcrOptions.Verbosity = verbosity
+		}
+		var logger logr.Logger
+		if opts.Format == LogFormatJSON {
+			logger = funcr.NewJSON(write, funcrOptions)
+		} else {
+			logger = funcr.New(func(prefix, args string) { write(prefix + " " + args) }, funcrOptions)
+		}
+		subsystemLoggers[subsystem] = logger.WithName(string(subsystem))
+	}
+	return subsystemLoggers
+}
+
+// Logger returns the logger of the given subsystem
+func Logger(subsystem Subsystem) logr.Logger {
+	loggersMu.RLock()
+	defer loggersMu.RUnlock()
+	return loggers[subsystem]
+}
+
+type logValuesKey struct{}
+
+// withLogValues returns a context holding the given key and value pairs
+// along with the ones already held by ctx
+func withLogValues(ctx context.Context, keysAndValues ...interface{}) context.Context {
+	values, _ := ctx.Value(logValuesKey{}).([]interface{})
+	return context.WithValue(ctx, logValuesKey{}, append(append([]interface{}{}, values...), keysAndValues...))
+}
+
+// withRequestLogValues returns a context holding the key and value pairs
+// which correlate the log lines of an admission request
+func withRequestLogValues(ctx context.Context, req *v1beta1.AdmissionRequest) context.Context {
+	keysAndValues := requestLogValues(req)
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		keysAndValues = append(keysAndValues, "traceID", spanContext.TraceID().String())
+	}
+	return withLogValues(ctx, keysAndValues...)
+}
+
+// requestLogValues returns the key and value pairs identifying an admission
+// request
+func requestLogValues(req *v1beta1.AdmissionRequest) []interface{} {
+	return []interface{}{
+		"uid", string(req.UID),
+		"kind", req.Kind.Kind,
+		"namespace", req.Namespace,
+		"name", req.Name,
+		"operation", string(req.Operation),
+		"user", req.UserInfo.Username,
+	}
+}
+
+// requestLogger returns the logger of the given validator for the given
+// request, for the validators which don't get the context of the request
+func requestLogger(req *v1beta1.AdmissionRequest, validator string) logr.Logger {
+	return Logger(SubsystemValidators).WithValues(requestLogValues(req)...).WithValues("validator", validator)
+}
+
+// loggerFrom returns the logger of the given subsystem with the key and value
+// pairs held by ctx
+func loggerFrom(ctx context.Context, subsystem Subsystem) logr.Logger {
+	values, _ := ctx.Value(logValuesKey{}).([]interface{})
+	return Logger(subsystem).WithValues(values...)
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2019 LitmusChaos Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/litmuschaos/chaos-operator/pkg/apis/litmuschaos/v1alpha1"
+	"k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestRequestLogs(t *testing.T) {
+	os.Setenv("LITMUS_NAMESPACE", litmusNamespace)
+	defer os.Unsetenv("LITMUS_NAMESPACE")
+	defer ConfigureLogging(os.Stderr, LogOptions{Format: LogFormatText})
+
+	raw, err := json.Marshal(&v1alpha1.ChaosEngine{
+		ObjectMeta: metav1.ObjectMeta{Name: "engine", Namespace: testNamespace},
+		Spec: v1alpha1.ChaosEngineSpec{
+			Appinfo: v1alpha1.ApplicationParams{Appns: testNamespace, Applabel: "app=nginx", AppKind: "deployment"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal ChaosEngine: %v", err)
+	}
+	body, err := json.Marshal(&v1beta1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1beta1", Kind: "AdmissionReview"},
+		Request: &v1beta1.AdmissionRequest{
+			UID:       "request-uid",
+			Kind:      metav1.GroupVersionKind{Group: "litmuschaos.io", Version: "v1alpha1", Kind: "ChaosEngine"},
+			Name:      "engine",
+			Namespace: testNamespace,
+			Operation: v1beta1.Create,
+			UserInfo:  authenticationv1.UserInfo{Username: "jane"},
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal AdmissionReview: %v", err)
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	webhook := newTestWebhook(t, stopCh,
+		[]runtime.Object{&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespace}}}, nil)
+
+	var tests = []struct {
+		description            string
+		verbosity              map[Subsystem]int
+		isValidatorLogExpected bool
+	}{
+		{
+			description:            "Validators are logged at verbosity 4.",
+			verbosity:              map[Subsystem]int{SubsystemValidators: 4},
+			isValidatorLogExpected: true,
+		},
+		{
+			description:            "The verbosity of the other subsystems doesn't apply to the validators.",
+			verbosity:              map[Subsystem]int{SubsystemHTTP: 4},
+			isValidatorLogExpected: false,
+		},
+	}
+	for _, test := range tests {
+		var output bytes.Buffer
+		if err := ConfigureLogging(&output, LogOptions{Format: LogFormatJSON, Subsystems: test.verbosity}); err != nil {
+			t.Fatalf("Test %q failed: %v", test.description, err)
+		}
+		request := httptest.NewRequest("POST", "/validate", bytes.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		webhook.Serve(httptest.NewRecorder(), request)
+
+		var decision, validator map[string]interface{}
+		scanner := bufio.NewScanner(&output)
+		for scanner.Scan() {
+			line := map[string]interface{}{}
+			if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+				t.Fatalf("Test %q failed: expected JSON log lines, got %s", test.description, scanner.Text())
+			}
+			switch line["msg"] {
+			case "Admission request answered":
+				decision = line
+			case "Validator completed":
+				validator = line
+			}
+		}
+
+		if decision == nil {
+			t.Fatalf("Test %q failed: expected the decision to be logged, got %s", test.description, output.String())
+		}
+		expected := map[string]interface{}{
+			"logger":    string(SubsystemHTTP),
+			"uid":       "request-uid",
+			"kind":      "ChaosEngine",
+			"namespace": testNamespace,
+			"name":      "engine",
+			"operation": "CREATE",
+			"user":      "jane",
+			"decision":  resultDenied,
+		}
+		for key, value := range expected {
+			if !reflect.DeepEqual(decision[key], value) {
+				t.Fatalf("Test %q failed: expected %s %v in the decision log, got %v", test.description, key, value, decision)
+			}
+		}
+		if isValidatorLogged := validator != nil; isValidatorLogged != test.isValidatorLogExpected {
+			t.Fatalf("Test %q failed: expected validator logs %v, got %s", test.description, test.isValidatorLogExpected, output.String())
+		}
+		if validator != nil && (validator["uid"] != "request-uid" || validator["validator"] == nil) {
+			t.Fatalf("Test %q failed: expected the validator log to be correlated with the request, got %v", test.description, validator)
+		}
+	}
+}
+
+func TestParseLogVerbosity(t *testing.T) {
+	var tests = []struct {
+		description     string
+		list            string
+		expected        map[Subsystem]int
+		isErrorExpected bool
+	}{
+		{
+			description: "Subsystems are parsed with their verbosity.",
+			list:        "validators=4, http=2",
+			expected:    map[Subsystem]int{SubsystemValidators: 4, SubsystemHTTP: 2},
+		},
+		{
+			description: "An empty list sets no verbosity.",
+			list:        "",
+			expected:    map[Subsystem]int{},
+		},
+		{
+			description:     "Unknown subsystems are rejected.",
+			list:            "unknown=2",
+			isErrorExpected: true,
+		},
+		{
+			description:     "Invalid verbosities are rejected.",
+			list:            "tls=high",
+			isErrorExpected: true,
+		},
+		{
+			description:     "Subsystems without verbosity are rejected.",
+			list:            "tls",
+			isErrorExpected: true,
+		},
+	}
+	for _, test := range tests {
+		verbosity, err := ParseLogVerbosity(test.list)
+		if isError := err != nil; isError != test.isErrorExpected {
+			t.Fatalf("Test %q failed: expected error %v, got %v", test.description, test.isErrorExpected, err)
+		}
+		if err == nil && !reflect.DeepEqual(verbosity, test.expected) {
+			t.Fatalf("Test %q failed: expected %v, got %v", test.description, test.expected, verbosity)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+/*
+Copyright 2019 The LitmusChaos Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	litmuschaosv1alpha1 "github.com/litmuschaos/chaos-operator/pkg/client/clientset/versioned"
+	fakelitmus "github.com/litmuschaos/chaos-operator/pkg/client/clientset/versioned/fake"
+	litmusscheme "github.com/litmuschaos/chaos-operator/pkg/client/clientset/versioned/scheme"
+	"k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	kubescheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+const (
+	// manifestUser is the user of the admission requests built from manifests
+	manifestUser = "litmus-admission-controller:validate"
+	// verdictSkipped is the decision on the manifests no validator runs
+	// against, i.e. ChaosExperiments
+	verdictSkipped = "skipped"
+)
+
+// Manifest is an object read from a YAML or JSON file
+type Manifest struct {
+	// File is the file the object was read from
+	File string
+	// Object is the decoded object
+	Object *unstructured.Unstructured
+}
+
+// LoadManifests reads the objects of the given YAML or JSON files, and of the
+// .yaml, .yml and .json files found in the given directories
+func LoadManifests(paths []string) ([]Manifest, error) {
+	var manifests []Manifest
+	for _, path := range paths {
+		files, err := manifestFiles(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			objects, err := readManifestFile(file)
+			if err != nil {
+				return nil, err
+			}
+			manifests = append(manifests, objects...)
+		}
+	}
+	return manifests, nil
+}
+
+// manifestFiles returns the given file, or the manifest files found in the
+// given directory
+func manifestFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	var files []string
+	err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".yaml", ".yml", ".json":
+			if !info.IsDir() {
+				files = append(files, file)
+			}
+		}
+		return nil
+	})
+	return files, err
+}
+
+// readManifestFile returns the objects of the documents of a manifest file,
+// skipping the empty ones
+func readManifestFile(file string) ([]Manifest, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var manifests []Manifest
+	decoder := yaml.NewYAMLOrJSONDecoder(bufio.NewReader(f), 4096)
+	for {
+		object := &unstructured.Unstructured{}
+		if err := decoder.Decode(&object.Object); err != nil {
+			if err == io.EOF {
+				return manifests, nil
+			}
+			return nil, fmt.Errorf("failed to decode %s: %v", file, err)
+		}
+		if len(object.Object) == 0 {
+			continue
+		}
+		if object.GetKind() == "" {
+			return nil, fmt.Errorf("failed to decode %s: object %q has no kind", file, object.GetName())
+		}
+		manifests = append(manifests, Manifest{File: file, Object: object})
+	}
+}
+
+// NewFakeClients returns clientsets serving the given objects, i.e. fixtures
+// of the cluster for an offline validation
+func NewFakeClients(manifests []Manifest) (kubernetes.Interface, litmuschaosv1alpha1.Interface, error) {
+	var kubeObjects, litmusObjects []runtime.Object
+	for _, manifest := range manifests {
+		data, err := manifest.Object.MarshalJSON()
+		if err != nil {
+			return nil, nil, err
+		}
+		if manifest.Object.GroupVersionKind().Group == "litmuschaos.io" {
+			obj, _, err := litmusscheme.Codecs.UniversalDeserializer().Decode(data, nil, nil)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to decode %s %s of %s: %v", manifest.Object.GetKind(), manifest.Object.GetName(), manifest.File, err)
+			}
+			litmusObjects = append(litmusObjects, obj)
+			continue
+		}
+		obj, _, err := kubescheme.Codecs.UniversalDeserializer().Decode(data, nil, nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decode %s %s of %s: %v", manifest.Object.GetKind(), manifest.Object.GetName(), manifest.File, err)
+		}
+		kubeObjects = append(kubeObjects, obj)
+	}
+	return fake.NewSimpleClientset(kubeObjects...), fakelitmus.NewSimpleClientset(litmusObjects...), nil
+}
+
+// Verdict is the outcome of the validation of a manifest
+type Verdict struct {
+	File      string `json:"file"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	// Decision is allowed, denied, error or skipped
+	Decision   string            `json:"decision"`
+	Code       int32             `json:"code,omitempty"`
+	Message    string            `json:"message,omitempty"`
+	Warnings   []string          `json:"warnings,omitempty"`
+	Validators []ValidatorRecord `json:"validators"`
+}
+
+// Allowed tells whether the manifest would be admitted
+func (v Verdict) Allowed() bool {
+	return v.Decision == resultAllowed
+}
+
+// Skipped tells whether no validator ran against the manifest
+func (v Verdict) Skipped() bool {
+	return v.Decision == verdictSkipped
+}
+
+// ManifestValidator runs the validators of the admission controller against
+// manifests, outside of an admission request
+type ManifestValidator struct {
+	wh *webhook
+}
+
+// NewManifestValidator returns a ManifestValidator reading the cluster through
+// the given clients, which may be fakes holding fixtures
+func NewManifestValidator(p Parameters, kubeClient kubernetes.Interface,
+	litmusClient litmuschaosv1alpha1.Interface) (*ManifestValidator, error) {
+	wh, err := newWebhook(p, kubeClient, litmusClient)
+	if err != nil {
+		return nil, err
+	}
+	return &ManifestValidator{wh: wh}, nil
+}
+
+// Start runs the informers and blocks until their caches are synced
+func (v *ManifestValidator) Start(stopCh <-chan struct{}) error {
+	return v.wh.Start(stopCh)
+}
+
+// Validate validates the creation of the object of the given manifest. The
+// manifests of the kinds without validators are skipped.
+func (v *ManifestValidator) Validate(ctx context.Context, manifest Manifest) Verdict {
+	object := manifest.Object
+	raw, err := object.MarshalJSON()
+	gvk := object.GroupVersionKind()
+	verdict := Verdict{
+		File:       manifest.File,
+		Kind:       gvk.Kind,
+		Namespace:  object.GetNamespace(),
+		Name:       object.GetName(),
+		Validators: []ValidatorRecord{},
+	}
+	if err != nil {
+		verdict.Decision, verdict.Message = resultError, err.Error()
+		return verdict
+	}
+	if len(v.wh.registry.Validators(gvk.Kind, v1beta1.Create)) == 0 {
+		verdict.Decision, verdict.Message = verdictSkipped, fmt.Sprintf("no validator runs against %ss", gvk.Kind)
+		return verdict
+	}
+
+	req := &v1beta1.AdmissionRequest{
+		Kind:      metav1.GroupVersionKind{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind},
+		Namespace: object.GetNamespace(),
+		Name:      object.GetName(),
+		Operation: v1beta1.Create,
+		UserInfo:  authenticationv1.UserInfo{Username: manifestUser},
+		Object:    runtime.RawExtension{Raw: raw},
+	}
+	ctx = withRequestLogValues(ctx, req)
+	response := v.wh.validate(ctx, &v1beta1.AdmissionReview{Request: req})
+	record := newDecisionRecord(req, response, "")
+	verdict.Decision = record.Decision
+	verdict.Code = record.Code
+	verdict.Message = record.Message
+	verdict.Warnings = record.Warnings
+	verdict.Validators = record.Validators
+	return verdict
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2019 LitmusChaos Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testFixtures = `
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: test-ns
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+  namespace: test-ns
+  labels:
+    app: nginx
+  annotations:
+    litmuschaos.io/chaos: "true"
+spec:
+  selector:
+    matchLabels:
+      app: nginx
+  template:
+    metadata:
+      labels:
+        app: nginx
+    spec:
+      containers:
+      - name: nginx
+        image: nginx
+---
+apiVersion: litmuschaos.io/v1alpha1
+kind: ChaosExperiment
+metadata:
+  name: pod-delete
+  namespace: test-ns
+spec:
+  definition:
+    image: litmuschaos/go-runner
+`
+
+const testManifests = `
+apiVersion: litmuschaos.io/v1alpha1
+kind: ChaosEngine
+metadata:
+  name: allowed
+  namespace: test-ns
+spec:
+  appinfo:
+    appns: test-ns
+    applabel: app=nginx
+    appkind: deployment
+  experiments:
+  - name: pod-delete
+---
+---
+{"apiVersion": "litmuschaos.io/v1alpha1", "kind": "ChaosEngine", "metadata": {"name": "denied", "namespace": "test-ns"},
+ "spec": {"appinfo": {"appns": "test-ns", "applabel": "app=missing", "appkind": "deployment"}}}
+---
+apiVersion: litmuschaos.io/v1alpha1
+kind: ChaosExperiment
+metadata:
+  name: container-kill
+  namespace: test-ns
+spec:
+  definition:
+    image: litmuschaos/go-runner
+`
+
+func TestValidateManifests(t *testing.T) {
+	os.Setenv("LITMUS_NAMESPACE", litmusNamespace)
+	defer os.Unsetenv("LITMUS_NAMESPACE")
+
+	dir, err := ioutil.TempDir("", "manifests")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	fixturesDir := filepath.Join(dir, "fixtures")
+	if err := os.Mkdir(fixturesDir, 0755); err != nil {
+		t.Fatalf("failed to create fixtures directory: %v", err)
+	}
+	files := map[string]string{
+		filepath.Join(fixturesDir, "cluster.yaml"): testFixtures,
+		filepath.Join(fixturesDir, "README.md"):    "not a manifest",
+		filepath.Join(dir, "engines.yaml"):         testManifests,
+	}
+	for file, content := range files {
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", file, err)
+		}
+	}
+
+	fixtures, err := LoadManifests([]string{fixturesDir})
+	if err != nil {
+		t.Fatalf("failed to load fixtures: %v", err)
+	}
+	if len(fixtures) != 3 {
+		t.Fatalf("expected 3 fixtures, got %d", len(fixtures))
+	}
+	kubeClient, litmusClient, err := NewFakeClients(fixtures)
+	if err != nil {
+		t.Fatalf("failed to create fake clients: %v", err)
+	}
+	validator, err := NewManifestValidator(Parameters{}, kubeClient, litmusClient)
+	if err != nil {
+		t.Fatalf("failed to create manifest validator: %v", err)
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	if err := validator.Start(stopCh); err != nil {
+		t.Fatalf("failed to start manifest validator: %v", err)
+	}
+
+	manifests, err := LoadManifests([]string{filepath.Join(dir, "engines.yaml")})
+	if err != nil {
+		t.Fatalf("failed to load manifests: %v", err)
+	}
+	if len(manifests) != 3 {
+		t.Fatalf("expected the empty documents to be skipped, got %d manifests", len(manifests))
+	}
+
+	var tests = []struct {
+		description        string
+		manifest           Manifest
+		expectedDecision   string
+		expectedValidators bool
+	}{
+		{
+			description:        "A ChaosEngine targeting an existing deployment is allowed.",
+			manifest:           manifests[0],
+			expectedDecision:   resultAllowed,
+			expectedValidators: true,
+		},
+		{
+			description:        "A ChaosEngine targeting a missing deployment is denied.",
+			manifest:           manifests[1],
+			expectedDecision:   resultDenied,
+			expectedValidators: true,
+		},
+		{
+			description:      "A ChaosExperiment is skipped, no validator runs against it.",
+			manifest:         manifests[2],
+			expectedDecision: verdictSkipped,
+		},
+	}
+	for _, test := range tests {
+		verdict := validator.Validate(context.Background(), test.manifest)
+		if verdict.Decision != test.expectedDecision {
+			t.Fatalf("Test %q failed: expected decision %s, got %+v", test.description, test.expectedDecision, verdict)
+		}
+		if verdict.Name != test.manifest.Object.GetName() || (len(verdict.Validators) != 0) != test.expectedValidators {
+			t.Fatalf("Test %q failed: expected the verdict to identify the manifest and its validators, got %+v", test.description, verdict)
+		}
+	}
+}
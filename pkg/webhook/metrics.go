@@ -0,0 +1,237 @@
+/*
+Copyright 2019 The LitmusChaos Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	clientmetrics "k8s.io/client-go/tools/metrics"
+	certutil "k8s.io/client-go/util/cert"
+
+	"github.com/litmuschaos/admission-controllers/pkg/version"
+)
+
+const (
+	metricsNamespace = "litmuschaos"
+	metricsSubsystem = "admission_controller"
+)
+
+// Results of the admission requests and the validators, used as metric labels
+const (
+	resultAllowed      = "allowed"
+	resultDenied       = "denied"
+	resultError        = "error"
+	resultPassed       = "passed"
+	resultFailed       = "failed"
+	resultInconclusive = "inconclusive"
+)
+
+var (
+	// metricsRegistry holds the metrics served by MetricsHandler
+	metricsRegistry = prometheus.NewRegistry()
+
+	admissionRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "requests_total",
+			Help:      "Number of admission requests by kind, operation and result.",
+		},
+		[]string{"kind", "operation", "result"},
+	)
+
+	validatorDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "validator_duration_seconds",
+			Help:      "Time taken by the validators by validator and result.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 13),
+		},
+		[]string{"validator", "result"},
+	)
+
+	denials = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "denials_total",
+			Help:      "Number of failures denying admission requests by error code.",
+		},
+		[]string{"code"},
+	)
+
+	apiRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "api_requests_total",
+			Help:      "Number of requests to the kubernetes API server by status code and method.",
+		},
+		[]string{"code", "method"},
+	)
+
+	apiRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "api_request_duration_seconds",
+			Help:      "Time taken by the requests to the kubernetes API server by verb.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"verb"},
+	)
+
+	// certificates are the certificates the expiry of which is exported
+	certificates = newCertificateCollector()
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		version.NewVersionCollector(metricsSubsystem),
+		admissionRequests,
+		validatorDuration,
+		denials,
+		apiRequests,
+		apiRequestDuration,
+		certificates,
+	)
+	clientmetrics.Register(apiLatencyMetric{}, apiResultMetric{})
+}
+
+// MetricsHandler serves the metrics of the admission controller
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// apiLatencyMetric records the latency of the client-go requests
+type apiLatencyMetric struct{}
+
+func (apiLatencyMetric) Observe(verb string, u url.URL, latency time.Duration) {
+	apiRequestDuration.WithLabelValues(verb).Observe(latency.Seconds())
+}
+
+// apiResultMetric counts the client-go requests
+type apiResultMetric struct{}
+
+func (apiResultMetric) Increment(code string, method string, host string) {
+	apiRequests.WithLabelValues(code, method).Inc()
+}
+
+// recordRequest counts an admission request answered with the given response
+func recordRequest(kind, operation string, response *admissionResponse) {
+	admissionRequests.WithLabelValues(kind, operation, responseResult(response)).Inc()
+}
+
+// responseResult returns whether the given response allows or denies the
+// request. Requests which could not be decoded are denied without the details
+// held by the denials of the validators, they are errors.
+func responseResult(response *admissionResponse) string {
+	switch {
+	case response == nil:
+		return resultError
+	case !response.Allowed && (response.Result == nil || response.Result.Details == nil):
+		return resultError
+	case !response.Allowed:
+		return resultDenied
+	}
+	return resultAllowed
+}
+
+// recordResults records the duration of the validators of the given results
+func recordResults(results []Result) {
+	for _, result := range results {
+		outcome := resultPassed
+		switch {
+		case result.Inconclusive:
+			outcome = resultInconclusive
+		case result.Err != nil:
+			outcome = resultFailed
+		}
+		validatorDuration.WithLabelValues(result.Validator.Name(), outcome).Observe(result.Duration.Seconds())
+	}
+}
+
+// recordDenials counts the error codes of the failures denying a request
+func recordDenials(results []Result) {
+	for _, code := range resultCodes(results) {
+		denials.WithLabelValues(code).Inc()
+	}
+}
+
+// setCertificateMetrics records the expiry of the serving certificate and of
+// the CA which signed it, if known
+func setCertificateMetrics(serving *x509.Certificate, caPEM []byte) error {
+	if len(caPEM) == 0 {
+		certificates.set("serving", serving)
+		return nil
+	}
+	cas, err := certutil.ParseCertsPEM(caPEM)
+	if err != nil {
+		return fmt.Errorf("failed to parse root certificate: %v", err)
+	}
+	certificates.set("serving", serving)
+	certificates.set("ca", cas[0])
+	return nil
+}
+
+// certificateCollector exports the seconds left before the certificates in
+// use expire, computed when the metrics are collected
+type certificateCollector struct {
+	mu    sync.RWMutex
+	certs map[string]*x509.Certificate
+	desc  *prometheus.Desc
+}
+
+func newCertificateCollector() *certificateCollector {
+	return &certificateCollector{
+		certs: map[string]*x509.Certificate{},
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, metricsSubsystem, "certificate_expiry_seconds"),
+			"Seconds left before the certificates used by the admission controller expire.",
+			[]string{"certificate"}, nil,
+		),
+	}
+}
+
+// set records the certificate in use under the given name
+func (c *certificateCollector) set(name string, cert *x509.Certificate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.certs[name] = cert
+}
+
+func (c *certificateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *certificateCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for name, cert := range c.certs {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, time.Until(cert.NotAfter).Seconds(), name)
+	}
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2019 LitmusChaos Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/litmuschaos/chaos-operator/pkg/apis/litmuschaos/v1alpha1"
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/api/admission/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// metricValue returns the value of the counter or the sample count of the
+// histogram with the given name and labels
+func metricValue(t *testing.T, name string, labels map[string]string) float64 {
+	families, err := metricsRegistry.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if !hasLabels(metric, labels) {
+				continue
+			}
+			if metric.GetHistogram() != nil {
+				return float64(metric.GetHistogram().GetSampleCount())
+			}
+			return metric.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func hasLabels(metric *dto.Metric, labels map[string]string) bool {
+	matched := 0
+	for _, pair := range metric.GetLabel() {
+		if value, ok := labels[pair.GetName()]; ok && value == pair.GetValue() {
+			matched++
+		}
+	}
+	return matched == len(labels)
+}
+
+func TestAdmissionMetrics(t *testing.T) {
+	os.Setenv("LITMUS_NAMESPACE", litmusNamespace)
+	defer os.Unsetenv("LITMUS_NAMESPACE")
+
+	// the application of the ChaosEngine doesn't exist, chaos-target fails
+	raw, err := json.Marshal(&v1alpha1.ChaosEngine{
+		ObjectMeta: metav1.ObjectMeta{Name: "engine", Namespace: testNamespace},
+		Spec: v1alpha1.ChaosEngineSpec{
+			Appinfo: v1alpha1.ApplicationParams{Appns: testNamespace, Applabel: "app=nginx", AppKind: "deployment"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal ChaosEngine: %v", err)
+	}
+	body, err := json.Marshal(&v1beta1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1beta1", Kind: "AdmissionReview"},
+		Request: &v1beta1.AdmissionRequest{
+			Kind:      metav1.GroupVersionKind{Group: "litmuschaos.io", Version: "v1alpha1", Kind: "ChaosEngine"},
+			Name:      "engine",
+			Namespace: testNamespace,
+			Operation: v1beta1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal AdmissionReview: %v", err)
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	webhook := newTestWebhook(t, stopCh,
+		[]runtime.Object{&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespace}}}, nil)
+
+	var tests = []struct {
+		description string
+		name        string
+		labels      map[string]string
+	}{
+		{
+			description: "Denied requests are counted.",
+			name:        "litmuschaos_admission_controller_requests_total",
+			labels:      map[string]string{"kind": "ChaosEngine", "operation": "CREATE", "result": resultDenied},
+		},
+		{
+			description: "The duration of failed validators is recorded.",
+			name:        "litmuschaos_admission_controller_validator_duration_seconds",
+			labels:      map[string]string{"validator": ChaosTargetValidator, "result": resultFailed},
+		},
+		{
+			description: "The duration of passed validators is recorded.",
+			name:        "litmuschaos_admission_controller_validator_duration_seconds",
+			labels:      map[string]string{"validator": ApplicationNamespaceValidator, "result": resultPassed},
+		},
+		{
+			description: "Denials are counted by error code.",
+			name:        "litmuschaos_admission_controller_denials_total",
+			labels:      map[string]string{"code": string(CodeApplicationNotFound)},
+		},
+	}
+	before := make([]float64, len(tests))
+	for i, test := range tests {
+		before[i] = metricValue(t, test.name, test.labels)
+	}
+
+	request := httptest.NewRequest("POST", "/validate", bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	webhook.Serve(httptest.NewRecorder(), request)
+
+	for i, test := range tests {
+		if value := metricValue(t, test.name, test.labels); value != before[i]+1 {
+			t.Fatalf("Test %q failed: expected %v, got %v", test.description, before[i]+1, value)
+		}
+	}
+}
+
+func TestCertificateMetrics(t *testing.T) {
+	ca, err := NewCA("admission-controller-ca")
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+	serverKeyPair, err := NewServerKeyPair(ca, "admission-controller", "admission-controller-svc", litmusNamespace, "cluster.local", nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create server key pair: %v", err)
+	}
+	if err := setCertificateMetrics(serverKeyPair.Cert, EncodeCertPEM(ca.Cert)); err != nil {
+		t.Fatalf("failed to set certificate metrics: %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	for _, certificate := range []string{"serving", "ca"} {
+		sample := `litmuschaos_admission_controller_certificate_expiry_seconds{certificate="` + certificate + `"}`
+		if !strings.Contains(recorder.Body.String(), sample) {
+			t.Fatalf("expected the metrics to hold %s, got %s", sample, recorder.Body.String())
+		}
+	}
+	if !strings.Contains(recorder.Body.String(), "litmuschaos_admission_controller_version{") {
+		t.Fatalf("expected the metrics to hold the version, got %s", recorder.Body.String())
+	}
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2019 The LitmusChaos Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+
+	k8serror "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// AdmissionModeLabel set on a namespace overrides the mode of all the
+// validators, but the mandatory ones, for the requests in that namespace
+const AdmissionModeLabel = "litmuschaos.io/admission-mode"
+
+// Mode tells what the failure of a validator does to the admission request
+type Mode string
+
+const (
+	// ModeEnforce failures deny the request
+	ModeEnforce Mode = "enforce"
+	// ModeWarn failures are returned as admission warnings
+	ModeWarn Mode = "warn"
+	// ModeAudit failures are only logged
+	ModeAudit Mode = "audit"
+)
+
+// ParseMode returns the Mode with the given name
+func ParseMode(mode string) (Mode, error) {
+	switch m := Mode(mode); m {
+	case ModeEnforce, ModeWarn, ModeAudit:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown admission mode %s, expected %s, %s or %s", mode, ModeEnforce, ModeWarn, ModeAudit)
+}
+
+// ModeConfig is the content of the admission mode configuration file, i.e.
+//
+//	defaultMode: enforce
+//	validators:
+//	  chaos-target: warn
+type ModeConfig struct {
+	// DefaultMode applies to the validators without a mode of their own,
+	// enforce if empty
+	DefaultMode Mode `json:"defaultMode,omitempty"`
+	// Validators maps the names of validators to their mode
+	Validators map[string]Mode `json:"validators,omitempty"`
+}
+
+// LoadModeConfig reads the admission mode configuration from the given file
+func LoadModeConfig(path string) (*ModeConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read admission mode config %s: %v", path, err)
+	}
+	config := &ModeConfig{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("unable to parse admission mode config %s: %v", path, err)
+	}
+	return config, nil
+}
+
+// check returns an error if the configuration holds an unknown mode, an
+// unknown validator or relaxes a mandatory validator of the registry
+func (c *ModeConfig) check(registry *Registry) error {
+	if c.DefaultMode != "" {
+		if _, err := ParseMode(string(c.DefaultMode)); err != nil {
+			return err
+		}
+	}
+	known := map[string]bool{}
+	for _, name := range registry.Names() {
+		known[name] = true
+	}
+	for name, mode := range c.Validators {
+		if !known[name] {
+			return fmt.Errorf("unknown validator %s in admission mode config", name)
+		}
+		if _, err := ParseMode(string(mode)); err != nil {
+			return err
+		}
+		if registry.IsMandatory(name) && mode != ModeEnforce {
+			return fmt.Errorf("validator %s is mandatory and can only be enforced", name)
+		}
+	}
+	return nil
+}
+
+// mode returns the configured mode of the named validator
+func (c *ModeConfig) mode(name string) Mode {
+	if c == nil {
+		return ModeEnforce
+	}
+	if mode, ok := c.Validators[name]; ok {
+		return mode
+	}
+	if c.DefaultMode != "" {
+		return c.DefaultMode
+	}
+	return ModeEnforce
+}
+
+// namespaceMode returns the mode set with the AdmissionModeLabel on the given
+// namespace, if any
+func (wh *webhook) namespaceMode(namespace string) (Mode, bool) {
+	if namespace == "" {
+		return "", false
+	}
+	ns, err := wh.cache.namespaces.Get(namespace)
+	if err != nil {
+		if !k8serror.IsNotFound(err) {
+			Logger(SubsystemValidators).Error(err, "Unable to get the admission mode of the namespace", "namespace", namespace)
+		}
+		return "", false
+	}
+	label, ok := ns.Labels[AdmissionModeLabel]
+	if !ok {
+		return "", false
+	}
+	mode, err := ParseMode(label)
+	if err != nil {
+		Logger(SubsystemValidators).Error(err, "Ignoring the admission mode label of the namespace", "namespace", namespace, "label", AdmissionModeLabel)
+		return "", false
+	}
+	return mode, true
+}
+
+// setModes sets the mode of every result of a request in the given namespace.
+// Mandatory validators are always enforced and validators with the warning
+// severity never are.
+func (wh *webhook) setModes(namespace string, results []Result) {
+	nsMode, overridden := wh.namespaceMode(namespace)
+	for i := range results {
+		v := results[i].Validator
+		mode := wh.modes.mode(v.Name())
+		if overridden {
+			mode = nsMode
+		}
+		if wh.registry.IsMandatory(v.Name()) {
+			mode = ModeEnforce
+		}
+		if mode == ModeEnforce && v.Severity() == SeverityWarning {
+			mode = ModeWarn
+		}
+		results[i].Mode = mode
+	}
+}
+
+// classify returns the failed results which deny the request and the ones
+// returned as warnings, the other failures are only logged. Inconclusive
+// results deny the request only if the inconclusive policy says so, or if
+// their validator is mandatory.
+func (wh *webhook) classify(ctx context.Context, results []Result) (denials []Result, warnings []Result) {
+	log := loggerFrom(ctx, SubsystemValidators)
+	for _, result := range results {
+		if result.Err == nil {
+			continue
+		}
+		resultLog := log.WithValues("validator", result.Validator.Name(), "mode", result.Mode)
+		switch {
+		case result.Mode == ModeAudit:
+			resultLog.Info("Validator failed in audit mode", "error", result.Err.Error())
+		case result.Inconclusive && wh.registry.IsMandatory(result.Validator.Name()):
+			// a slow API server must not switch off the self protection
+			denials = append(denials, result)
+		case result.Inconclusive && wh.inconclusivePolicy != InconclusiveDeny:
+			resultLog.Info("Validator is inconclusive", "error", result.Err.Error())
+			warnings = append(warnings, result)
+		case result.Mode == ModeWarn:
+			resultLog.Info("Validator failed in warn mode", "error", result.Err.Error())
+			warnings = append(warnings, result)
+		default:
+			denials = append(denials, result)
+		}
+	}
+	return denials, warnings
+}
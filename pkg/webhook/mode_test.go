@@ -0,0 +1,224 @@
+/*
+Copyright 2019 LitmusChaos Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/litmuschaos/chaos-operator/pkg/apis/litmuschaos/v1alpha1"
+	"k8s.io/api/admission/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestValidatorModes(t *testing.T) {
+	os.Setenv("LITMUS_NAMESPACE", litmusNamespace)
+	defer os.Unsetenv("LITMUS_NAMESPACE")
+
+	// the application of the ChaosEngine doesn't exist, chaos-target fails
+	raw, err := json.Marshal(&v1alpha1.ChaosEngine{
+		ObjectMeta: metav1.ObjectMeta{Name: "engine", Namespace: testNamespace},
+		Spec: v1alpha1.ChaosEngineSpec{
+			Appinfo: v1alpha1.ApplicationParams{Appns: testNamespace, Applabel: "app=nginx", AppKind: "deployment"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal ChaosEngine: %v", err)
+	}
+
+	var tests = []struct {
+		description       string
+		label             string
+		modes             *ModeConfig
+		isAllowExpected   bool
+		isWarningExpected bool
+	}{
+		{
+			description:     "Validators are enforced by default.",
+			isAllowExpected: false,
+		},
+		{
+			description:       "Failures of validators in warn mode are returned as warnings.",
+			modes:             &ModeConfig{Validators: map[string]Mode{ChaosTargetValidator: ModeWarn}},
+			isAllowExpected:   true,
+			isWarningExpected: true,
+		},
+		{
+			description:     "Failures of validators in audit mode are only logged.",
+			modes:           &ModeConfig{DefaultMode: ModeAudit},
+			isAllowExpected: true,
+		},
+		{
+			description:       "The namespace label overrides the configured mode.",
+			label:             "warn",
+			modes:             &ModeConfig{DefaultMode: ModeEnforce},
+			isAllowExpected:   true,
+			isWarningExpected: true,
+		},
+		{
+			description:     "The namespace label can enforce validators.",
+			label:           "enforce",
+			modes:           &ModeConfig{DefaultMode: ModeAudit},
+			isAllowExpected: false,
+		},
+		{
+			description:     "Invalid namespace labels are ignored.",
+			label:           "disabled",
+			isAllowExpected: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			namespace := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespace}}
+			if test.label != "" {
+				namespace.Labels = map[string]string{AdmissionModeLabel: test.label}
+			}
+			stopCh := make(chan struct{})
+			defer close(stopCh)
+			webhook := newTestWebhook(t, stopCh, []runtime.Object{namespace}, nil)
+			webhook.modes = test.modes
+
+			response := webhook.validate(context.Background(), &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					Kind:      metav1.GroupVersionKind{Kind: "ChaosEngine"},
+					Name:      "engine",
+					Namespace: testNamespace,
+					Operation: v1beta1.Create,
+					Object:    runtime.RawExtension{Raw: raw},
+				},
+			})
+			if response.Allowed != test.isAllowExpected {
+				t.Fatalf("Test %q failed: expected allowed to be %v, got %v", test.description, test.isAllowExpected, response.Allowed)
+			}
+			if (len(response.Warnings) != 0) != test.isWarningExpected {
+				t.Fatalf("Test %q failed: expected warnings %v, got %v", test.description, test.isWarningExpected, response.Warnings)
+			}
+		})
+	}
+}
+
+func TestInconclusiveMandatoryValidators(t *testing.T) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	webhook := newTestWebhook(t, stopCh, nil, nil)
+	webhook.inconclusivePolicy = InconclusiveAllow
+	validators := map[string]Validator{}
+	for _, v := range webhook.registry.all() {
+		validators[v.Name()] = v
+	}
+
+	var tests = []struct {
+		description      string
+		validator        string
+		isDenialExpected bool
+	}{
+		{
+			description:      "Inconclusive mandatory validators deny the request whatever the policy.",
+			validator:        SelfProtectionValidator,
+			isDenialExpected: true,
+		},
+		{
+			description:      "Inconclusive mandatory validators of the resources deny the request too.",
+			validator:        ResourceProtectionValidator,
+			isDenialExpected: true,
+		},
+		{
+			description:      "Other inconclusive validators follow the allow policy.",
+			validator:        ChaosTargetValidator,
+			isDenialExpected: false,
+		},
+	}
+	for _, test := range tests {
+		results := []Result{{
+			Validator:    validators[test.validator],
+			Mode:         ModeEnforce,
+			Err:          context.DeadlineExceeded,
+			Inconclusive: true,
+		}}
+		denials, warnings := webhook.classify(context.Background(), results)
+		if isDenied := len(denials) == 1; isDenied != test.isDenialExpected {
+			t.Fatalf("Test %q failed: expected denial %v, got denials %v and warnings %v", test.description, test.isDenialExpected, denials, warnings)
+		}
+	}
+}
+
+func TestModeConfigCheck(t *testing.T) {
+	registry := NewRegistry()
+	if err := registry.registerMandatory(&testValidator{name: "mandatory"}); err != nil {
+		t.Fatalf("expected error to be nil, got %v", err)
+	}
+	if err := registry.Register(&testValidator{name: "optional"}); err != nil {
+		t.Fatalf("expected error to be nil, got %v", err)
+	}
+
+	var tests = []struct {
+		description   string
+		config        ModeConfig
+		isErrExpected bool
+	}{
+		{
+			description: "Validators may run in any mode.",
+			config:      ModeConfig{DefaultMode: ModeAudit, Validators: map[string]Mode{"optional": ModeWarn}},
+		},
+		{
+			description:   "Mandatory validators can only be enforced.",
+			config:        ModeConfig{Validators: map[string]Mode{"mandatory": ModeWarn}},
+			isErrExpected: true,
+		},
+		{
+			description:   "Unknown validators are rejected.",
+			config:        ModeConfig{Validators: map[string]Mode{"unknown": ModeWarn}},
+			isErrExpected: true,
+		},
+		{
+			description:   "Unknown modes are rejected.",
+			config:        ModeConfig{DefaultMode: "disabled"},
+			isErrExpected: true,
+		},
+	}
+	for _, test := range tests {
+		err := test.config.check(registry)
+		if (err != nil) != test.isErrExpected {
+			t.Fatalf("Test %q failed: expected error %v, got %v", test.description, test.isErrExpected, err)
+		}
+	}
+}
+
+func TestAdmissionResponseWarnings(t *testing.T) {
+	response := newAdmissionResponse([]Result{{Err: fmt.Errorf("unable to find deployment")}})
+	data, err := json.Marshal(admissionReview{Response: response})
+	if err != nil {
+		t.Fatalf("failed to marshal AdmissionReview: %v", err)
+	}
+
+	var review map[string]map[string]interface{}
+	if err := json.Unmarshal(data, &review); err != nil {
+		t.Fatalf("failed to unmarshal AdmissionReview: %v", err)
+	}
+	if review["response"]["allowed"] != true {
+		t.Fatalf("expected the response to be allowed, got %s", data)
+	}
+	warnings, ok := review["response"]["warnings"].([]interface{})
+	if !ok || len(warnings) != 1 || warnings[0] != "unable to find deployment" {
+		t.Fatalf("expected the response to hold the warning, got %s", data)
+	}
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2019 The LitmusChaos Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// responseMargin is kept out of the request budget to encode and send the
+	// response before the API server gives up on the webhook
+	responseMargin = 500 * time.Millisecond
+)
+
+// InconclusivePolicy tells how the validators which could not complete in
+// time are handled
+type InconclusivePolicy string
+
+const (
+	// InconclusiveAllow ignores inconclusive validators, like the Ignore
+	// failure policy of the webhook does for a timed out request
+	InconclusiveAllow InconclusivePolicy = "allow"
+	// InconclusiveDeny handles inconclusive validators as failed ones
+	InconclusiveDeny InconclusivePolicy = "deny"
+)
+
+// ParseInconclusivePolicy returns the InconclusivePolicy with the given name
+func ParseInconclusivePolicy(policy string) (InconclusivePolicy, error) {
+	switch p := InconclusivePolicy(policy); p {
+	case InconclusiveAllow, InconclusiveDeny:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown inconclusive policy %s, expected %s or %s", policy, InconclusiveAllow, InconclusiveDeny)
+}
+
+// Result is the outcome of a validator on an admission request
+type Result struct {
+	// Validator is the validator which ran
+	Validator Validator
+	// Err is the failure of the validator, if any
+	Err error
+	// Inconclusive is true if the validator did not complete before its
+	// deadline, Err then holds the reason
+	Inconclusive bool
+	// Duration is the time the validator took, including the wait for a worker
+	Duration time.Duration
+	// Mode is the mode the validator ran in for the request
+	Mode Mode
+}
+
+// pipeline runs validators concurrently on a bounded number of workers shared
+// by all the admission requests
+type pipeline struct {
+	workers chan struct{}
+	// timeout bounds every validator, besides the deadline of the request
+	timeout time.Duration
+	// lastDone is the unix time in nanoseconds at which a worker was last
+	// released, or at which the pipeline was created
+	lastDone int64
+}
+
+// newPipeline returns a pipeline running at most the given number of
+// validators at once, each for at most timeout if it is positive
+func newPipeline(workers int, timeout time.Duration) *pipeline {
+	if workers < 1 {
+		workers = 1
+	}
+	return &pipeline{
+		workers:  make(chan struct{}, workers),
+		timeout:  timeout,
+		lastDone: time.Now().UnixNano(),
+	}
+}
+
+// stalled returns an error if all the workers are busy and none of them was
+// released for the given time, i.e. the validators hang
+func (p *pipeline) stalled(timeout time.Duration) error {
+	if len(p.workers) < cap(p.workers) {
+		return nil
+	}
+	lastDone := time.Unix(0, atomic.LoadInt64(&p.lastDone))
+	if since := time.Since(lastDone); since > timeout {
+		return fmt.Errorf("all %d validator workers are busy, none completed for %v", cap(p.workers), since.Round(time.Second))
+	}
+	return nil
+}
+
+// Run runs the given validators concurrently and returns their results in the
+// order of the validators. Validators which don't complete before the deadline
+// of the context are inconclusive.
+func (p *pipeline) Run(ctx context.Context, attr *Attributes, validators []Validator) []Result {
+	results := make([]Result, len(validators))
+	var wg sync.WaitGroup
+	for i, v := range validators {
+		wg.Add(1)
+		go func(i int, v Validator) {
+			defer wg.Done()
+			results[i] = p.run(ctx, attr, v)
+		}(i, v)
+	}
+	wg.Wait()
+	return results
+}
+
+// run runs a single validator on a worker. It returns at the deadline even if
+// the validator doesn't, the worker is released once the validator returns.
+func (p *pipeline) run(ctx context.Context, attr *Attributes, v Validator) Result {
+	start := time.Now()
+	result := Result{Validator: v}
+	ctx, span := tracer().Start(ctx, "Validate "+v.Name(), trace.WithAttributes(validatorKey.String(v.Name())))
+	defer func() {
+		span.SetAttributes(inconclusiveKey.Bool(result.Inconclusive))
+		endSpan(span, result.Err)
+	}()
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+
+	select {
+	case p.workers <- struct{}{}:
+	case <-ctx.Done():
+		result.Inconclusive = true
+		result.Err = fmt.Errorf("validator %s did not start: %v", v.Name(), ctx.Err())
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			atomic.StoreInt64(&p.lastDone, time.Now().UnixNano())
+			<-p.workers
+		}()
+		defer func() {
+			if r := recover(); r != nil {
+				loggerFrom(ctx, SubsystemValidators).Error(fmt.Errorf("%v", r), "Validator panicked", "validator", v.Name())
+				done <- fmt.Errorf("validator %s failed unexpectedly", v.Name())
+			}
+		}()
+		done <- v.Validate(ctx, attr)
+	}()
+
+	select {
+	case err := <-done:
+		result.Err = err
+		if err != nil && ctx.Err() != nil {
+			result.Inconclusive = true
+		}
+	case <-ctx.Done():
+		result.Inconclusive = true
+		result.Err = fmt.Errorf("validator %s did not complete: %v", v.Name(), ctx.Err())
+	}
+	result.Duration = time.Since(start)
+	loggerFrom(ctx, SubsystemValidators).V(4).Info("Validator completed", "validator", v.Name(),
+		"duration", result.Duration.String(), "failed", result.Err != nil, "inconclusive", result.Inconclusive)
+	return result
+}
+
+// requestBudget returns the time left to answer the given admission request.
+// The API server sends the timeout of the webhook along with the request, the
+// configured TimeoutSeconds are assumed otherwise.
+func requestBudget(r *http.Request) time.Duration {
+	budget := time.Duration(five) * time.Second
+	if timeout, err := time.ParseDuration(r.URL.Query().Get("timeout")); err == nil && timeout > 0 {
+		budget = timeout
+	}
+	if budget > 2*responseMargin {
+		budget -= responseMargin
+	}
+	return budget
+}
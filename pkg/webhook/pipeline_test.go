@@ -0,0 +1,178 @@
+/*
+Copyright 2019 LitmusChaos Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// slowValidator blocks for the given delay, or until its context is done
+type slowValidator struct {
+	testValidator
+	delay   time.Duration
+	running *int32
+	peak    *int32
+}
+
+func (v *slowValidator) Validate(ctx context.Context, attr *Attributes) error {
+	if v.running != nil {
+		running := atomic.AddInt32(v.running, 1)
+		defer atomic.AddInt32(v.running, -1)
+		for {
+			peak := atomic.LoadInt32(v.peak)
+			if running <= peak || atomic.CompareAndSwapInt32(v.peak, peak, running) {
+				break
+			}
+		}
+	}
+	select {
+	case <-time.After(v.delay):
+		return v.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// panickingValidator fails unexpectedly
+type panickingValidator struct {
+	testValidator
+}
+
+func (v *panickingValidator) Validate(ctx context.Context, attr *Attributes) error {
+	panic("unexpected")
+}
+
+func testAttributes() *Attributes {
+	return &Attributes{
+		Request: &v1beta1.AdmissionRequest{
+			Kind:      metav1.GroupVersionKind{Kind: "ChaosEngine"},
+			Operation: v1beta1.Create,
+		},
+	}
+}
+
+func TestPipelineRun(t *testing.T) {
+	p := newPipeline(4, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	results := p.Run(ctx, testAttributes(), []Validator{
+		&slowValidator{testValidator: testValidator{name: "slow"}, delay: time.Minute},
+		&testValidator{name: "failed", err: fmt.Errorf("failed")},
+		&testValidator{name: "passed"},
+		&panickingValidator{testValidator{name: "panicking"}},
+	})
+
+	var tests = []struct {
+		name         string
+		isErr        bool
+		inconclusive bool
+	}{
+		{name: "slow", isErr: true, inconclusive: true},
+		{name: "failed", isErr: true},
+		{name: "passed"},
+		{name: "panicking", isErr: true},
+	}
+	if len(results) != len(tests) {
+		t.Fatalf("expected %d results, got %d", len(tests), len(results))
+	}
+	for i, test := range tests {
+		result := results[i]
+		if result.Validator.Name() != test.name {
+			t.Fatalf("expected result %d to be of validator %s, got %s", i, test.name, result.Validator.Name())
+		}
+		if (result.Err != nil) != test.isErr {
+			t.Fatalf("validator %s: expected error %v, got %v", test.name, test.isErr, result.Err)
+		}
+		if result.Inconclusive != test.inconclusive {
+			t.Fatalf("validator %s: expected inconclusive to be %v, got %v", test.name, test.inconclusive, result.Inconclusive)
+		}
+	}
+}
+
+func TestPipelineBoundsWorkers(t *testing.T) {
+	var running, peak int32
+	validators := make([]Validator, 0)
+	for i := 0; i < 6; i++ {
+		validators = append(validators, &slowValidator{
+			testValidator: testValidator{name: fmt.Sprintf("v%d", i)},
+			delay:         10 * time.Millisecond,
+			running:       &running,
+			peak:          &peak,
+		})
+	}
+
+	results := newPipeline(2, 0).Run(context.Background(), testAttributes(), validators)
+	for _, result := range results {
+		if result.Err != nil {
+			t.Fatalf("validator %s: expected error to be nil, got %v", result.Validator.Name(), result.Err)
+		}
+	}
+	if peak > 2 {
+		t.Fatalf("expected at most 2 validators to run at once, got %d", peak)
+	}
+}
+
+func TestInconclusivePolicy(t *testing.T) {
+	var tests = []struct {
+		policy        InconclusivePolicy
+		isErrExpected bool
+	}{
+		{policy: InconclusiveAllow, isErrExpected: false},
+		{policy: InconclusiveDeny, isErrExpected: true},
+	}
+	for _, test := range tests {
+		t.Run(string(test.policy), func(t *testing.T) {
+			stopCh := make(chan struct{})
+			defer close(stopCh)
+			webhook := newTestWebhook(t, stopCh, nil, nil)
+			webhook.pipeline = newPipeline(1, 50*time.Millisecond)
+			webhook.inconclusivePolicy = test.policy
+			err := webhook.CollectValidationErrors(context.Background(), testAttributes(),
+				&slowValidator{testValidator: testValidator{name: "slow"}, delay: time.Minute})
+			if (err != nil) != test.isErrExpected {
+				t.Fatalf("Test %q failed: expected error %v, got %v", test.policy, test.isErrExpected, err)
+			}
+		})
+	}
+}
+
+func TestRequestBudget(t *testing.T) {
+	var tests = []struct {
+		url      string
+		expected time.Duration
+	}{
+		{url: "/validate", expected: 5*time.Second - responseMargin},
+		{url: "/validate?timeout=10s", expected: 10*time.Second - responseMargin},
+		{url: "/validate?timeout=invalid", expected: 5*time.Second - responseMargin},
+		{url: "/validate?timeout=500ms", expected: 500 * time.Millisecond},
+	}
+	for _, test := range tests {
+		budget := requestBudget(httptest.NewRequest("POST", test.url, nil))
+		if budget != test.expected {
+			t.Fatalf("%s: expected budget %v, got %v", test.url, test.expected, budget)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2019 The LitmusChaos Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"k8s.io/api/admission/v1beta1"
+)
+
+const (
+	// ServiceAccountEnvVar is the constant for env variable ADMISSION_SERVICE_ACCOUNT
+	// which is the name of the service account the admission server runs with
+	ServiceAccountEnvVar = "ADMISSION_SERVICE_ACCOUNT"
+	// garbageCollectorUser is the identity used by kubernetes to delete
+	// dependents of a removed owner, i.e. our resources once the admission
+	// deployment is gone
+	garbageCollectorUser = "system:serviceaccount:kube-system:generic-garbage-collector"
+)
+
+// protectedResources maps the kinds guarded by the protection webhook to the
+// names of the resources created by InitValidationServer
+var protectedResources = map[string]string{
+	"Secret":  validatorSecret,
+	"Service": validatorServiceName,
+}
+
+// serviceAccountTokenFile is the token of the service account mounted in the
+// pod of the admission server
+var serviceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// serviceAccountUserPrefix prefixes the usernames of the service accounts
+const serviceAccountUserPrefix = "system:serviceaccount:"
+
+// getServiceAccountUser returns the username the admission server authenticates
+// with. It is derived from the ADMISSION_SERVICE_ACCOUNT env, set from
+// spec.serviceAccountName with the downward API, or else read from the subject
+// of the mounted service account token. It fails if neither is available.
+func getServiceAccountUser() (string, error) {
+	if serviceAccount := os.Getenv(ServiceAccountEnvVar); len(serviceAccount) != 0 {
+		namespace, err := getLitmusNamespace()
+		if err != nil {
+			return "", err
+		}
+		return serviceAccountUserPrefix + namespace + ":" + serviceAccount, nil
+	}
+	token, err := ioutil.ReadFile(serviceAccountTokenFile)
+	if err != nil {
+		return "", fmt.Errorf("unable to find the service account of the admission server, %s is not set: %v", ServiceAccountEnvVar, err)
+	}
+	username, err := tokenSubject(strings.TrimSpace(string(token)))
+	if err != nil {
+		return "", fmt.Errorf("unable to read the service account of the admission server from %s: %v", serviceAccountTokenFile, err)
+	}
+	return username, nil
+}
+
+// tokenSubject returns the service account username in the subject of the
+// given JWT, its signature isn't verified
+func tokenSubject(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode token claims: %v", err)
+	}
+	var claims struct {
+		Subject string `json:"sub"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", fmt.Errorf("failed to decode token claims: %v", err)
+	}
+	if !strings.HasPrefix(claims.Subject, serviceAccountUserPrefix) {
+		return "", fmt.Errorf("token subject %q is not a service account", claims.Subject)
+	}
+	return claims.Subject, nil
+}
+
+// isProtectedResource returns true if the request targets one of the
+// resources the webhook depends on
+func isProtectedResource(req *v1beta1.AdmissionRequest, litmusNamespace string) bool {
+	name, ok := protectedResources[req.Kind.Kind]
+	return ok && req.Name == name && req.Namespace == litmusNamespace
+}
+
+// isPrivilegedUser returns true if the requesting user is allowed to modify
+// the resources of the admission controller
+func (wh *webhook) isPrivilegedUser(req *v1beta1.AdmissionRequest) bool {
+	username := req.UserInfo.Username
+	if username == garbageCollectorUser {
+		return true
+	}
+	if wh.serviceAccountUser != "" && username == wh.serviceAccountUser {
+		return true
+	}
+	for _, group := range req.UserInfo.Groups {
+		for _, adminGroup := range wh.adminGroups {
+			if group == adminGroup {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validateProtectedResource denies updates and deletes of the Secret and
+// Service of the admission controller unless they come from
+// the admission controller itself or a member of the configured admin groups.
+func (wh *webhook) validateProtectedResource(req *v1beta1.AdmissionRequest) error {
+	if req.Operation != v1beta1.Update && req.Operation != v1beta1.Delete {
+		return nil
+	}
+	litmusNamespace, err := getLitmusNamespace()
+	if err != nil {
+		requestLogger(req, ResourceProtectionValidator).Error(err, "Unable to protect the resource")
+		return nil
+	}
+	if !isProtectedResource(req, litmusNamespace) || wh.isPrivilegedUser(req) {
+		return nil
+	}
+
+	requestLogger(req, ResourceProtectionValidator).V(2).Info("Denied the modification of a protected resource")
+	return NewFieldError(nil, CodeProtectedResource, "%s %s is managed by the litmus admission controller, %s is not allowed to %s it",
+		req.Kind.Kind, req.Name, req.UserInfo.Username, strings.ToLower(string(req.Operation)))
+}
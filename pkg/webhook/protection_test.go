@@ -0,0 +1,240 @@
+/*
+Copyright 2019 LitmusChaos Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"k8s.io/api/admission/v1beta1"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestValidateProtectedResource(t *testing.T) {
+	os.Setenv("LITMUS_NAMESPACE", litmusNamespace)
+	defer os.Unsetenv("LITMUS_NAMESPACE")
+
+	var tests = []struct {
+		description     string
+		request         v1beta1.AdmissionRequest
+		isAllowExpected bool
+	}{
+		{
+			description: "Deleting the webhook Secret is denied for a namespace user.",
+			request: v1beta1.AdmissionRequest{
+				Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Secret"},
+				Name:      validatorSecret,
+				Namespace: litmusNamespace,
+				Operation: v1beta1.Delete,
+				UserInfo:  authenticationv1.UserInfo{Username: "jane"},
+			},
+			isAllowExpected: false,
+		},
+		{
+			description: "Updating the webhook Service is denied for a namespace user.",
+			request: v1beta1.AdmissionRequest{
+				Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Service"},
+				Name:      validatorServiceName,
+				Namespace: litmusNamespace,
+				Operation: v1beta1.Update,
+				UserInfo:  authenticationv1.UserInfo{Username: "jane"},
+			},
+			isAllowExpected: false,
+		},
+		{
+			description: "Updating the webhook Secret is allowed for the admission controller service account.",
+			request: v1beta1.AdmissionRequest{
+				Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Secret"},
+				Name:      validatorSecret,
+				Namespace: litmusNamespace,
+				Operation: v1beta1.Update,
+				UserInfo:  authenticationv1.UserInfo{Username: "system:serviceaccount:litmus:litmus"},
+			},
+			isAllowExpected: true,
+		},
+		{
+			description: "Deleting the webhook Service is allowed for an admin group member.",
+			request: v1beta1.AdmissionRequest{
+				Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Service"},
+				Name:      validatorServiceName,
+				Namespace: litmusNamespace,
+				Operation: v1beta1.Delete,
+				UserInfo:  authenticationv1.UserInfo{Username: "admin", Groups: []string{"system:masters"}},
+			},
+			isAllowExpected: true,
+		},
+		{
+			description: "Deleting another Secret of the litmus namespace is allowed.",
+			request: v1beta1.AdmissionRequest{
+				Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Secret"},
+				Name:      "other-secret",
+				Namespace: litmusNamespace,
+				Operation: v1beta1.Delete,
+				UserInfo:  authenticationv1.UserInfo{Username: "jane"},
+			},
+			isAllowExpected: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			webhook := webhook{
+				adminGroups:        []string{"system:masters"},
+				serviceAccountUser: "system:serviceaccount:litmus:litmus",
+			}
+			err := webhook.validateProtectedResource(&test.request)
+			if allowed := err == nil; allowed != test.isAllowExpected {
+				t.Fatalf("Test %q failed: expected allowed to be %v, got %v", test.description, test.isAllowExpected, allowed)
+			}
+		})
+	}
+}
+
+func TestGetServiceAccountUser(t *testing.T) {
+	os.Setenv("LITMUS_NAMESPACE", litmusNamespace)
+	defer os.Unsetenv("LITMUS_NAMESPACE")
+	defer func(file string) { serviceAccountTokenFile = file }(serviceAccountTokenFile)
+
+	dir := t.TempDir()
+	tokenFile := func(name string, claims string) string {
+		file := filepath.Join(dir, name)
+		token := "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".c2lnbmF0dXJl\n"
+		if err := ioutil.WriteFile(file, []byte(token), 0600); err != nil {
+			t.Fatalf("failed to write token file: %v", err)
+		}
+		return file
+	}
+
+	var tests = []struct {
+		description      string
+		serviceAccount   string
+		tokenFile        string
+		expectedUsername string
+		isErrorExpected  bool
+	}{
+		{
+			description:      "The service account of the downward API is in the litmus namespace.",
+			serviceAccount:   "litmus",
+			tokenFile:        filepath.Join(dir, "missing"),
+			expectedUsername: "system:serviceaccount:litmus:litmus",
+		},
+		{
+			description:      "Without the env the subject of the mounted token is used.",
+			tokenFile:        tokenFile("token", `{"iss":"kubernetes/serviceaccount","sub":"system:serviceaccount:litmus:admission"}`),
+			expectedUsername: "system:serviceaccount:litmus:admission",
+		},
+		{
+			description:     "A token of another subject is rejected.",
+			tokenFile:       tokenFile("user-token", `{"sub":"jane"}`),
+			isErrorExpected: true,
+		},
+		{
+			description:     "The identity is required.",
+			tokenFile:       filepath.Join(dir, "missing"),
+			isErrorExpected: true,
+		},
+	}
+	for _, test := range tests {
+		os.Setenv(ServiceAccountEnvVar, test.serviceAccount)
+		serviceAccountTokenFile = test.tokenFile
+		username, err := getServiceAccountUser()
+		os.Unsetenv(ServiceAccountEnvVar)
+		if isError := err != nil; isError != test.isErrorExpected {
+			t.Fatalf("Test %q failed: expected error %v, got %v", test.description, test.isErrorExpected, err)
+		}
+		if username != test.expectedUsername {
+			t.Fatalf("Test %q failed: expected username %q, got %q", test.description, test.expectedUsername, username)
+		}
+	}
+}
+
+func TestCreateAdmissionServiceAddsMissingHandlers(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(&admissionregistrationv1beta1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: validatorWebhook},
+		Webhooks: []admissionregistrationv1beta1.ValidatingWebhook{
+			{
+				Name: webhookHandlerName,
+				Rules: []admissionregistrationv1beta1.RuleWithOperations{{
+					Operations: []admissionregistrationv1beta1.OperationType{admissionregistrationv1beta1.Create},
+					Rule: admissionregistrationv1beta1.Rule{
+						APIGroups:   []string{"litmuschaos.io"},
+						APIVersions: []string{"*"},
+						Resources:   []string{"chaosengines"},
+					},
+				}},
+			},
+		},
+	})
+
+	err := createAdmissionService(metav1.OwnerReference{}, validatorWebhook, litmusNamespace, validatorServiceName, []byte{}, kubeClient)
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %v", err)
+	}
+	config, err := GetValidatorWebhook(validatorWebhook, kubeClient)
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %v", err)
+	}
+	expected := getWebhookHandlers(litmusNamespace, validatorServiceName, []byte{})
+	if len(config.Webhooks) != len(expected) || config.Webhooks[1].Name != protectionHandlerName {
+		t.Fatalf("expected the missing webhooks to be registered, got %+v", config.Webhooks)
+	}
+	operations := config.Webhooks[0].Rules[0].Operations
+	if !reflect.DeepEqual(operations, expected[0].Rules[0].Operations) {
+		t.Fatalf("expected the missing operations to be added, got %v", operations)
+	}
+}
+
+func TestCreateAdmissionServiceSetsProtectionFailurePolicy(t *testing.T) {
+	if err := SetProtectionFailurePolicy("Retry"); err == nil {
+		t.Fatalf("expected the unknown failure policy to be rejected")
+	}
+	if err := SetProtectionFailurePolicy(string(admissionregistrationv1beta1.Fail)); err != nil {
+		t.Fatalf("expected error to be nil, got %v", err)
+	}
+	defer SetProtectionFailurePolicy(string(admissionregistrationv1beta1.Ignore))
+
+	registered := getWebhookHandlers(litmusNamespace, validatorServiceName, []byte{})
+	registered[1].FailurePolicy = &Ignore
+	kubeClient := fake.NewSimpleClientset(&admissionregistrationv1beta1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: validatorWebhook},
+		Webhooks:   registered,
+	})
+
+	err := createAdmissionService(metav1.OwnerReference{}, validatorWebhook, litmusNamespace, validatorServiceName, []byte{}, kubeClient)
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %v", err)
+	}
+	config, err := GetValidatorWebhook(validatorWebhook, kubeClient)
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %v", err)
+	}
+	for _, handler := range config.Webhooks {
+		expected := admissionregistrationv1beta1.Ignore
+		if handler.Name == protectionHandlerName {
+			expected = admissionregistrationv1beta1.Fail
+		}
+		if *handler.FailurePolicy != expected {
+			t.Fatalf("expected the failure policy of %s to be %s, got %s", handler.Name, expected, *handler.FailurePolicy)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2019 The LitmusChaos Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/api/admission/v1beta1"
+
+	"github.com/litmuschaos/chaos-operator/pkg/apis/litmuschaos/v1alpha1"
+)
+
+// referencedKinds are the kinds a ChaosEngine depends on while it is active
+var referencedKinds = map[string]bool{
+	"ChaosExperiment": true,
+	"ConfigMap":       true,
+	"Secret":          true,
+}
+
+// referenceKey returns the key a referenced resource is indexed with
+func referenceKey(kind, namespace, name string) string {
+	return strings.Join([]string{kind, namespace, name}, "/")
+}
+
+// engineReferences returns the keys of the ChaosExperiments, ConfigMaps and
+// Secrets used by the given ChaosEngine. They are looked up in the
+// application namespace, same as at creation time.
+func engineReferences(chaosEngine *v1alpha1.ChaosEngine) []string {
+	namespace := chaosEngine.Spec.Appinfo.Appns
+	keys := make([]string, 0)
+	for _, experiment := range chaosEngine.Spec.Experiments {
+		keys = append(keys, referenceKey("ChaosExperiment", namespace, experiment.Name))
+		for _, configMap := range experiment.Spec.Components.ConfigMaps {
+			keys = append(keys, referenceKey("ConfigMap", namespace, configMap.Name))
+		}
+		for _, secret := range experiment.Spec.Components.Secrets {
+			keys = append(keys, referenceKey("Secret", namespace, secret.Name))
+		}
+	}
+	return keys
+}
+
+// isEngineActive returns true if the chaos-operator may still run the
+// experiments of the given ChaosEngine
+func isEngineActive(chaosEngine *v1alpha1.ChaosEngine) bool {
+	if chaosEngine.Spec.EngineState == v1alpha1.EngineStateStop {
+		return false
+	}
+	switch chaosEngine.Status.EngineStatus {
+	case v1alpha1.EngineStatusCompleted, v1alpha1.EngineStatusStopped:
+		return false
+	}
+	return true
+}
+
+// referencingEngines returns the namespaced names of the active ChaosEngines
+// that use the resource identified by the given key, looked up in the
+// references index of the chaosengine informer
+func (wh *webhook) referencingEngines(key string) ([]string, error) {
+	chaosEngines, err := wh.cache.chaosEngineInformer.GetIndexer().ByIndex(referencesIndex, key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to lookup chaosengines, please check the following error: %v", err)
+	}
+
+	names := make([]string, 0)
+	for _, obj := range chaosEngines {
+		chaosEngine := obj.(*v1alpha1.ChaosEngine)
+		names = append(names, chaosEngine.Namespace+"/"+chaosEngine.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// validateReferencedResource denies the deletion of a ChaosExperiment,
+// ConfigMap or Secret while an active ChaosEngine still uses it.
+func (wh *webhook) validateReferencedResource(req *v1beta1.AdmissionRequest) error {
+	if req.Operation != v1beta1.Delete || !referencedKinds[req.Kind.Kind] {
+		return nil
+	}
+
+	engines, err := wh.referencingEngines(referenceKey(req.Kind.Kind, req.Namespace, req.Name))
+	if err != nil {
+		requestLogger(req, ActiveReferencesValidator).Error(err, "Unable to check the references to the resource")
+		return nil
+	}
+	if len(engines) == 0 {
+		return nil
+	}
+
+	requestLogger(req, ActiveReferencesValidator).V(2).Info("Denied the deletion of a resource used by active ChaosEngines", "chaosEngines", engines)
+	return NewFieldError(nil, CodeResourceInUse, "%s %s is still used by the active ChaosEngine %s, stop the ChaosEngine before deleting it",
+		req.Kind.Kind, req.Name, strings.Join(engines, ", "))
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2019 LitmusChaos Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/litmuschaos/chaos-operator/pkg/apis/litmuschaos/v1alpha1"
+	"k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestValidateReferencedResource(t *testing.T) {
+	newEngine := func(name string, state v1alpha1.EngineState) *v1alpha1.ChaosEngine {
+		return &v1alpha1.ChaosEngine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: litmusNamespace,
+			},
+			Spec: v1alpha1.ChaosEngineSpec{
+				Appinfo: v1alpha1.ApplicationParams{
+					Appns: testNamespace,
+				},
+				EngineState: state,
+				Experiments: []v1alpha1.ExperimentList{
+					{
+						Name: "pod-delete",
+						Spec: v1alpha1.ExperimentAttributes{
+							Components: v1alpha1.ExperimentComponents{
+								ConfigMaps: []v1alpha1.ConfigMap{{Name: "configmap-1"}},
+								Secrets:    []v1alpha1.Secret{{Name: "secret-1"}},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	var tests = []struct {
+		description     string
+		litmusObjects   []runtime.Object
+		kind            string
+		name            string
+		isAllowExpected bool
+	}{
+		{
+			description:     "Deleting a ConfigMap used by an active ChaosEngine is denied.",
+			litmusObjects:   []runtime.Object{newEngine("engine-1", v1alpha1.EngineStateActive)},
+			kind:            "ConfigMap",
+			name:            "configmap-1",
+			isAllowExpected: false,
+		},
+		{
+			description:     "Deleting a Secret used by an active ChaosEngine is denied.",
+			litmusObjects:   []runtime.Object{newEngine("engine-1", v1alpha1.EngineStateActive)},
+			kind:            "Secret",
+			name:            "secret-1",
+			isAllowExpected: false,
+		},
+		{
+			description:     "Deleting a ChaosExperiment used by an active ChaosEngine is denied.",
+			litmusObjects:   []runtime.Object{newEngine("engine-1", "")},
+			kind:            "ChaosExperiment",
+			name:            "pod-delete",
+			isAllowExpected: false,
+		},
+		{
+			description:     "Deleting a ConfigMap used by a stopped ChaosEngine is allowed.",
+			litmusObjects:   []runtime.Object{newEngine("engine-1", v1alpha1.EngineStateStop)},
+			kind:            "ConfigMap",
+			name:            "configmap-1",
+			isAllowExpected: true,
+		},
+		{
+			description:     "Deleting a ConfigMap no ChaosEngine uses is allowed.",
+			litmusObjects:   []runtime.Object{newEngine("engine-1", v1alpha1.EngineStateActive)},
+			kind:            "ConfigMap",
+			name:            "configmap-2",
+			isAllowExpected: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			stopCh := make(chan struct{})
+			defer close(stopCh)
+			webhook := newTestWebhook(t, stopCh, nil, test.litmusObjects)
+			err := webhook.validateReferencedResource(&v1beta1.AdmissionRequest{
+				Kind:      metav1.GroupVersionKind{Kind: test.kind},
+				Name:      test.name,
+				Namespace: testNamespace,
+				Operation: v1beta1.Delete,
+			})
+			if allowed := err == nil; allowed != test.isAllowExpected {
+				t.Fatalf("Test %q failed: expected allowed to be %v, got %v", test.description, test.isAllowExpected, allowed)
+			}
+			if err != nil && !strings.Contains(err.Error(), "engine-1") {
+				t.Fatalf("Test %q failed: expected the denial to name the ChaosEngine, got %q", test.description, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,364 @@
+/*
+Copyright 2019 The LitmusChaos Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"k8s.io/api/admissionregistration/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/yaml"
+
+	version "github.com/litmuschaos/admission-controllers/pkg/version"
+)
+
+// DefaultOperations are the ChaosEngine operations sent to the webhook by
+// default. Leaving out UPDATE lets engines be retargeted once created.
+var DefaultOperations = []string{string(v1beta1.Create), string(v1beta1.Update)}
+
+// RenderOptions configure the manifests written by Render
+type RenderOptions struct {
+	// Namespace is the namespace of the admission controller
+	Namespace string
+	// Name is the name of the Deployment, ServiceAccount and RBAC resources
+	Name string
+	// Image is the image of the admission controller
+	Image string
+	// Operations are the ChaosEngine operations sent to the webhook
+	Operations []string
+	// FailurePolicy is Ignore or Fail, for the webhooks but the protection
+	// one
+	FailurePolicy string
+	// ProtectionFailurePolicy is Ignore or Fail, for the protection webhook
+	ProtectionFailurePolicy string
+	// TimeoutSeconds is the timeout of the webhook calls
+	TimeoutSeconds int32
+	// Certificates mints a self-signed CA and serving certificate into the
+	// Secret, with the CA in the caBundle of the webhooks. Otherwise the
+	// Secret and the caBundle are left to the user.
+	Certificates bool
+	// Rotation keeps the renewal of the certificates in the Secret and the
+	// sync of the caBundle, which then differ from the rendered manifests.
+	// Otherwise both are disabled and the Secret and caBundle are only read.
+	Rotation bool
+	// CSR requests the serving certificate from the signer of the cluster,
+	// with rotation, and grants the CertificateSigningRequests
+	CSR bool
+	// CSRAutoApprove approves the CertificateSigningRequests, with CSR
+	CSRAutoApprove bool
+	// Args are added to the arguments of the admission controller
+	Args []string
+}
+
+// Render writes as YAML all the objects the admission controller needs when
+// it runs with -skipBootstrap, i.e. for GitOps. The Service, Secret and
+// webhook configuration keep the names the admission controller looks for.
+func Render(w io.Writer, opts RenderOptions) error {
+	objects, err := renderObjects(opts)
+	if err != nil {
+		return err
+	}
+	for i, object := range objects {
+		data, err := yaml.Marshal(object)
+		if err != nil {
+			return fmt.Errorf("failed to encode %T: %v", object, err)
+		}
+		if i > 0 {
+			if _, err := io.WriteString(w, "---\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderObjects returns the objects written by Render
+func renderObjects(opts RenderOptions) ([]runtime.Object, error) {
+	if opts.Namespace == "" || opts.Name == "" {
+		return nil, fmt.Errorf("namespace and name must be set")
+	}
+	if opts.CSR && !opts.Rotation {
+		return nil, fmt.Errorf("certificate signing requests require rotation")
+	}
+	if opts.CSRAutoApprove && !opts.CSR {
+		return nil, fmt.Errorf("auto approval requires certificate signing requests")
+	}
+	handlers := getWebhookHandlers(opts.Namespace, validatorServiceName, nil)
+	if err := configureHandlers(handlers, opts); err != nil {
+		return nil, err
+	}
+
+	objects := []runtime.Object{
+		renderServiceAccount(opts),
+		renderClusterRole(opts),
+		renderClusterRoleBinding(opts),
+	}
+	if opts.Certificates {
+		secret, err := newCertsSecret(validatorSecret, validatorServiceName, opts.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		for i := range handlers {
+			handlers[i].ClientConfig.CABundle = secret.Data[rootCrt]
+		}
+		objects = append(objects, secret)
+	}
+	objects = append(objects,
+		newWebhookService(validatorServiceName, opts.Namespace),
+		renderDeployment(opts),
+		newValidatorWebhook(validatorWebhook, handlers),
+	)
+	return objects, nil
+}
+
+// configureHandlers applies the operations, failure policy and timeout of the
+// options to the given webhooks
+func configureHandlers(handlers []v1beta1.ValidatingWebhook, opts RenderOptions) error {
+	var operations []v1beta1.OperationType
+	for _, operation := range opts.Operations {
+		switch op := v1beta1.OperationType(strings.ToUpper(operation)); op {
+		case v1beta1.Create, v1beta1.Update:
+			operations = append(operations, op)
+		default:
+			return fmt.Errorf("unknown ChaosEngine operation %s, expected CREATE or UPDATE", operation)
+		}
+	}
+	var failurePolicy, protectionPolicy *v1beta1.FailurePolicyType
+	if opts.FailurePolicy != "" {
+		policy, err := parseFailurePolicy(opts.FailurePolicy)
+		if err != nil {
+			return err
+		}
+		failurePolicy = &policy
+	}
+	if opts.ProtectionFailurePolicy != "" {
+		policy, err := parseFailurePolicy(opts.ProtectionFailurePolicy)
+		if err != nil {
+			return err
+		}
+		protectionPolicy = &policy
+	}
+	if opts.TimeoutSeconds < 0 || opts.TimeoutSeconds > 30 {
+		return fmt.Errorf("webhook timeout must be between 1 and 30 seconds, got %d", opts.TimeoutSeconds)
+	}
+
+	for i := range handlers {
+		if handlers[i].Name == webhookHandlerName && len(operations) != 0 {
+			handlers[i].Rules[0].Operations = operations
+		}
+		if handlers[i].Name == protectionHandlerName {
+			if protectionPolicy != nil {
+				handlers[i].FailurePolicy = protectionPolicy
+			}
+		} else if failurePolicy != nil {
+			handlers[i].FailurePolicy = failurePolicy
+		}
+		if opts.TimeoutSeconds != 0 {
+			timeout := opts.TimeoutSeconds
+			handlers[i].TimeoutSeconds = &timeout
+		}
+	}
+	return nil
+}
+
+// renderLabels are the labels of the rendered objects, besides the Service,
+// Secret and webhook configuration
+func renderLabels() map[string]string {
+	return map[string]string{
+		"app":                           "admission-controller",
+		"litmuschaos.io/component-name": "admission-controller",
+		string(litmuschaosVersion):      version.Current(),
+	}
+}
+
+func renderServiceAccount(opts RenderOptions) *corev1.ServiceAccount {
+	return &corev1.ServiceAccount{
+		TypeMeta: metav1.TypeMeta{Kind: "ServiceAccount", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      opts.Name,
+			Namespace: opts.Namespace,
+			Labels:    renderLabels(),
+		},
+	}
+}
+
+// renderClusterRole grants what the admission controller reads for its
+// validations and revalidation, it creates nothing with -skipBootstrap and
+// only updates the Secret and the webhook configuration with rotation
+func renderClusterRole(opts RenderOptions) *rbacv1.ClusterRole {
+	read := []string{"get", "list", "watch"}
+	// the readiness probe reads the webhook configuration
+	webhookVerbs := []string{"get"}
+	rules := []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"namespaces", "configmaps", "secrets", "services"}, Verbs: read},
+		{APIGroups: []string{"apps"}, Resources: []string{"deployments", "statefulsets", "daemonsets"}, Verbs: read},
+		{APIGroups: []string{"litmuschaos.io"}, Resources: []string{"chaosexperiments"}, Verbs: read},
+		{APIGroups: []string{"litmuschaos.io"}, Resources: []string{"chaosengines"}, Verbs: append(read, "patch")},
+		{APIGroups: []string{""}, Resources: []string{"events"}, Verbs: []string{"create", "patch"}},
+	}
+	if opts.Rotation {
+		// the serving certificate is renewed in the Secret, along with
+		// the caBundle when its CA is replaced
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups:     []string{""},
+			Resources:     []string{"secrets"},
+			ResourceNames: []string{validatorSecret},
+			Verbs:         []string{"update"},
+		})
+		webhookVerbs = append(webhookVerbs, "update")
+	}
+	if opts.CSR {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{"certificates.k8s.io"},
+			Resources: []string{"certificatesigningrequests"},
+			Verbs:     []string{"create", "get", "list", "delete"},
+		})
+	}
+	if opts.CSRAutoApprove {
+		rules = append(rules,
+			rbacv1.PolicyRule{
+				APIGroups: []string{"certificates.k8s.io"},
+				Resources: []string{"certificatesigningrequests/approval"},
+				Verbs:     []string{"update"},
+			},
+			rbacv1.PolicyRule{
+				APIGroups:     []string{"certificates.k8s.io"},
+				Resources:     []string{"signers"},
+				ResourceNames: []string{csrSigner},
+				Verbs:         []string{"approve"},
+			},
+		)
+	}
+	rules = append(rules, rbacv1.PolicyRule{
+		APIGroups:     []string{"admissionregistration.k8s.io"},
+		Resources:     []string{"validatingwebhookconfigurations"},
+		ResourceNames: []string{validatorWebhook},
+		Verbs:         webhookVerbs,
+	})
+	return &rbacv1.ClusterRole{
+		TypeMeta: metav1.TypeMeta{Kind: "ClusterRole", APIVersion: "rbac.authorization.k8s.io/v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   opts.Name,
+			Labels: renderLabels(),
+		},
+		Rules: rules,
+	}
+}
+
+func renderClusterRoleBinding(opts RenderOptions) *rbacv1.ClusterRoleBinding {
+	return &rbacv1.ClusterRoleBinding{
+		TypeMeta: metav1.TypeMeta{Kind: "ClusterRoleBinding", APIVersion: "rbac.authorization.k8s.io/v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   opts.Name,
+			Labels: renderLabels(),
+		},
+		RoleRef: rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: opts.Name},
+		Subjects: []rbacv1.Subject{
+			{Kind: "ServiceAccount", Name: opts.Name, Namespace: opts.Namespace},
+		},
+	}
+}
+
+func renderDeployment(opts RenderOptions) *appsv1.Deployment {
+	replicas := int32(1)
+	labels := renderLabels()
+	probe := func(path string, period int32) *corev1.Probe {
+		return &corev1.Probe{
+			Handler: corev1.Handler{
+				HTTPGet: &corev1.HTTPGetAction{
+					Path:   path,
+					Port:   intstr.FromString("webhook"),
+					Scheme: corev1.URISchemeHTTPS,
+				},
+			},
+			PeriodSeconds:  period,
+			TimeoutSeconds: 5,
+		}
+	}
+	liveness := probe("/healthz", 20)
+	liveness.InitialDelaySeconds = 30
+	liveness.FailureThreshold = 3
+	args := []string{"-skipBootstrap"}
+	if !opts.Rotation {
+		// the Secret and the caBundle stay as applied from the manifests
+		args = append(args, "-certCheckInterval=0", "-caBundleSyncInterval=0")
+	}
+	if opts.CSR {
+		args = append(args, "-csr")
+	}
+	if opts.CSRAutoApprove {
+		args = append(args, "-csrAutoApprove")
+	}
+
+	return &appsv1.Deployment{
+		TypeMeta: metav1.TypeMeta{Kind: "Deployment", APIVersion: "apps/v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      opts.Name,
+			Namespace: opts.Namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "admission-controller"}},
+			Strategy: appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+					Annotations: map[string]string{
+						"prometheus.io/scrape": "true",
+						"prometheus.io/port":   "8080",
+						"prometheus.io/path":   "/metrics",
+					},
+				},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: opts.Name,
+					Containers: []corev1.Container{{
+						Name:  "admission-controller",
+						Image: opts.Image,
+						Args:  append(args, opts.Args...),
+						Ports: []corev1.ContainerPort{
+							{Name: "webhook", ContainerPort: validationPort},
+							{Name: "metrics", ContainerPort: 8080},
+						},
+						Env: []corev1.EnvVar{
+							{
+								Name:      "LITMUS_NAMESPACE",
+								ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"}},
+							},
+							{
+								Name:      ServiceAccountEnvVar,
+								ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "spec.serviceAccountName"}},
+							},
+						},
+						LivenessProbe:  liveness,
+						ReadinessProbe: probe("/readyz", 10),
+					}},
+				},
+			},
+		},
+	}
+}
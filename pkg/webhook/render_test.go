@@ -0,0 +1,196 @@
+/*
+Copyright 2019 LitmusChaos Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"testing"
+
+	"k8s.io/api/admissionregistration/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	kubescheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+func TestRender(t *testing.T) {
+	var tests = []struct {
+		description              string
+		opts                     RenderOptions
+		expectedKinds            []string
+		expectedOperations       []v1beta1.OperationType
+		expectedPolicy           v1beta1.FailurePolicyType
+		expectedProtectionPolicy v1beta1.FailurePolicyType
+		expectedArgs             []string
+		isUpdateExpected         bool
+		isApproveExpected        bool
+		isErrorExpected          bool
+	}{
+		{
+			description:              "The Secret is left to the user by default.",
+			opts:                     RenderOptions{Namespace: litmusNamespace, Name: "admission"},
+			expectedKinds:            []string{"ServiceAccount", "ClusterRole", "ClusterRoleBinding", "Service", "Deployment", "ValidatingWebhookConfiguration"},
+			expectedOperations:       []v1beta1.OperationType{v1beta1.Create, v1beta1.Update},
+			expectedPolicy:           v1beta1.Ignore,
+			expectedProtectionPolicy: v1beta1.Ignore,
+			expectedArgs:             []string{"-skipBootstrap", "-certCheckInterval=0", "-caBundleSyncInterval=0"},
+		},
+		{
+			description: "Minted certificates are rendered along with the rules.",
+			opts: RenderOptions{Namespace: litmusNamespace, Name: "admission", Certificates: true,
+				Operations: []string{"create", "update"}, FailurePolicy: "Fail", ProtectionFailurePolicy: "Fail", TimeoutSeconds: 10},
+			expectedKinds:            []string{"ServiceAccount", "ClusterRole", "ClusterRoleBinding", "Secret", "Service", "Deployment", "ValidatingWebhookConfiguration"},
+			expectedOperations:       []v1beta1.OperationType{v1beta1.Create, v1beta1.Update},
+			expectedPolicy:           v1beta1.Fail,
+			expectedProtectionPolicy: v1beta1.Fail,
+			expectedArgs:             []string{"-skipBootstrap", "-certCheckInterval=0", "-caBundleSyncInterval=0"},
+		},
+		{
+			description: "Rotation keeps the renewal and is granted the updates.",
+			opts: RenderOptions{Namespace: litmusNamespace, Name: "admission", Certificates: true, Rotation: true,
+				Args: []string{"-v=2"}},
+			expectedKinds:            []string{"ServiceAccount", "ClusterRole", "ClusterRoleBinding", "Secret", "Service", "Deployment", "ValidatingWebhookConfiguration"},
+			expectedOperations:       []v1beta1.OperationType{v1beta1.Create, v1beta1.Update},
+			expectedPolicy:           v1beta1.Ignore,
+			expectedProtectionPolicy: v1beta1.Ignore,
+			expectedArgs:             []string{"-skipBootstrap", "-v=2"},
+			isUpdateExpected:         true,
+		},
+		{
+			description:              "Certificate signing requests are granted with the option.",
+			opts:                     RenderOptions{Namespace: litmusNamespace, Name: "admission", Rotation: true, CSR: true, CSRAutoApprove: true},
+			expectedKinds:            []string{"ServiceAccount", "ClusterRole", "ClusterRoleBinding", "Service", "Deployment", "ValidatingWebhookConfiguration"},
+			expectedOperations:       []v1beta1.OperationType{v1beta1.Create, v1beta1.Update},
+			expectedPolicy:           v1beta1.Ignore,
+			expectedProtectionPolicy: v1beta1.Ignore,
+			expectedArgs:             []string{"-skipBootstrap", "-csr", "-csrAutoApprove"},
+			isUpdateExpected:         true,
+			isApproveExpected:        true,
+		},
+		{
+			description:              "The default operations of the render command validate updates.",
+			opts:                     RenderOptions{Namespace: litmusNamespace, Name: "admission", Operations: DefaultOperations},
+			expectedKinds:            []string{"ServiceAccount", "ClusterRole", "ClusterRoleBinding", "Service", "Deployment", "ValidatingWebhookConfiguration"},
+			expectedOperations:       []v1beta1.OperationType{v1beta1.Create, v1beta1.Update},
+			expectedPolicy:           v1beta1.Ignore,
+			expectedProtectionPolicy: v1beta1.Ignore,
+			expectedArgs:             []string{"-skipBootstrap", "-certCheckInterval=0", "-caBundleSyncInterval=0"},
+		},
+		{
+			description:     "Certificate signing requests require rotation.",
+			opts:            RenderOptions{Namespace: litmusNamespace, Name: "admission", CSR: true},
+			isErrorExpected: true,
+		},
+		{
+			description:     "Unknown operations are rejected.",
+			opts:            RenderOptions{Namespace: litmusNamespace, Name: "admission", Operations: []string{"DELETE"}},
+			isErrorExpected: true,
+		},
+		{
+			description:     "Unknown failure policies are rejected.",
+			opts:            RenderOptions{Namespace: litmusNamespace, Name: "admission", FailurePolicy: "Retry"},
+			isErrorExpected: true,
+		},
+		{
+			description:     "Unknown protection failure policies are rejected.",
+			opts:            RenderOptions{Namespace: litmusNamespace, Name: "admission", ProtectionFailurePolicy: "Retry"},
+			isErrorExpected: true,
+		},
+	}
+	for _, test := range tests {
+		var output bytes.Buffer
+		err := Render(&output, test.opts)
+		if isError := err != nil; isError != test.isErrorExpected {
+			t.Fatalf("Test %q failed: expected error %v, got %v", test.description, test.isErrorExpected, err)
+		}
+		if err != nil {
+			continue
+		}
+
+		var (
+			kinds      []string
+			secret     *corev1.Secret
+			config     *v1beta1.ValidatingWebhookConfiguration
+			deployment *appsv1.Deployment
+			role       *rbacv1.ClusterRole
+		)
+		decoder := yaml.NewYAMLOrJSONDecoder(&output, 4096)
+		for {
+			var raw map[string]interface{}
+			if err := decoder.Decode(&raw); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("Test %q failed: invalid YAML: %v", test.description, err)
+			}
+			data, _ := json.Marshal(raw)
+			obj, _, err := kubescheme.Codecs.UniversalDeserializer().Decode(data, nil, nil)
+			if err != nil {
+				t.Fatalf("Test %q failed: failed to decode %v: %v", test.description, raw["kind"], err)
+			}
+			kinds = append(kinds, obj.GetObjectKind().GroupVersionKind().Kind)
+			switch o := obj.(type) {
+			case *corev1.Secret:
+				secret = o
+			case *v1beta1.ValidatingWebhookConfiguration:
+				config = o
+			case *appsv1.Deployment:
+				deployment = o
+			case *rbacv1.ClusterRole:
+				role = o
+			}
+		}
+
+		if !reflect.DeepEqual(kinds, test.expectedKinds) {
+			t.Fatalf("Test %q failed: expected kinds %v, got %v", test.description, test.expectedKinds, kinds)
+		}
+		if args := deployment.Spec.Template.Spec.Containers[0].Args; !reflect.DeepEqual(args, test.expectedArgs) {
+			t.Fatalf("Test %q failed: expected args %v, got %v", test.description, test.expectedArgs, args)
+		}
+		isUpdate, isApprove := false, false
+		for _, rule := range role.Rules {
+			for _, verb := range rule.Verbs {
+				isUpdate = isUpdate || verb == "update" && rule.Resources[0] != "certificatesigningrequests/approval"
+				isApprove = isApprove || verb == "approve" && reflect.DeepEqual(rule.ResourceNames, []string{csrSigner})
+			}
+		}
+		if isUpdate != test.isUpdateExpected {
+			t.Fatalf("Test %q failed: expected update granted %v, got %v", test.description, test.isUpdateExpected, isUpdate)
+		}
+		if isApprove != test.isApproveExpected {
+			t.Fatalf("Test %q failed: expected approve granted %v, got %v", test.description, test.isApproveExpected, isApprove)
+		}
+		for _, handler := range config.Webhooks {
+			expectedPolicy := test.expectedPolicy
+			if handler.Name == protectionHandlerName {
+				expectedPolicy = test.expectedProtectionPolicy
+			}
+			if *handler.FailurePolicy != expectedPolicy {
+				t.Fatalf("Test %q failed: expected failure policy of %s %s, got %s", test.description, handler.Name, expectedPolicy, *handler.FailurePolicy)
+			}
+			if secret != nil && !bytes.Equal(handler.ClientConfig.CABundle, secret.Data[rootCrt]) {
+				t.Fatalf("Test %q failed: expected the caBundle of %s to hold the rendered CA", test.description, handler.Name)
+			}
+			if handler.Name == webhookHandlerName && !reflect.DeepEqual(handler.Rules[0].Operations, test.expectedOperations) {
+				t.Fatalf("Test %q failed: expected operations %v, got %v", test.description, test.expectedOperations, handler.Rules[0].Operations)
+			}
+		}
+	}
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2019 The LitmusChaos Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ReportFormat is the format of the verdicts of a manifest validation
+type ReportFormat string
+
+const (
+	// ReportFormatText writes a line per manifest followed by its failures
+	ReportFormatText ReportFormat = "text"
+	// ReportFormatJSON writes the verdicts as a JSON array
+	ReportFormatJSON ReportFormat = "json"
+	// ReportFormatJUnit writes a JUnit XML test suite with a test case per
+	// manifest, for CI systems
+	ReportFormatJUnit ReportFormat = "junit"
+)
+
+// ParseReportFormat returns the ReportFormat with the given name
+func ParseReportFormat(format string) (ReportFormat, error) {
+	switch f := ReportFormat(format); f {
+	case ReportFormatText, ReportFormatJSON, ReportFormatJUnit:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown output format %s, expected %s, %s or %s", format, ReportFormatText, ReportFormatJSON, ReportFormatJUnit)
+}
+
+// WriteVerdicts writes the verdicts in the given format
+func WriteVerdicts(w io.Writer, format ReportFormat, verdicts []Verdict) error {
+	switch format {
+	case ReportFormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if verdicts == nil {
+			verdicts = []Verdict{}
+		}
+		return encoder.Encode(verdicts)
+	case ReportFormatJUnit:
+		return writeJUnit(w, verdicts)
+	}
+	return writeText(w, verdicts)
+}
+
+// verdictName identifies the manifest of a verdict in the reports
+func verdictName(v Verdict) string {
+	name := v.Kind + " " + v.Name
+	if v.Namespace != "" {
+		name = v.Kind + " " + v.Namespace + "/" + v.Name
+	}
+	return name
+}
+
+func writeText(w io.Writer, verdicts []Verdict) error {
+	denied, skipped := 0, 0
+	for _, v := range verdicts {
+		switch {
+		case v.Skipped():
+			skipped++
+		case !v.Allowed():
+			denied++
+		}
+		if _, err := fmt.Fprintf(w, "%s: %s %s\n", v.File, verdictName(v), v.Decision); err != nil {
+			return err
+		}
+		if v.Message != "" {
+			if _, err := fmt.Fprintf(w, "  %s\n", v.Message); err != nil {
+				return err
+			}
+		}
+		for _, warning := range v.Warnings {
+			if _, err := fmt.Fprintf(w, "  warning: %s\n", warning); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d manifests validated, %d denied, %d skipped\n", len(verdicts)-skipped, denied, skipped)
+	return err
+}
+
+// junitTestSuite is the JUnit XML report of a manifest validation
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+func writeJUnit(w io.Writer, verdicts []Verdict) error {
+	suite := junitTestSuite{Name: "litmus-admission-controller", Tests: len(verdicts)}
+	var total time.Duration
+	for _, v := range verdicts {
+		var elapsed time.Duration
+		var failures []string
+		for _, validator := range v.Validators {
+			if d, err := time.ParseDuration(validator.Duration); err == nil {
+				elapsed += d
+			}
+			if validator.Result != resultPassed {
+				failures = append(failures, fmt.Sprintf("%s (%s): %s", validator.Name, validator.Result, validator.Message))
+			}
+		}
+		total += elapsed
+		testCase := junitTestCase{
+			Name:      verdictName(v),
+			ClassName: v.File,
+			Time:      fmt.Sprintf("%.3f", elapsed.Seconds()),
+			SystemOut: strings.Join(v.Warnings, "\n"),
+		}
+		switch v.Decision {
+		case resultDenied:
+			suite.Failures++
+			testCase.Failure = &junitFailure{Message: v.Message, Type: resultDenied, Text: strings.Join(failures, "\n")}
+		case resultError:
+			suite.Errors++
+			testCase.Error = &junitFailure{Message: v.Message, Type: resultError, Text: strings.Join(failures, "\n")}
+		case verdictSkipped:
+			suite.Skipped++
+			testCase.Skipped = &junitSkipped{Message: v.Message}
+		}
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+	suite.Time = fmt.Sprintf("%.3f", total.Seconds())
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suite); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
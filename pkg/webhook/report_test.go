@@ -0,0 +1,88 @@
+/*
+Copyright 2019 LitmusChaos Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestWriteVerdicts(t *testing.T) {
+	verdicts := []Verdict{
+		{
+			File: "engines.yaml", Kind: "ChaosEngine", Namespace: testNamespace, Name: "allowed", Decision: resultAllowed,
+			Validators: []ValidatorRecord{{Name: ChaosTargetValidator, Result: resultPassed, Duration: "1ms"}},
+		},
+		{
+			File: "engines.yaml", Kind: "ChaosEngine", Namespace: testNamespace, Name: "denied", Decision: resultDenied,
+			Message: "unable to find deployment",
+			Validators: []ValidatorRecord{
+				{Name: ChaosTargetValidator, Result: resultFailed, Message: "unable to find deployment", Duration: "1ms"},
+			},
+		},
+		{
+			File: "experiments.yaml", Kind: "ChaosExperiment", Namespace: testNamespace, Name: "pod-delete", Decision: verdictSkipped,
+			Message: "no validator runs against ChaosExperiments", Validators: []ValidatorRecord{},
+		},
+	}
+
+	var tests = []struct {
+		description string
+		format      ReportFormat
+		check       func(output []byte) bool
+	}{
+		{
+			description: "The text report lists the manifests and the failures.",
+			format:      ReportFormatText,
+			check: func(output []byte) bool {
+				text := string(output)
+				return strings.Contains(text, "ChaosEngine test-ns/denied denied\n  unable to find deployment") &&
+					strings.Contains(text, "ChaosExperiment test-ns/pod-delete skipped") &&
+					strings.Contains(text, "2 manifests validated, 1 denied, 1 skipped")
+			},
+		},
+		{
+			description: "The JSON report holds the verdicts.",
+			format:      ReportFormatJSON,
+			check: func(output []byte) bool {
+				var decoded []Verdict
+				return json.Unmarshal(output, &decoded) == nil && len(decoded) == 3 && !decoded[1].Allowed() && decoded[2].Skipped()
+			},
+		},
+		{
+			description: "The JUnit report fails the test case of the denied manifest and skips the other kinds.",
+			format:      ReportFormatJUnit,
+			check: func(output []byte) bool {
+				suite := junitTestSuite{}
+				return xml.Unmarshal(output, &suite) == nil && suite.Tests == 3 && suite.Failures == 1 && suite.Skipped == 1 &&
+					suite.TestCases[0].Failure == nil && suite.TestCases[1].Failure != nil && suite.TestCases[2].Skipped != nil
+			},
+		},
+	}
+	for _, test := range tests {
+		var output bytes.Buffer
+		if err := WriteVerdicts(&output, test.format, verdicts); err != nil {
+			t.Fatalf("Test %q failed: %v", test.description, err)
+		}
+		if !test.check(output.Bytes()) {
+			t.Fatalf("Test %q failed: unexpected report %s", test.description, output.String())
+		}
+	}
+}
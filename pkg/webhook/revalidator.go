@@ -0,0 +1,315 @@
+/*
+Copyright 2019 The LitmusChaos Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"k8s.io/api/admission/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serror "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/litmuschaos/chaos-operator/pkg/apis/litmuschaos/v1alpha1"
+	litmusscheme "github.com/litmuschaos/chaos-operator/pkg/client/clientset/versioned/scheme"
+	litmuslisters "github.com/litmuschaos/chaos-operator/pkg/client/listers/litmuschaos/v1alpha1"
+)
+
+const (
+	// ValidationAnnotationKey is set on the ChaosEngines which no longer pass
+	// validation, its value holds the reasons of the failure
+	ValidationAnnotationKey = "litmuschaos.io/validation"
+	// revalidatorComponent is the source of the events emitted on ChaosEngines
+	revalidatorComponent = "litmus-admission-controller"
+	// invalidPrefix prefixes the value of the validation annotation
+	invalidPrefix = "invalid: "
+)
+
+// Revalidator re-runs the ChaosEngine validations against the engines already
+// present in the cluster, on every change of an engine, on every new, deleted
+// or relabelled workload of its application namespace and on every change of
+// their pod template, and after every interval.
+type Revalidator struct {
+	wh       *webhook
+	lister   litmuslisters.ChaosEngineLister
+	indexer  cache.Indexer
+	queue    workqueue.RateLimitingInterface
+	recorder record.EventRecorder
+	interval time.Duration
+}
+
+// NewRevalidator returns a Revalidator which validates all ChaosEngines again
+// after every interval. It reads from the informers of the webhook.
+func NewRevalidator(wh *webhook, interval time.Duration) *Revalidator {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartLogging(func(format string, args ...interface{}) {
+		Logger(SubsystemRevalidation).V(4).Info(fmt.Sprintf(format, args...))
+	})
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: wh.kubeClient.CoreV1().Events("")})
+
+	r := &Revalidator{
+		wh:       wh,
+		lister:   wh.cache.chaosEngines,
+		indexer:  wh.cache.chaosEngineInformer.GetIndexer(),
+		queue:    workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "chaosengines"),
+		recorder: broadcaster.NewRecorder(litmusscheme.Scheme, corev1.EventSource{Component: revalidatorComponent}),
+		interval: interval,
+	}
+	wh.cache.chaosEngineInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: r.enqueue,
+		UpdateFunc: func(old, new interface{}) {
+			if chaosEngineChanged(old, new) {
+				r.enqueue(new)
+			}
+		},
+	})
+	for _, informer := range wh.cache.workloadInformers {
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: r.enqueueNamespace,
+			UpdateFunc: func(old, new interface{}) {
+				if workloadChanged(old, new) {
+					r.enqueueNamespace(new)
+				}
+			},
+			DeleteFunc: r.enqueueNamespace,
+		})
+	}
+	return r
+}
+
+// enqueue adds the key of a ChaosEngine to the work queue
+func (r *Revalidator) enqueue(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	r.queue.Add(key)
+}
+
+// enqueueNamespace adds the ChaosEngines targeting the namespace of the given
+// workload to the work queue
+func (r *Revalidator) enqueueNamespace(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	workload, err := meta.Accessor(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	chaosEngines, err := r.indexer.ByIndex(appNamespaceIndex, workload.GetNamespace())
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	for _, chaosEngine := range chaosEngines {
+		r.enqueue(chaosEngine)
+	}
+}
+
+// chaosEngineChanged tells whether the spec of a ChaosEngine changed, the
+// validations don't read the rest of it. Its status and the validation
+// annotation set by the Revalidator don't trigger a revalidation.
+func chaosEngineChanged(old, new interface{}) bool {
+	oldEngine, ok := old.(*v1alpha1.ChaosEngine)
+	if !ok {
+		return true
+	}
+	newEngine, ok := new.(*v1alpha1.ChaosEngine)
+	if !ok {
+		return true
+	}
+	return !reflect.DeepEqual(oldEngine.Spec, newEngine.Spec)
+}
+
+// workloadChanged tells whether the labels or the pod template of a workload
+// changed, the validations don't read the rest of it, i.e. its status
+func workloadChanged(old, new interface{}) bool {
+	oldWorkload, err := meta.Accessor(old)
+	if err != nil {
+		return true
+	}
+	newWorkload, err := meta.Accessor(new)
+	if err != nil {
+		return true
+	}
+	if !reflect.DeepEqual(oldWorkload.GetLabels(), newWorkload.GetLabels()) {
+		return true
+	}
+	return !reflect.DeepEqual(podTemplate(old), podTemplate(new))
+}
+
+// podTemplate returns the pod template of the given workload, nil if it has
+// none
+func podTemplate(obj interface{}) *corev1.PodTemplateSpec {
+	switch workload := obj.(type) {
+	case *appsv1.Deployment:
+		return &workload.Spec.Template
+	case *appsv1.StatefulSet:
+		return &workload.Spec.Template
+	case *appsv1.DaemonSet:
+		return &workload.Spec.Template
+	}
+	return nil
+}
+
+// enqueueAll adds all the ChaosEngines to the work queue
+func (r *Revalidator) enqueueAll() {
+	chaosEngines, err := r.lister.List(labels.Everything())
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	Logger(SubsystemRevalidation).V(4).Info("Revalidating ChaosEngines", "count", len(chaosEngines))
+	for _, chaosEngine := range chaosEngines {
+		r.enqueue(chaosEngine)
+	}
+}
+
+// Run starts the given number of workers once the informers of the webhook
+// are synced, it blocks until the stop channel is closed.
+func (r *Revalidator) Run(workers int, stopCh <-chan struct{}) error {
+	defer utilruntime.HandleCrash()
+	defer r.queue.ShutDown()
+
+	if !cache.WaitForCacheSync(stopCh, r.wh.cache.HasSynced) {
+		return fmt.Errorf("failed to wait for informer caches to sync")
+	}
+
+	Logger(SubsystemRevalidation).Info("Starting ChaosEngine revalidation workers", "workers", workers)
+	for i := 0; i < workers; i++ {
+		go wait.Until(r.runWorker, time.Second, stopCh)
+	}
+	go wait.Until(r.enqueueAll, r.interval, stopCh)
+	<-stopCh
+	return nil
+}
+
+func (r *Revalidator) runWorker() {
+	for r.processNextItem() {
+	}
+}
+
+func (r *Revalidator) processNextItem() bool {
+	key, quit := r.queue.Get()
+	if quit {
+		return false
+	}
+	defer r.queue.Done(key)
+
+	if err := r.sync(key.(string)); err != nil {
+		utilruntime.HandleError(fmt.Errorf("failed to revalidate ChaosEngine %v: %v", key, err))
+		r.queue.AddRateLimited(key)
+		return true
+	}
+	r.queue.Forget(key)
+	return true
+}
+
+// sync validates the ChaosEngine with the given key and records the outcome
+// on it.
+func (r *Revalidator) sync(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	chaosEngine, err := r.lister.ChaosEngines(namespace).Get(name)
+	if k8serror.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	current, annotated := chaosEngine.Annotations[ValidationAnnotationKey]
+	if !isEngineActive(chaosEngine) {
+		if annotated {
+			return r.setValidationAnnotation(chaosEngine, nil)
+		}
+		return nil
+	}
+
+	attr := chaosEngineAttributes(chaosEngine)
+	validators := r.wh.registry.Validators(attr.Request.Kind.Kind, attr.Request.Operation)
+	validationErr := r.wh.CollectValidationErrors(withRequestLogValues(context.Background(), attr.Request), attr, validators...)
+	if validationErr == nil {
+		if annotated {
+			Logger(SubsystemRevalidation).V(2).Info("ChaosEngine is valid again", "namespace", namespace, "name", name)
+			r.recorder.Event(chaosEngine, corev1.EventTypeNormal, "ValidationSucceeded", "ChaosEngine passes validation again")
+			return r.setValidationAnnotation(chaosEngine, nil)
+		}
+		return nil
+	}
+
+	message := strings.Replace(validationErr.Error(), "\n", "; ", -1)
+	value := invalidPrefix + message
+	// the failure is only reported once, not on every revalidation
+	if current == value {
+		return nil
+	}
+	Logger(SubsystemRevalidation).V(2).Info("ChaosEngine is no longer valid", "namespace", namespace, "name", name, "error", message)
+	r.recorder.Event(chaosEngine, corev1.EventTypeWarning, "ValidationFailed", message)
+	return r.setValidationAnnotation(chaosEngine, &value)
+}
+
+// chaosEngineAttributes returns the validator inputs of an update of the given
+// ChaosEngine, i.e. of an engine already present in the cluster
+func chaosEngineAttributes(chaosEngine *v1alpha1.ChaosEngine) *Attributes {
+	return &Attributes{
+		Request: &v1beta1.AdmissionRequest{
+			Kind:      metav1.GroupVersionKind{Group: v1alpha1.SchemeGroupVersion.Group, Version: v1alpha1.SchemeGroupVersion.Version, Kind: "ChaosEngine"},
+			Name:      chaosEngine.Name,
+			Namespace: chaosEngine.Namespace,
+			Operation: v1beta1.Update,
+		},
+		Object: chaosEngine,
+	}
+}
+
+// setValidationAnnotation sets the validation annotation of the ChaosEngine to
+// the given value, or removes it if the value is nil.
+func (r *Revalidator) setValidationAnnotation(chaosEngine *v1alpha1.ChaosEngine, value *string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]*string{
+				ValidationAnnotationKey: value,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.wh.litmusClient.LitmuschaosV1alpha1().ChaosEngines(chaosEngine.Namespace).
+		Patch(chaosEngine.Name, types.MergePatchType, patch)
+	return err
+}
@@ -0,0 +1,270 @@
+/*
+Copyright 2019 LitmusChaos Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/litmuschaos/chaos-operator/pkg/apis/litmuschaos/v1alpha1"
+	fakelitmus "github.com/litmuschaos/chaos-operator/pkg/client/clientset/versioned/fake"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestRevalidatorSync(t *testing.T) {
+	os.Setenv("LITMUS_NAMESPACE", litmusNamespace)
+	defer os.Unsetenv("LITMUS_NAMESPACE")
+
+	newEngine := func(annotations map[string]string) *v1alpha1.ChaosEngine {
+		return &v1alpha1.ChaosEngine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "engine",
+				Namespace:   testNamespace,
+				Annotations: annotations,
+			},
+			Spec: v1alpha1.ChaosEngineSpec{
+				Appinfo: v1alpha1.ApplicationParams{
+					Appns:    testNamespace,
+					Applabel: "app=nginx",
+					AppKind:  "deployment",
+				},
+			},
+		}
+	}
+
+	var tests = []struct {
+		description          string
+		k8sObjects           []runtime.Object
+		chaosEngine          *v1alpha1.ChaosEngine
+		isAnnotationExpected bool
+	}{
+		{
+			description:          "An engine whose target is gone gets annotated.",
+			k8sObjects:           []runtime.Object{&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespace}}},
+			chaosEngine:          newEngine(nil),
+			isAnnotationExpected: true,
+		},
+		{
+			description: "A stopped engine gets its annotation removed.",
+			k8sObjects:  []runtime.Object{&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespace}}},
+			chaosEngine: func() *v1alpha1.ChaosEngine {
+				ce := newEngine(map[string]string{ValidationAnnotationKey: invalidPrefix + "unable to find deployment specified in ChaosEngine"})
+				ce.Spec.EngineState = v1alpha1.EngineStateStop
+				return ce
+			}(),
+			isAnnotationExpected: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			stopCh := make(chan struct{})
+			defer close(stopCh)
+			wh := newTestWebhook(t, stopCh, test.k8sObjects, []runtime.Object{test.chaosEngine})
+			r := NewRevalidator(wh, time.Minute)
+
+			durationLabels := map[string]string{"validator": ChaosTargetValidator}
+			before := metricValue(t, "litmuschaos_admission_controller_validator_duration_seconds", durationLabels)
+			if err := r.sync(testNamespace + "/engine"); err != nil {
+				t.Fatalf("Test %q failed: expected error to be nil, got %v", test.description, err)
+			}
+			if after := metricValue(t, "litmuschaos_admission_controller_validator_duration_seconds", durationLabels); after != before {
+				t.Fatalf("Test %q failed: expected revalidation not to record admission metrics, got %v samples instead of %v", test.description, after, before)
+			}
+			// the fake clientset merges patches into the stored object, so the
+			// patch sent is checked instead of the resulting annotations
+			var patch map[string]map[string]map[string]*string
+			for _, action := range wh.litmusClient.(*fakelitmus.Clientset).Actions() {
+				if patchAction, ok := action.(clienttesting.PatchAction); ok {
+					if err := json.Unmarshal(patchAction.GetPatch(), &patch); err != nil {
+						t.Fatalf("Test %q failed: expected error to be nil, got %v", test.description, err)
+					}
+				}
+			}
+			value := patch["metadata"]["annotations"][ValidationAnnotationKey]
+			if (value != nil) != test.isAnnotationExpected {
+				t.Fatalf("Test %q failed: expected annotation to be set %v, got patch %v", test.description, test.isAnnotationExpected, patch)
+			}
+			if value != nil && !strings.HasPrefix(*value, invalidPrefix) {
+				t.Fatalf("Test %q failed: unexpected annotation value %q", test.description, *value)
+			}
+		})
+	}
+}
+
+func TestRevalidatorEvents(t *testing.T) {
+	os.Setenv("LITMUS_NAMESPACE", litmusNamespace)
+	defer os.Unsetenv("LITMUS_NAMESPACE")
+
+	chaosEngine := &v1alpha1.ChaosEngine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "engine",
+			Namespace: testNamespace,
+		},
+		Spec: v1alpha1.ChaosEngineSpec{
+			Appinfo: v1alpha1.ApplicationParams{
+				Appns:    testNamespace,
+				Applabel: "app=nginx",
+				AppKind:  "deployment",
+			},
+		},
+	}
+	namespace := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespace}}
+
+	// the first failure is annotated and reported
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	wh := newTestWebhook(t, stopCh, []runtime.Object{namespace}, []runtime.Object{chaosEngine})
+	r := NewRevalidator(wh, time.Minute)
+	recorder := record.NewFakeRecorder(10)
+	r.recorder = recorder
+	if err := r.sync(testNamespace + "/engine"); err != nil {
+		t.Fatalf("expected error to be nil, got %v", err)
+	}
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expected the failure to be reported once, got %d events", len(recorder.Events))
+	}
+	annotated, err := wh.litmusClient.LitmuschaosV1alpha1().ChaosEngines(testNamespace).Get("engine", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %v", err)
+	}
+
+	// the same failure found again is neither annotated nor reported
+	wh = newTestWebhook(t, stopCh, []runtime.Object{namespace}, []runtime.Object{annotated})
+	r = NewRevalidator(wh, time.Minute)
+	recorder = record.NewFakeRecorder(10)
+	r.recorder = recorder
+	if err := r.sync(testNamespace + "/engine"); err != nil {
+		t.Fatalf("expected error to be nil, got %v", err)
+	}
+	if len(recorder.Events) != 0 {
+		t.Fatalf("expected the known failure not to be reported again, got %v", <-recorder.Events)
+	}
+	for _, action := range wh.litmusClient.(*fakelitmus.Clientset).Actions() {
+		if _, ok := action.(clienttesting.PatchAction); ok {
+			t.Fatalf("expected the known failure not to be annotated again")
+		}
+	}
+}
+
+func TestWorkloadChanged(t *testing.T) {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "nginx",
+			Namespace: testNamespace,
+			Labels:    map[string]string{"app": "nginx"},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "nginx"}},
+			},
+		},
+	}
+
+	var tests = []struct {
+		description       string
+		update            func(*appsv1.Deployment)
+		isChangedExpected bool
+	}{
+		{
+			description: "A status update is ignored.",
+			update: func(d *appsv1.Deployment) {
+				d.ResourceVersion = "2"
+				d.Status.ReadyReplicas = 2
+			},
+			isChangedExpected: false,
+		},
+		{
+			description: "A relabelled workload is revalidated.",
+			update: func(d *appsv1.Deployment) {
+				d.Labels = map[string]string{"app": "httpd"}
+			},
+			isChangedExpected: true,
+		},
+		{
+			description: "A changed pod template is revalidated.",
+			update: func(d *appsv1.Deployment) {
+				d.Spec.Template.Annotations = map[string]string{"litmuschaos.io/chaos": "true"}
+			},
+			isChangedExpected: true,
+		},
+	}
+	for _, test := range tests {
+		updated := deployment.DeepCopy()
+		test.update(updated)
+		if changed := workloadChanged(deployment, updated); changed != test.isChangedExpected {
+			t.Fatalf("Test %q failed: expected changed %v, got %v", test.description, test.isChangedExpected, changed)
+		}
+	}
+}
+
+func TestChaosEngineChanged(t *testing.T) {
+	chaosEngine := &v1alpha1.ChaosEngine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "engine",
+			Namespace:  testNamespace,
+			Generation: 1,
+		},
+		Spec: v1alpha1.ChaosEngineSpec{
+			Appinfo: v1alpha1.ApplicationParams{Appns: testNamespace, Applabel: "app=nginx", AppKind: "deployment"},
+		},
+	}
+
+	var tests = []struct {
+		description       string
+		update            func(*v1alpha1.ChaosEngine)
+		isChangedExpected bool
+	}{
+		{
+			description: "A status update is ignored.",
+			update: func(ce *v1alpha1.ChaosEngine) {
+				ce.ResourceVersion = "2"
+				ce.Status.EngineStatus = v1alpha1.EngineStatusCompleted
+			},
+			isChangedExpected: false,
+		},
+		{
+			description: "The validation annotation of the revalidator is ignored.",
+			update: func(ce *v1alpha1.ChaosEngine) {
+				ce.Annotations = map[string]string{ValidationAnnotationKey: invalidPrefix + "failed"}
+			},
+			isChangedExpected: false,
+		},
+		{
+			description: "A retargeted engine is revalidated.",
+			update: func(ce *v1alpha1.ChaosEngine) {
+				ce.Generation = 2
+				ce.Spec.Appinfo.Applabel = "app=httpd"
+			},
+			isChangedExpected: true,
+		},
+	}
+	for _, test := range tests {
+		updated := chaosEngine.DeepCopy()
+		test.update(updated)
+		if changed := chaosEngineChanged(chaosEngine, updated); changed != test.isChangedExpected {
+			t.Fatalf("Test %q failed: expected changed %v, got %v", test.description, test.isChangedExpected, changed)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2019 The LitmusChaos Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	k8serror "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/litmuschaos/chaos-operator/pkg/apis/litmuschaos/v1alpha1"
+)
+
+const (
+	// chaosOperatorLabel is the label carried by the chaos-operator deployment
+	chaosOperatorLabel = "name=chaos-operator"
+)
+
+// ValidateSelfProtection denies a ChaosEngine whose target would disrupt the
+// litmus control plane, i.e. the chaos-operator, the admission server or the
+// Service and Secret used by this webhook. Unlike the other validations this
+// check is always enforced.
+func (wh *webhook) ValidateSelfProtection(chaosEngine *v1alpha1.ChaosEngine) error {
+	litmusNamespace, err := getLitmusNamespace()
+	if err != nil {
+		return err
+	}
+	if chaosEngine.Spec.Appinfo.Appns != litmusNamespace {
+		return nil
+	}
+
+	protectionErrors := FieldErrors{}
+	for i, experiment := range chaosEngine.Spec.Experiments {
+		for j, secret := range experiment.Spec.Components.Secrets {
+			if secret.Name == validatorSecret {
+				protectionErrors = append(protectionErrors, NewFieldError(experimentSecretsPath(i).Index(j).Child("name"), CodeProtectedSecret,
+					"ChaosExperiment %s must not mount the admission controller Secret %s", experiment.Name, validatorSecret))
+			}
+		}
+	}
+
+	selector, err := labels.Parse(chaosEngine.Spec.Appinfo.Applabel)
+	if err != nil {
+		return NewFieldError(applabelPath, CodeInvalidAppLabel, "unable to parse applabel %q, please check the following error: %v", chaosEngine.Spec.Appinfo.Applabel, err)
+	}
+
+	service, err := wh.cache.services.Services(litmusNamespace).Get(validatorServiceName)
+	if err != nil && !k8serror.IsNotFound(err) {
+		return fmt.Errorf("unable to get Service %s, please check the following error: %v", validatorServiceName, err)
+	}
+	if err == nil && len(service.Spec.Selector) != 0 && selector.Matches(labels.Set(service.Spec.Selector)) {
+		protectionErrors = append(protectionErrors, NewFieldError(applabelPath, CodeProtectedComponent,
+			"applabel %s selects the pods behind the admission controller Service %s", chaosEngine.Spec.Appinfo.Applabel, validatorServiceName))
+	}
+
+	deployments, err := wh.cache.deployments.Deployments(litmusNamespace).List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("unable to list deployments in litmus namespace, please check the following error: %v", err)
+	}
+	for _, deployment := range deployments {
+		component := protectedComponent(deployment)
+		if component == "" {
+			continue
+		}
+		if selector.Matches(labels.Set(deployment.Spec.Template.Labels)) {
+			protectionErrors = append(protectionErrors, NewFieldError(applabelPath, CodeProtectedComponent,
+				"applabel %s selects the %s deployment %s", chaosEngine.Spec.Appinfo.Applabel, component, deployment.Name))
+		}
+	}
+
+	if len(protectionErrors) == 0 {
+		return nil
+	}
+	return protectionErrors
+}
+
+// protectedComponent returns the name of the litmus component run by the
+// given deployment, or an empty string if chaos may be injected into it.
+func protectedComponent(deployment *appsv1.Deployment) string {
+	deploymentLabels := labels.Set(deployment.Labels)
+	if isLabelSelected(webhookLabel, deploymentLabels) {
+		return "admission controller"
+	}
+	if isLabelSelected(chaosOperatorLabel, deploymentLabels) {
+		return "chaos-operator"
+	}
+	return ""
+}
+
+// isLabelSelected returns true if the given label selector matches the labels
+func isLabelSelected(selector string, set labels.Set) bool {
+	s, err := labels.Parse(selector)
+	if err != nil {
+		return false
+	}
+	return s.Matches(set)
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2019 LitmusChaos Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/litmuschaos/chaos-operator/pkg/apis/litmuschaos/v1alpha1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+var litmusNamespace = "litmus"
+
+func TestValidateSelfProtection(t *testing.T) {
+	os.Setenv("LITMUS_NAMESPACE", litmusNamespace)
+	defer os.Unsetenv("LITMUS_NAMESPACE")
+
+	controlPlane := []runtime.Object{
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "litmus-admission-controllers",
+				Namespace: litmusNamespace,
+				Labels: map[string]string{
+					"litmuschaos.io/component-name": "admission-controller",
+				},
+			},
+			Spec: appsv1.DeploymentSpec{
+				Template: v1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{
+						Labels: map[string]string{"app": "admission-controller"},
+					},
+				},
+			},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "chaos-operator-ce",
+				Namespace: litmusNamespace,
+				Labels:    map[string]string{"name": "chaos-operator"},
+			},
+			Spec: appsv1.DeploymentSpec{
+				Template: v1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{
+						Labels: map[string]string{"name": "chaos-operator"},
+					},
+				},
+			},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "nginx",
+				Namespace: litmusNamespace,
+			},
+			Spec: appsv1.DeploymentSpec{
+				Template: v1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{
+						Labels: map[string]string{"app": "nginx"},
+					},
+				},
+			},
+		},
+	}
+
+	var tests = []struct {
+		description   string
+		appInfo       v1alpha1.ApplicationParams
+		secrets       []v1alpha1.Secret
+		isErrExpected bool
+	}{
+		{
+			description:   "Validation fails when the admission controller is targeted.",
+			appInfo:       v1alpha1.ApplicationParams{Appns: litmusNamespace, Applabel: "app=admission-controller", AppKind: "deployment"},
+			isErrExpected: true,
+		},
+		{
+			description:   "Validation fails when the chaos-operator is targeted.",
+			appInfo:       v1alpha1.ApplicationParams{Appns: litmusNamespace, Applabel: "name=chaos-operator", AppKind: "deployment"},
+			isErrExpected: true,
+		},
+		{
+			description:   "Validation fails when the applabel selects every workload of the litmus namespace.",
+			appInfo:       v1alpha1.ApplicationParams{Appns: litmusNamespace, AppKind: "deployment"},
+			isErrExpected: true,
+		},
+		{
+			description:   "Validation fails when an experiment mounts the admission controller Secret.",
+			appInfo:       v1alpha1.ApplicationParams{Appns: litmusNamespace, Applabel: "app=nginx", AppKind: "deployment"},
+			secrets:       []v1alpha1.Secret{{Name: validatorSecret}},
+			isErrExpected: true,
+		},
+		{
+			description:   "Validation is successful when another application of the litmus namespace is targeted.",
+			appInfo:       v1alpha1.ApplicationParams{Appns: litmusNamespace, Applabel: "app=nginx", AppKind: "deployment"},
+			isErrExpected: false,
+		},
+		{
+			description:   "Validation is successful when the application is outside the litmus namespace.",
+			appInfo:       v1alpha1.ApplicationParams{Appns: testNamespace, Applabel: "app=admission-controller", AppKind: "deployment"},
+			secrets:       []v1alpha1.Secret{{Name: validatorSecret}},
+			isErrExpected: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			stopCh := make(chan struct{})
+			defer close(stopCh)
+			webhook := newTestWebhook(t, stopCh, controlPlane, nil)
+			chaosEngine := v1alpha1.ChaosEngine{
+				Spec: v1alpha1.ChaosEngineSpec{
+					Appinfo: test.appInfo,
+					Experiments: []v1alpha1.ExperimentList{
+						{
+							Name: "pod-delete",
+							Spec: v1alpha1.ExperimentAttributes{
+								Components: v1alpha1.ExperimentComponents{
+									Secrets: test.secrets,
+								},
+							},
+						},
+					},
+				},
+			}
+			err := webhook.ValidateSelfProtection(&chaosEngine)
+			if test.isErrExpected && err == nil {
+				t.Fatalf("Test %q failed: expected error not to be nil.", test.description)
+			}
+			if !test.isErrExpected && err != nil {
+				t.Fatalf("Test %q failed: expected error to be nil, got %v", test.description, err)
+			}
+		})
+	}
+}
+
+func TestValidateSelfProtectionOnUpdate(t *testing.T) {
+	os.Setenv("LITMUS_NAMESPACE", litmusNamespace)
+	defer os.Unsetenv("LITMUS_NAMESPACE")
+
+	controlPlane := []runtime.Object{
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: litmusNamespace}},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "chaos-operator-ce",
+				Namespace: litmusNamespace,
+				Labels:    map[string]string{"name": "chaos-operator"},
+			},
+			Spec: appsv1.DeploymentSpec{
+				Template: v1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{
+						Labels: map[string]string{"name": "chaos-operator"},
+					},
+				},
+			},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: litmusNamespace},
+			Spec: appsv1.DeploymentSpec{
+				Template: v1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{
+						Labels: map[string]string{"app": "nginx"},
+					},
+				},
+			},
+		},
+	}
+	engine := func(applabel string) []byte {
+		raw, err := json.Marshal(&v1alpha1.ChaosEngine{
+			ObjectMeta: metav1.ObjectMeta{Name: "engine", Namespace: litmusNamespace},
+			Spec: v1alpha1.ChaosEngineSpec{
+				Appinfo: v1alpha1.ApplicationParams{Appns: litmusNamespace, Applabel: applabel, AppKind: "deployment"},
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to marshal ChaosEngine: %v", err)
+		}
+		return raw
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	webhook := newTestWebhook(t, stopCh, controlPlane, nil)
+
+	response := webhook.validate(context.Background(), &admissionv1beta1.AdmissionReview{
+		Request: &admissionv1beta1.AdmissionRequest{
+			Kind:      metav1.GroupVersionKind{Group: "litmuschaos.io", Version: "v1alpha1", Kind: "ChaosEngine"},
+			Name:      "engine",
+			Namespace: litmusNamespace,
+			Operation: admissionv1beta1.Update,
+			Object:    runtime.RawExtension{Raw: engine("name=chaos-operator")},
+			OldObject: runtime.RawExtension{Raw: engine("app=nginx")},
+		},
+	})
+	if response.Allowed {
+		t.Fatalf("expected the ChaosEngine retargeted at the chaos-operator to be denied")
+	}
+}
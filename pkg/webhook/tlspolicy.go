@@ -0,0 +1,129 @@
+/*
+Copyright 2019 The LitmusChaos Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+var (
+	// tlsVersions are the TLS versions a server may be restricted to
+	tlsVersions = map[string]uint16{
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	}
+
+	// tlsCurves are the curves a server may prefer for the key exchange
+	tlsCurves = map[string]tls.CurveID{
+		"X25519": tls.X25519,
+		"P-256":  tls.CurveP256,
+		"P-384":  tls.CurveP384,
+		"P-521":  tls.CurveP521,
+	}
+)
+
+// TLSOptions is the TLS policy of the webhook server
+type TLSOptions struct {
+	// MinVersion is the minimum TLS version, the default of crypto/tls if 0
+	MinVersion uint16
+	// CipherSuites are the TLS 1.2 cipher suites, the secure defaults of
+	// crypto/tls if empty. TLS 1.3 suites aren't configurable.
+	CipherSuites []uint16
+	// CurvePreferences are the curves of the key exchange, in order of
+	// preference
+	CurvePreferences []tls.CurveID
+	// ClientCAs verify the client certificates, i.e. of the API server.
+	// Requests to the validation path must present one if set.
+	ClientCAs *x509.CertPool
+}
+
+// ParseTLSOptions returns the TLS policy of the given minimum version, i.e.
+// 1.2, cipher suite and curve names and client CA file, each optional
+func ParseTLSOptions(minVersion string, cipherSuites []string, curves []string, clientCAFile string) (TLSOptions, error) {
+	var opts TLSOptions
+	if minVersion != "" {
+		version, ok := tlsVersions[strings.TrimPrefix(minVersion, "VersionTLS")]
+		if !ok {
+			return TLSOptions{}, fmt.Errorf("unsupported minimum TLS version %q, expected 1.2 or 1.3", minVersion)
+		}
+		opts.MinVersion = version
+	}
+
+	// insecure suites are left out on purpose
+	suites := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		suites[suite.Name] = suite.ID
+	}
+	for _, name := range cipherSuites {
+		id, ok := suites[name]
+		if !ok {
+			return TLSOptions{}, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		opts.CipherSuites = append(opts.CipherSuites, id)
+	}
+
+	for _, name := range curves {
+		curve, ok := tlsCurves[name]
+		if !ok {
+			return TLSOptions{}, fmt.Errorf("unknown curve %q, expected X25519, P-256, P-384 or P-521", name)
+		}
+		opts.CurvePreferences = append(opts.CurvePreferences, curve)
+	}
+
+	if clientCAFile != "" {
+		caBytes, err := ioutil.ReadFile(clientCAFile)
+		if err != nil {
+			return TLSOptions{}, fmt.Errorf("failed to read client CA file: %v", err)
+		}
+		opts.ClientCAs = x509.NewCertPool()
+		if !opts.ClientCAs.AppendCertsFromPEM(caBytes) {
+			return TLSOptions{}, fmt.Errorf("no certificate found in client CA file %s", clientCAFile)
+		}
+	}
+	return opts, nil
+}
+
+// config returns the tls.Config of the policy serving the certificates of
+// getCertificate. Client certificates are verified when given, so the probes
+// of the kubelet, which have none, still reach the health endpoints.
+func (opts TLSOptions) config(getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) *tls.Config {
+	config := &tls.Config{
+		GetCertificate:   getCertificate,
+		MinVersion:       opts.MinVersion,
+		CipherSuites:     opts.CipherSuites,
+		CurvePreferences: opts.CurvePreferences,
+	}
+	if opts.ClientCAs != nil {
+		config.ClientCAs = opts.ClientCAs
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config
+}
+
+// hasVerifiedClient tells if the request presents a client certificate
+// verified against the client CAs, always true without client CAs
+func (wh *webhook) hasVerifiedClient(r *http.Request) bool {
+	if wh.Server == nil || wh.Server.TLSConfig == nil || wh.Server.TLSConfig.ClientCAs == nil {
+		return true
+	}
+	return r.TLS != nil && len(r.TLS.VerifiedChains) > 0
+}
@@ -0,0 +1,228 @@
+/*
+Copyright 2019 LitmusChaos Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseTLSOptions(t *testing.T) {
+	ca, err := NewCA("apiserver-client-ca")
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+	dir := t.TempDir()
+	clientCAFile := filepath.Join(dir, "client-ca.crt")
+	if err := ioutil.WriteFile(clientCAFile, EncodeCertPEM(ca.Cert), 0600); err != nil {
+		t.Fatalf("failed to write client CA file: %v", err)
+	}
+	emptyFile := filepath.Join(dir, "empty.crt")
+	if err := ioutil.WriteFile(emptyFile, nil, 0600); err != nil {
+		t.Fatalf("failed to write empty file: %v", err)
+	}
+
+	var tests = []struct {
+		description         string
+		minVersion          string
+		cipherSuites        []string
+		curves              []string
+		clientCAFile        string
+		expectedVersion     uint16
+		isClientCAsExpected bool
+		isErrorExpected     bool
+	}{
+		{
+			description:     "The defaults of crypto/tls without options.",
+			expectedVersion: 0,
+		},
+		{
+			description:         "Version, suites, curves and client CAs are parsed.",
+			minVersion:          "1.3",
+			cipherSuites:        []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+			curves:              []string{"X25519", "P-256"},
+			clientCAFile:        clientCAFile,
+			expectedVersion:     tls.VersionTLS13,
+			isClientCAsExpected: true,
+		},
+		{
+			description:     "Versions older than TLS 1.2 are rejected.",
+			minVersion:      "1.1",
+			isErrorExpected: true,
+		},
+		{
+			description:     "Insecure cipher suites are rejected.",
+			cipherSuites:    []string{"TLS_RSA_WITH_RC4_128_SHA"},
+			isErrorExpected: true,
+		},
+		{
+			description:     "Unknown curves are rejected.",
+			curves:          []string{"P-224"},
+			isErrorExpected: true,
+		},
+		{
+			description:     "A client CA file without certificates is rejected.",
+			clientCAFile:    emptyFile,
+			isErrorExpected: true,
+		},
+	}
+	for _, test := range tests {
+		opts, err := ParseTLSOptions(test.minVersion, test.cipherSuites, test.curves, test.clientCAFile)
+		if isError := err != nil; isError != test.isErrorExpected {
+			t.Fatalf("Test %q failed: expected error %v, got %v", test.description, test.isErrorExpected, err)
+		}
+		if err != nil {
+			continue
+		}
+		if opts.MinVersion != test.expectedVersion {
+			t.Fatalf("Test %q failed: expected minimum version %x, got %x", test.description, test.expectedVersion, opts.MinVersion)
+		}
+		if len(opts.CipherSuites) != len(test.cipherSuites) || len(opts.CurvePreferences) != len(test.curves) {
+			t.Fatalf("Test %q failed: expected %d suites and %d curves, got %v and %v", test.description, len(test.cipherSuites), len(test.curves), opts.CipherSuites, opts.CurvePreferences)
+		}
+		if hasClientCAs := opts.ClientCAs != nil; hasClientCAs != test.isClientCAsExpected {
+			t.Fatalf("Test %q failed: expected client CAs %v, got %v", test.description, test.isClientCAsExpected, hasClientCAs)
+		}
+	}
+}
+
+func TestTLSPolicy(t *testing.T) {
+	ca, err := NewCA("admission-controller-ca")
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+	serverKeyPair, err := NewServerKeyPair(ca, "admission-controller", validatorServiceName, litmusNamespace, "cluster.local", nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create server key pair: %v", err)
+	}
+	certBytes, keyBytes, err := serverKeyPair.encodePEM()
+	if err != nil {
+		t.Fatalf("failed to encode server key pair: %v", err)
+	}
+	clientCA, err := NewCA("apiserver-client-ca")
+	if err != nil {
+		t.Fatalf("failed to create client CA: %v", err)
+	}
+	otherCA, err := NewCA("other-ca")
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+	clientCertificate := func(ca *KeyPair) []tls.Certificate {
+		clientKeyPair, err := NewClientKeyPair(ca, "kube-apiserver", nil)
+		if err != nil {
+			t.Fatalf("failed to create client key pair: %v", err)
+		}
+		certPEM, keyPEM, err := clientKeyPair.encodePEM()
+		if err != nil {
+			t.Fatalf("failed to encode client key pair: %v", err)
+		}
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			t.Fatalf("failed to load client key pair: %v", err)
+		}
+		return []tls.Certificate{cert}
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCA.Cert)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+
+	var tests = []struct {
+		description        string
+		opts               TLSOptions
+		clientMaxVersion   uint16
+		clientCertificates []tls.Certificate
+		path               string
+		isErrorExpected    bool
+		expectedCode       int
+	}{
+		{
+			description:  "Requests reach the validation without a policy.",
+			path:         "/validate",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			description:      "Clients older than the minimum version are rejected.",
+			opts:             TLSOptions{MinVersion: tls.VersionTLS13},
+			clientMaxVersion: tls.VersionTLS12,
+			path:             "/validate",
+			isErrorExpected:  true,
+		},
+		{
+			description:        "A client certificate of the client CA reaches the validation.",
+			opts:               TLSOptions{ClientCAs: clientCAs},
+			clientCertificates: clientCertificate(clientCA),
+			path:               "/validate",
+			expectedCode:       http.StatusBadRequest,
+		},
+		{
+			description:  "The validation requires a client certificate.",
+			opts:         TLSOptions{ClientCAs: clientCAs},
+			path:         "/validate",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			description:  "The probes of the kubelet don't require a client certificate.",
+			opts:         TLSOptions{ClientCAs: clientCAs},
+			path:         "/healthz",
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:        "A client certificate of another CA doesn't reach the validation.",
+			opts:               TLSOptions{ClientCAs: clientCAs},
+			clientCertificates: clientCertificate(otherCA),
+			path:               "/validate",
+			expectedCode:       http.StatusUnauthorized,
+		},
+	}
+	for _, test := range tests {
+		wh := &webhook{pipeline: newPipeline(1, 0)}
+		if err := wh.setServingCertificate(Parameters{TLS: test.opts}, certBytes, keyBytes, EncodeCertPEM(ca.Cert)); err != nil {
+			t.Fatalf("Test %q failed: %v", test.description, err)
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/validate", wh.Serve)
+		mux.HandleFunc("/healthz", wh.ServeLiveness)
+		server := httptest.NewUnstartedServer(mux)
+		server.TLS = wh.Server.TLSConfig
+		server.StartTLS()
+
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			ServerName:   serverKeyPair.Cert.DNSNames[0],
+			MaxVersion:   test.clientMaxVersion,
+			Certificates: test.clientCertificates,
+		}}}
+		resp, err := client.Post(server.URL+test.path, "application/json", nil)
+		server.Close()
+		if isError := err != nil; isError != test.isErrorExpected {
+			t.Fatalf("Test %q failed: expected error %v, got %v", test.description, test.isErrorExpected, err)
+		}
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.expectedCode {
+			t.Fatalf("Test %q failed: expected status %d, got %d", test.description, test.expectedCode, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2019 The LitmusChaos Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/api/admission/v1beta1"
+
+	"github.com/litmuschaos/admission-controllers/pkg/version"
+)
+
+const (
+	// tracerName is the instrumentation name of the spans of the webhook
+	tracerName = "github.com/litmuschaos/admission-controllers/pkg/webhook"
+	// traceIDAnnotation is the audit annotation holding the trace ID of a
+	// request, the API server prefixes it with the webhook name
+	traceIDAnnotation = "trace-id"
+)
+
+// Attributes of the spans of an admission request
+const (
+	requestUIDKey       = attribute.Key("admission.uid")
+	requestKindKey      = attribute.Key("admission.kind")
+	requestNamespaceKey = attribute.Key("admission.namespace")
+	requestNameKey      = attribute.Key("admission.name")
+	requestOperationKey = attribute.Key("admission.operation")
+	chaosEngineKey      = attribute.Key("litmuschaos.chaosengine")
+	validatorKey        = attribute.Key("admission.validator")
+	inconclusiveKey     = attribute.Key("admission.inconclusive")
+	allowedKey          = attribute.Key("admission.allowed")
+)
+
+// TracingOptions configure the export of the traces
+type TracingOptions struct {
+	// Endpoint is the host:port of the OTLP/HTTP collector, tracing is
+	// disabled if empty
+	Endpoint string
+	// Insecure sends the traces over HTTP instead of HTTPS
+	Insecure bool
+	// SampleRatio is the ratio of the requests traced, unless the API server
+	// sampled the request already
+	SampleRatio float64
+}
+
+// InitTracing exports the spans of the webhook to the configured collector.
+// The returned function flushes the pending spans and stops the export.
+func InitTracing(ctx context.Context, opts TracingOptions) (func(context.Context) error, error) {
+	// the API server propagates the trace context to webhooks if its own
+	// tracing is enabled
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	if opts.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporterOptions := []otlptracehttp.Option{otlptracehttp.WithEndpoint(opts.Endpoint)}
+	if opts.Insecure {
+		exporterOptions = append(exporterOptions, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, exporterOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %v", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceNameKey.String("litmus-admission-controller"),
+			semconv.ServiceVersionKey.String(version.Current()),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// tracer returns the tracer of the webhook, from the global provider set by
+// InitTracing
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// requestAttributes returns the span attributes identifying an admission
+// request
+func requestAttributes(req *v1beta1.AdmissionRequest) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{
+		requestUIDKey.String(string(req.UID)),
+		requestKindKey.String(req.Kind.Kind),
+		requestNamespaceKey.String(req.Namespace),
+		requestNameKey.String(req.Name),
+		requestOperationKey.String(string(req.Operation)),
+	}
+	if req.Kind.Kind == "ChaosEngine" {
+		attributes = append(attributes, chaosEngineKey.String(req.Name))
+	}
+	return attributes
+}
+
+// endSpan records the error, if any, and ends the span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TracingTransport traces the requests sent to the kubernetes API server and
+// propagates the trace context to it, to be set as rest.Config.WrapTransport.
+// The clientsets of this client-go take no context, so every request starts
+// a trace of its own rather than a child span of an admission request.
+func TracingTransport(rt http.RoundTripper) http.RoundTripper {
+	return &tracingRoundTripper{next: rt}
+}
+
+type tracingRoundTripper struct {
+	next http.RoundTripper
+}
+
+func (t *tracingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// watches of the informers last until they are closed, they aren't traced
+	if req.URL.Query().Get("watch") == "true" {
+		return t.next.RoundTrip(req)
+	}
+	ctx, span := tracer().Start(req.Context(), "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPMethodKey.String(req.Method),
+			semconv.HTTPURLKey.String(req.URL.String()),
+		))
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		endSpan(span, err)
+		return resp, err
+	}
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	span.End()
+	return resp, nil
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2019 LitmusChaos Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/litmuschaos/chaos-operator/pkg/apis/litmuschaos/v1alpha1"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/api/admission/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestServeSpans(t *testing.T) {
+	os.Setenv("LITMUS_NAMESPACE", litmusNamespace)
+	defer os.Unsetenv("LITMUS_NAMESPACE")
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	raw, err := json.Marshal(&v1alpha1.ChaosEngine{
+		ObjectMeta: metav1.ObjectMeta{Name: "engine", Namespace: testNamespace},
+		Spec: v1alpha1.ChaosEngineSpec{
+			Appinfo: v1alpha1.ApplicationParams{Appns: testNamespace, Applabel: "app=nginx", AppKind: "deployment"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal ChaosEngine: %v", err)
+	}
+	body, err := json.Marshal(&v1beta1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1beta1", Kind: "AdmissionReview"},
+		Request: &v1beta1.AdmissionRequest{
+			UID:       "request-uid",
+			Kind:      metav1.GroupVersionKind{Group: "litmuschaos.io", Version: "v1alpha1", Kind: "ChaosEngine"},
+			Name:      "engine",
+			Namespace: testNamespace,
+			Operation: v1beta1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal AdmissionReview: %v", err)
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	webhook := newTestWebhook(t, stopCh,
+		[]runtime.Object{&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespace}}}, nil)
+
+	request := httptest.NewRequest("POST", "/validate", bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	response := httptest.NewRecorder()
+	webhook.Serve(response, request)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	serve, ok := spans["Serve"]
+	if !ok {
+		t.Fatalf("expected a Serve span, got %v", spans)
+	}
+	attributes := map[string]string{}
+	for _, kv := range serve.Attributes() {
+		attributes[string(kv.Key)] = kv.Value.Emit()
+	}
+	if attributes[string(requestUIDKey)] != "request-uid" || attributes[string(chaosEngineKey)] != "engine" {
+		t.Fatalf("expected the Serve span to identify the request, got %v", attributes)
+	}
+
+	var tests = []struct {
+		description string
+		name        string
+	}{
+		{description: "The AdmissionReview decoding is traced.", name: "Decode"},
+		{description: "The object decoding is traced.", name: "DecodeObject"},
+		{description: "The validators are traced.", name: "Validate " + ChaosTargetValidator},
+	}
+	for _, test := range tests {
+		span, ok := spans[test.name]
+		if !ok {
+			t.Fatalf("Test %q failed: expected a %s span", test.description, test.name)
+		}
+		if span.SpanContext().TraceID() != serve.SpanContext().TraceID() {
+			t.Fatalf("Test %q failed: expected the span to be part of the Serve trace", test.description)
+		}
+	}
+
+	review := admissionReview{}
+	if err := json.Unmarshal(response.Body.Bytes(), &review); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if traceID := review.Response.AuditAnnotations[traceIDAnnotation]; traceID != serve.SpanContext().TraceID().String() {
+		t.Fatalf("expected the trace ID %s to be audited, got %q", serve.SpanContext().TraceID(), traceID)
+	}
+}
+
+func TestTracingExport(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		paths       []string
+		traceparent string
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path == "/api/v1/namespaces" {
+			traceparent = r.Header.Get("traceparent")
+		}
+	}))
+	defer collector.Close()
+
+	shutdown, err := InitTracing(context.Background(), TracingOptions{
+		Endpoint:    strings.TrimPrefix(collector.URL, "http://"),
+		Insecure:    true,
+		SampleRatio: 1,
+	})
+	if err != nil {
+		t.Fatalf("failed to init tracing: %v", err)
+	}
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	client := &http.Client{Transport: TracingTransport(http.DefaultTransport)}
+	resp, err := client.Get(collector.URL + "/api/v1/namespaces")
+	if err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	resp.Body.Close()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("failed to flush traces: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if traceparent == "" {
+		t.Fatalf("expected the trace context to be propagated to the API server")
+	}
+	exported := false
+	for _, path := range paths {
+		exported = exported || path == "/v1/traces"
+	}
+	if !exported {
+		t.Fatalf("expected the spans to be exported to the collector, got requests to %v", paths)
+	}
+}
@@ -21,6 +21,7 @@ package webhook
 
 import (
 	"crypto"
+	"crypto/ecdsa"
 	"crypto/elliptic"
 	cryptorand "crypto/rand"
 	"crypto/rsa"
@@ -31,6 +32,7 @@ import (
 	"math"
 	"math/big"
 	"net"
+	"strings"
 	"time"
 
 	//"k8s.io/kubernetes/cmd/kubeadm/app/util/pkiutil"
@@ -52,21 +54,102 @@ const (
 	CertificateBlockType = "CERTIFICATE"
 	// RSAPrivateKeyBlockType is a possible value for pem.Block.Type.
 	RSAPrivateKeyBlockType = "RSA PRIVATE KEY"
+	// ECPrivateKeyBlockType is a possible value for pem.Block.Type.
+	ECPrivateKeyBlockType = "EC PRIVATE KEY"
 )
 
+// Key algorithms of KeyOptions
+const (
+	KeyAlgorithmRSA   = "RSA"
+	KeyAlgorithmECDSA = "ECDSA"
+)
+
+// KeyOptions tells how the private keys of the CA and of the certificates
+// are generated
+type KeyOptions struct {
+	// Algorithm is either RSA or ECDSA
+	Algorithm string
+	// RSASize is the size in bits of the RSA keys, at least 2048
+	RSASize int
+	// Curve is the curve of the ECDSA keys
+	Curve elliptic.Curve
+}
+
+// keyOptions are the options of the generated keys, set by SetKeyOptions
+var keyOptions = KeyOptions{Algorithm: KeyAlgorithmRSA, RSASize: rsaKeySize, Curve: DefaultEllipticCurve}
+
+// ParseKeyOptions returns the options of the given algorithm, RSA size and
+// ECDSA curve name, either P-256 or P-384
+func ParseKeyOptions(algorithm string, rsaSize int, curve string) (KeyOptions, error) {
+	opts := KeyOptions{Algorithm: strings.ToUpper(algorithm), RSASize: rsaSize}
+	switch opts.Algorithm {
+	case KeyAlgorithmRSA:
+		if rsaSize < rsaKeySize {
+			return KeyOptions{}, fmt.Errorf("RSA keys must be at least %d bits, got %d", rsaKeySize, rsaSize)
+		}
+	case KeyAlgorithmECDSA:
+	default:
+		return KeyOptions{}, fmt.Errorf("unknown key algorithm %q, expected RSA or ECDSA", algorithm)
+	}
+	switch strings.ToUpper(curve) {
+	case "P-256", "P256":
+		opts.Curve = elliptic.P256()
+	case "P-384", "P384":
+		opts.Curve = elliptic.P384()
+	default:
+		return KeyOptions{}, fmt.Errorf("unknown curve %q, expected P-256 or P-384", curve)
+	}
+	return opts, nil
+}
+
+// SetKeyOptions sets how the keys of the CA and of the certificates created
+// from now on are generated
+func SetKeyOptions(opts KeyOptions) {
+	keyOptions = opts
+}
+
+// String describes the keys generated with the options, i.e. ECDSA P-384
+func (opts KeyOptions) String() string {
+	if opts.Algorithm == KeyAlgorithmECDSA {
+		return fmt.Sprintf("%s %s", opts.Algorithm, opts.Curve.Params().Name)
+	}
+	return fmt.Sprintf("%s %d", opts.Algorithm, opts.RSASize)
+}
+
+// matches tells if the given public key is generated with the options
+func (opts KeyOptions) matches(key crypto.PublicKey) bool {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return opts.Algorithm == KeyAlgorithmRSA && key.N.BitLen() == opts.RSASize
+	case *ecdsa.PublicKey:
+		return opts.Algorithm == KeyAlgorithmECDSA && key.Curve == opts.Curve
+	}
+	return false
+}
+
 // KeyPair ...
 type KeyPair struct {
-	Key  *rsa.PrivateKey
+	Key  crypto.Signer
 	Cert *x509.Certificate
 }
 
-// newPrivateKey returns randomly generated ECDSA private key.
-//func newPrivateKey(curve elliptic.Curve) (*ecdsa.PrivateKey, error) {
-//	return ecdsa.GenerateKey(curve, rand.Reader)
-//}
-// newPrivateKey creates an RSA private key
-func newPrivateKey() (*rsa.PrivateKey, error) {
-	return rsa.GenerateKey(cryptorand.Reader, rsaKeySize)
+// encodePEM returns the PEM-encoded certificate and PKCS#8 private key of the
+// pair
+func (kp *KeyPair) encodePEM() (certPEM []byte, keyPEM []byte, err error) {
+	keyPEM, err = EncodePrivateKeyPEM(kp.Key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode private key: %v", err)
+	}
+	return EncodeCertPEM(kp.Cert), keyPEM, nil
+}
+
+// newPrivateKey creates an RSA or ECDSA private key according to the options
+// set by SetKeyOptions
+func newPrivateKey() (crypto.Signer, error) {
+	if keyOptions.Algorithm == KeyAlgorithmECDSA {
+		return ecdsa.GenerateKey(keyOptions.Curve, cryptorand.Reader)
+	}
+	return rsa.GenerateKey(cryptorand.Reader, keyOptions.RSASize)
 }
 
 // NewCA ...
@@ -98,13 +181,7 @@ func NewServerKeyPair(ca *KeyPair, commonName, svcName, svcNamespace, dnsDomain
 		return nil, fmt.Errorf("unable to create a server private key: %v", err)
 	}
 
-	namespacedName := fmt.Sprintf("%s.%s", svcName, svcNamespace)
-	internalAPIServerFQDN := []string{
-		svcName,
-		namespacedName,
-		fmt.Sprintf("%s.svc", namespacedName),
-		fmt.Sprintf("%s.svc.%s", namespacedName, dnsDomain),
-	}
+	internalAPIServerFQDN := serviceDNSNames(svcName, svcNamespace, dnsDomain)
 
 	altNames := certutil.AltNames{}
 	for _, ipStr := range ips {
@@ -132,6 +209,17 @@ func NewServerKeyPair(ca *KeyPair, commonName, svcName, svcNamespace, dnsDomain
 	}, nil
 }
 
+// serviceDNSNames returns the DNS names the given service is reached at
+func serviceDNSNames(svcName, svcNamespace, dnsDomain string) []string {
+	namespacedName := fmt.Sprintf("%s.%s", svcName, svcNamespace)
+	return []string{
+		svcName,
+		namespacedName,
+		fmt.Sprintf("%s.svc", namespacedName),
+		fmt.Sprintf("%s.svc.%s", namespacedName, dnsDomain),
+	}
+}
+
 // NewClientKeyPair ...
 func NewClientKeyPair(ca *KeyPair, commonName string, organizations []string) (*KeyPair, error) {
 	key, err := newPrivateKey()
@@ -178,9 +266,13 @@ func NewSignedCert(cfg *certutil.Config, key crypto.Signer, caCert *x509.Certifi
 		SerialNumber: serial,
 		NotBefore:    caCert.NotBefore,
 		NotAfter:     time.Now().Add(duration365d).UTC(),
-		KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
 		ExtKeyUsage:  cfg.Usages,
 	}
+	// only RSA keys encipher the keys of the TLS key exchange
+	if _, ok := key.Public().(*rsa.PublicKey); ok {
+		certTmpl.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
 	certDERBytes, err := x509.CreateCertificate(cryptorand.Reader, &certTmpl, caCert, key.Public(), caKey)
 	if err != nil {
 		return nil, err
@@ -197,11 +289,46 @@ func EncodeCertPEM(cert *x509.Certificate) []byte {
 	return pem.EncodeToMemory(&block)
 }
 
-// EncodePrivateKeyPEM returns PEM-encoded private key data
-func EncodePrivateKeyPEM(key *rsa.PrivateKey) []byte {
+// EncodePrivateKeyPEM returns PKCS#8 PEM-encoded private key data
+func EncodePrivateKeyPEM(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
 	block := pem.Block{
-		Type:  RSAPrivateKeyBlockType,
-		Bytes: x509.MarshalPKCS1PrivateKey(key),
+		Type:  PrivateKeyBlockType,
+		Bytes: der,
 	}
-	return pem.EncodeToMemory(&block)
+	return pem.EncodeToMemory(&block), nil
+}
+
+// ParsePrivateKeyPEM returns the private key of PKCS#8 PEM-encoded data, or
+// of the PKCS#1 and EC PEM-encoded data of older Secrets
+func ParsePrivateKeyPEM(keyPEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	var (
+		key interface{}
+		err error
+	)
+	switch block.Type {
+	case PrivateKeyBlockType:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case RSAPrivateKeyBlockType:
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case ECPrivateKeyBlockType:
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
 }
@@ -0,0 +1,175 @@
+/*
+Copyright 2019 LitmusChaos Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	cryptorand "crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+)
+
+func TestKeyOptions(t *testing.T) {
+	defer SetKeyOptions(keyOptions)
+
+	var tests = []struct {
+		description     string
+		algorithm       string
+		rsaSize         int
+		curve           string
+		expectedKey     string
+		isErrorExpected bool
+	}{
+		{
+			description: "RSA keys of the given size.",
+			algorithm:   "RSA",
+			rsaSize:     3072,
+			curve:       "P-256",
+			expectedKey: "RSA 3072",
+		},
+		{
+			description: "ECDSA keys on the P-384 curve.",
+			algorithm:   "ecdsa",
+			rsaSize:     2048,
+			curve:       "P-384",
+			expectedKey: "ECDSA P-384",
+		},
+		{
+			description:     "RSA keys smaller than 2048 bits are rejected.",
+			algorithm:       "RSA",
+			rsaSize:         1024,
+			curve:           "P-256",
+			isErrorExpected: true,
+		},
+		{
+			description:     "Unknown curves are rejected.",
+			algorithm:       "ECDSA",
+			rsaSize:         2048,
+			curve:           "P-521",
+			isErrorExpected: true,
+		},
+		{
+			description:     "Unknown algorithms are rejected.",
+			algorithm:       "Ed25519",
+			rsaSize:         2048,
+			curve:           "P-256",
+			isErrorExpected: true,
+		},
+	}
+	for _, test := range tests {
+		opts, err := ParseKeyOptions(test.algorithm, test.rsaSize, test.curve)
+		if isError := err != nil; isError != test.isErrorExpected {
+			t.Fatalf("Test %q failed: expected error %v, got %v", test.description, test.isErrorExpected, err)
+		}
+		if err != nil {
+			continue
+		}
+		if opts.String() != test.expectedKey {
+			t.Fatalf("Test %q failed: expected %s keys, got %s", test.description, test.expectedKey, opts)
+		}
+		SetKeyOptions(opts)
+
+		ca, err := NewCA("admission-controller-ca")
+		if err != nil {
+			t.Fatalf("Test %q failed: failed to create CA: %v", test.description, err)
+		}
+		serverKeyPair, err := NewServerKeyPair(ca, "admission-controller", validatorServiceName, litmusNamespace, "cluster.local", nil, nil)
+		if err != nil {
+			t.Fatalf("Test %q failed: failed to create server key pair: %v", test.description, err)
+		}
+		for _, keyPair := range []*KeyPair{ca, serverKeyPair} {
+			if !opts.matches(keyPair.Cert.PublicKey) {
+				t.Fatalf("Test %q failed: expected a %s key for %s", test.description, test.expectedKey, keyPair.Cert.Subject.CommonName)
+			}
+		}
+
+		certPEM, keyPEM, err := serverKeyPair.encodePEM()
+		if err != nil {
+			t.Fatalf("Test %q failed: failed to encode key pair: %v", test.description, err)
+		}
+		if block, _ := pem.Decode(keyPEM); block == nil || block.Type != PrivateKeyBlockType {
+			t.Fatalf("Test %q failed: expected a PKCS#8 private key", test.description)
+		}
+		key, err := ParsePrivateKeyPEM(keyPEM)
+		if err != nil {
+			t.Fatalf("Test %q failed: failed to parse private key: %v", test.description, err)
+		}
+		if !opts.matches(key.Public()) {
+			t.Fatalf("Test %q failed: expected the parsed key to be a %s key", test.description, test.expectedKey)
+		}
+		if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+			t.Fatalf("Test %q failed: expected a usable key pair: %v", test.description, err)
+		}
+		roots := x509.NewCertPool()
+		roots.AddCert(ca.Cert)
+		if _, err := serverKeyPair.Cert.Verify(x509.VerifyOptions{Roots: roots}); err != nil {
+			t.Fatalf("Test %q failed: expected the certificate to be signed by the CA: %v", test.description, err)
+		}
+	}
+}
+
+func TestParseLegacyPrivateKey(t *testing.T) {
+	key, err := rsa.GenerateKey(cryptorand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: RSAPrivateKeyBlockType, Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	parsed, err := ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		t.Fatalf("expected the PKCS#1 keys of older Secrets to be parsed, got %v", err)
+	}
+	if !key.PublicKey.Equal(parsed.Public()) {
+		t.Fatalf("expected the parsed key to be the encoded one")
+	}
+}
+
+func TestRotateKeyAlgorithm(t *testing.T) {
+	defer SetKeyOptions(keyOptions)
+
+	secret, err := newCertsSecret(validatorSecret, validatorServiceName, litmusNamespace)
+	if err != nil {
+		t.Fatalf("failed to create secret: %v", err)
+	}
+	opts, err := ParseKeyOptions("ECDSA", 2048, "P-384")
+	if err != nil {
+		t.Fatalf("failed to parse key options: %v", err)
+	}
+	SetKeyOptions(opts)
+
+	renewed, err := renewCertsSecret(secret, validatorServiceName, litmusNamespace, rotationPolicy{caGracePeriod: duration365d})
+	if err != nil {
+		t.Fatalf("failed to renew secret: %v", err)
+	}
+	if renewed == nil {
+		t.Fatalf("expected the certificates to be renewed with %s keys", opts)
+	}
+	for _, key := range []string{rootKey, appKey} {
+		parsed, err := ParsePrivateKeyPEM(renewed.Data[key])
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", key, err)
+		}
+		if !opts.matches(parsed.Public()) {
+			t.Fatalf("expected %s to be a %s key", key, opts)
+		}
+	}
+	if !bytes.Equal(renewed.Data[previousRootCrt], secret.Data[rootCrt]) {
+		t.Fatalf("expected the RSA CA to stay in the caBundle for the grace period")
+	}
+}
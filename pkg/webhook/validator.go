@@ -0,0 +1,241 @@
+/*
+Copyright 2019 The LitmusChaos Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/litmuschaos/chaos-operator/pkg/apis/litmuschaos/v1alpha1"
+)
+
+// Severity tells how the failure of a Validator is handled
+type Severity string
+
+const (
+	// SeverityError failures deny the admission request
+	SeverityError Severity = "error"
+	// SeverityWarning failures are reported but never deny the request
+	SeverityWarning Severity = "warning"
+)
+
+// Attributes are the inputs of a Validator
+type Attributes struct {
+	// Request is the admission request under validation
+	Request *v1beta1.AdmissionRequest
+	// Object is the decoded object of the request, i.e. a *v1alpha1.ChaosEngine
+	// for ChaosEngines and an *unstructured.Unstructured for other kinds. It
+	// is nil for deletes.
+	Object runtime.Object
+}
+
+// ChaosEngine returns the ChaosEngine under validation, if any
+func (a *Attributes) ChaosEngine() (*v1alpha1.ChaosEngine, bool) {
+	chaosEngine, ok := a.Object.(*v1alpha1.ChaosEngine)
+	return chaosEngine, ok
+}
+
+// newAttributes decodes the object of the given admission request
+func newAttributes(req *v1beta1.AdmissionRequest) (*Attributes, error) {
+	attr := &Attributes{Request: req}
+	if len(req.Object.Raw) == 0 {
+		return attr, nil
+	}
+
+	var obj runtime.Object
+	switch req.Kind.Kind {
+	case "ChaosEngine":
+		obj = &v1alpha1.ChaosEngine{}
+	default:
+		obj = &unstructured.Unstructured{}
+	}
+	if err := json.Unmarshal(req.Object.Raw, obj); err != nil {
+		return nil, err
+	}
+	attr.Object = obj
+	return attr, nil
+}
+
+// Validator checks admission requests of the given kinds and operations.
+// Validators compiled into the admission controller are added with Register.
+type Validator interface {
+	// Name identifies the validator in the configuration and the logs
+	Name() string
+	// Kinds are the kinds of the resources the validator checks
+	Kinds() []string
+	// Operations are the operations the validator checks
+	Operations() []v1beta1.Operation
+	// Severity tells whether a failure denies the request
+	Severity() Severity
+	// Validate returns an error if the request must not be admitted
+	Validate(ctx context.Context, attr *Attributes) error
+}
+
+// Registry holds Validators in their order of registration
+type Registry struct {
+	mu         sync.RWMutex
+	validators []Validator
+	mandatory  map[string]bool
+	disabled   map[string]bool
+}
+
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		mandatory: map[string]bool{},
+		disabled:  map[string]bool{},
+	}
+}
+
+// DefaultRegistry holds the validators registered with Register, they are
+// added to the built-in validators of every webhook
+var DefaultRegistry = NewRegistry()
+
+// Register adds a validator to the DefaultRegistry, it is meant to be called
+// from the init function of the package providing the validator
+func Register(v Validator) error {
+	return DefaultRegistry.Register(v)
+}
+
+// Register adds a validator, enabled, to the registry
+func (r *Registry) Register(v Validator) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, registered := range r.validators {
+		if registered.Name() == v.Name() {
+			return fmt.Errorf("validator %s is already registered", v.Name())
+		}
+	}
+	r.validators = append(r.validators, v)
+	return nil
+}
+
+// registerMandatory adds a validator which can't be disabled to the registry
+func (r *Registry) registerMandatory(v Validator) error {
+	if err := r.Register(v); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mandatory[v.Name()] = true
+	return nil
+}
+
+// IsMandatory returns true if the named validator can't be disabled
+func (r *Registry) IsMandatory(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.mandatory[name]
+}
+
+// Configure enables only the named validators, if any, and then disables the
+// named ones. Mandatory validators are always enabled.
+func (r *Registry) Configure(enabled []string, disabled []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	known := map[string]bool{}
+	for _, v := range r.validators {
+		known[v.Name()] = true
+	}
+	for _, name := range append(append([]string{}, enabled...), disabled...) {
+		if !known[name] {
+			return fmt.Errorf("unknown validator %s", name)
+		}
+	}
+
+	r.disabled = map[string]bool{}
+	if len(enabled) != 0 {
+		for _, v := range r.validators {
+			r.disabled[v.Name()] = true
+		}
+		for _, name := range enabled {
+			delete(r.disabled, name)
+		}
+	}
+	for _, name := range disabled {
+		if r.mandatory[name] {
+			return fmt.Errorf("validator %s is mandatory and can't be disabled", name)
+		}
+		r.disabled[name] = true
+	}
+	for name := range r.mandatory {
+		delete(r.disabled, name)
+	}
+	return nil
+}
+
+// Validators returns the enabled validators which check the given kind and
+// operation, in their order of registration
+func (r *Registry) Validators(kind string, operation v1beta1.Operation) []Validator {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var validators []Validator
+	for _, v := range r.validators {
+		if !r.disabled[v.Name()] && contains(v.Kinds(), kind) && containsOperation(v.Operations(), operation) {
+			validators = append(validators, v)
+		}
+	}
+	return validators
+}
+
+// Names returns the sorted names of all the registered validators
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.validators))
+	for _, v := range r.validators {
+		names = append(names, v.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// all returns every registered validator, enabled or not
+func (r *Registry) all() []Validator {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]Validator{}, r.validators...)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsOperation(list []v1beta1.Operation, operation v1beta1.Operation) bool {
+	for _, item := range list {
+		if item == operation {
+			return true
+		}
+	}
+	return false
+}
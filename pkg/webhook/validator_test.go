@@ -0,0 +1,155 @@
+/*
+Copyright 2019 LitmusChaos Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testValidator is a Validator of ChaosEngine creates returning the given error
+type testValidator struct {
+	name     string
+	severity Severity
+	err      error
+}
+
+func (v *testValidator) Name() string { return v.name }
+
+func (v *testValidator) Kinds() []string { return []string{"ChaosEngine"} }
+
+func (v *testValidator) Operations() []v1beta1.Operation {
+	return []v1beta1.Operation{v1beta1.Create}
+}
+
+func (v *testValidator) Severity() Severity { return v.severity }
+
+func (v *testValidator) Validate(ctx context.Context, attr *Attributes) error { return v.err }
+
+func validatorNames(validators []Validator) []string {
+	names := make([]string, 0)
+	for _, v := range validators {
+		names = append(names, v.Name())
+	}
+	return names
+}
+
+func TestRegistryRegister(t *testing.T) {
+	registry := NewRegistry()
+	if err := registry.Register(&testValidator{name: "a"}); err != nil {
+		t.Fatalf("expected error to be nil, got %v", err)
+	}
+	if err := registry.Register(&testValidator{name: "a"}); err == nil {
+		t.Fatalf("expected registering a duplicate validator to fail")
+	}
+}
+
+func TestRegistryConfigure(t *testing.T) {
+	var tests = []struct {
+		description   string
+		enabled       []string
+		disabled      []string
+		expected      []string
+		isErrExpected bool
+	}{
+		{
+			description: "All validators run by default.",
+			expected:    []string{"mandatory", "a", "b"},
+		},
+		{
+			description: "Enabled validators run along with the mandatory ones.",
+			enabled:     []string{"b"},
+			expected:    []string{"mandatory", "b"},
+		},
+		{
+			description: "Disabled validators don't run.",
+			disabled:    []string{"a"},
+			expected:    []string{"mandatory", "b"},
+		},
+		{
+			description:   "Mandatory validators can't be disabled.",
+			disabled:      []string{"mandatory"},
+			isErrExpected: true,
+		},
+		{
+			description:   "Unknown validators are rejected.",
+			enabled:       []string{"c"},
+			isErrExpected: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			registry := NewRegistry()
+			if err := registry.registerMandatory(&testValidator{name: "mandatory"}); err != nil {
+				t.Fatalf("expected error to be nil, got %v", err)
+			}
+			for _, name := range []string{"a", "b"} {
+				if err := registry.Register(&testValidator{name: name}); err != nil {
+					t.Fatalf("expected error to be nil, got %v", err)
+				}
+			}
+
+			err := registry.Configure(test.enabled, test.disabled)
+			if test.isErrExpected {
+				if err == nil {
+					t.Fatalf("Test %q failed: expected error not to be nil.", test.description)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Test %q failed: expected error to be nil, got %v", test.description, err)
+			}
+			names := validatorNames(registry.Validators("ChaosEngine", v1beta1.Create))
+			if !reflect.DeepEqual(names, test.expected) {
+				t.Fatalf("Test %q failed: expected validators %v, got %v", test.description, test.expected, names)
+			}
+			if validators := registry.Validators("ChaosEngine", v1beta1.Delete); len(validators) != 0 {
+				t.Fatalf("Test %q failed: expected no validators of deletes, got %v", test.description, validatorNames(validators))
+			}
+		})
+	}
+}
+
+func TestCollectValidationErrorsSeverity(t *testing.T) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	webhook := newTestWebhook(t, stopCh, nil, nil)
+	attr := &Attributes{
+		Request: &v1beta1.AdmissionRequest{
+			Kind:      metav1.GroupVersionKind{Kind: "ChaosEngine"},
+			Operation: v1beta1.Create,
+		},
+	}
+
+	err := webhook.CollectValidationErrors(context.Background(), attr,
+		&testValidator{name: "warning", severity: SeverityWarning, err: fmt.Errorf("warning")})
+	if err != nil {
+		t.Fatalf("expected warnings not to fail validation, got %v", err)
+	}
+
+	err = webhook.CollectValidationErrors(context.Background(), attr,
+		&testValidator{name: "warning", severity: SeverityWarning, err: fmt.Errorf("warning")},
+		&testValidator{name: "error", severity: SeverityError, err: fmt.Errorf("error")})
+	if err == nil || err.Error() != "error" {
+		t.Fatalf("expected only the error to fail validation, got %v", err)
+	}
+}
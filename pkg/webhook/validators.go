@@ -0,0 +1,126 @@
+/*
+Copyright 2019 The LitmusChaos Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/api/admission/v1beta1"
+
+	"github.com/litmuschaos/chaos-operator/pkg/apis/litmuschaos/v1alpha1"
+)
+
+// Names of the built-in validators
+const (
+	SelfProtectionValidator       = "self-protection"
+	ResourceProtectionValidator   = "resource-protection"
+	ChaosTargetValidator          = "chaos-target"
+	ExperimentConfigMapsValidator = "experiment-configmaps"
+	ExperimentSecretsValidator    = "experiment-secrets"
+	ChaosExperimentsValidator     = "chaos-experiments"
+	ApplicationNamespaceValidator = "application-namespace"
+	ActiveReferencesValidator     = "active-references"
+)
+
+// chaosEngineValidator adapts a ChaosEngine validation of the webhook to the
+// Validator interface
+type chaosEngineValidator struct {
+	name     string
+	validate func(*v1alpha1.ChaosEngine) error
+}
+
+func (v *chaosEngineValidator) Name() string { return v.name }
+
+func (v *chaosEngineValidator) Kinds() []string { return []string{"ChaosEngine"} }
+
+func (v *chaosEngineValidator) Operations() []v1beta1.Operation {
+	return []v1beta1.Operation{v1beta1.Create, v1beta1.Update}
+}
+
+func (v *chaosEngineValidator) Severity() Severity { return SeverityError }
+
+func (v *chaosEngineValidator) Validate(ctx context.Context, attr *Attributes) error {
+	chaosEngine, ok := attr.ChaosEngine()
+	if !ok {
+		return fmt.Errorf("unable to validate %s, a ChaosEngine is expected", attr.Request.Kind.Kind)
+	}
+	return v.validate(chaosEngine)
+}
+
+// requestValidator adapts a validation of the admission request to the
+// Validator interface
+type requestValidator struct {
+	name       string
+	kinds      []string
+	operations []v1beta1.Operation
+	validate   func(*v1beta1.AdmissionRequest) error
+}
+
+func (v *requestValidator) Name() string { return v.name }
+
+func (v *requestValidator) Kinds() []string { return v.kinds }
+
+func (v *requestValidator) Operations() []v1beta1.Operation { return v.operations }
+
+func (v *requestValidator) Severity() Severity { return SeverityError }
+
+func (v *requestValidator) Validate(ctx context.Context, attr *Attributes) error {
+	return v.validate(attr.Request)
+}
+
+// newValidatorRegistry returns a registry holding the built-in validators of
+// the webhook followed by the ones of the DefaultRegistry
+func newValidatorRegistry(wh *webhook) (*Registry, error) {
+	registry := NewRegistry()
+
+	mandatory := []Validator{
+		&chaosEngineValidator{name: SelfProtectionValidator, validate: wh.ValidateSelfProtection},
+		&requestValidator{
+			name:       ResourceProtectionValidator,
+			kinds:      []string{"Secret", "Service"},
+			operations: []v1beta1.Operation{v1beta1.Update, v1beta1.Delete},
+			validate:   wh.validateProtectedResource,
+		},
+	}
+	for _, v := range mandatory {
+		if err := registry.registerMandatory(v); err != nil {
+			return nil, err
+		}
+	}
+
+	validators := []Validator{
+		&chaosEngineValidator{name: ChaosTargetValidator, validate: wh.ValidateChaosTarget},
+		&chaosEngineValidator{name: ExperimentConfigMapsValidator, validate: wh.ValidateChaosExperimentsConfigMaps},
+		&chaosEngineValidator{name: ExperimentSecretsValidator, validate: wh.ValidateChaosExperimentsSecrets},
+		&chaosEngineValidator{name: ChaosExperimentsValidator, validate: wh.ValidateChaosExperimentInApplicationNamespaces},
+		&chaosEngineValidator{name: ApplicationNamespaceValidator, validate: wh.ValidateApplicationNamespace},
+		&requestValidator{
+			name:       ActiveReferencesValidator,
+			kinds:      []string{"ChaosExperiment", "ConfigMap", "Secret"},
+			operations: []v1beta1.Operation{v1beta1.Delete},
+			validate:   wh.validateReferencedResource,
+		},
+	}
+	validators = append(validators, DefaultRegistry.all()...)
+	for _, v := range validators {
+		if err := registry.Register(v); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
@@ -17,15 +17,20 @@ limitations under the License.
 package webhook
 
 import (
-	"crypto/tls"
-	"crypto/x509"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/api/admission/v1beta1"
 	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
 	v1 "k8s.io/api/apps/v1"
@@ -34,9 +39,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/klog"
 
-	"github.com/litmuschaos/chaos-operator/pkg/apis/litmuschaos/v1alpha1"
 	litmuschaosv1alpha1 "github.com/litmuschaos/chaos-operator/pkg/client/clientset/versioned"
 )
 
@@ -89,6 +92,78 @@ type webhook struct {
 	kubeClient kubernetes.Interface
 
 	litmusClient litmuschaosv1alpha1.Interface
+
+	// cache holds the informers the validations read from
+	cache *clusterCache
+
+	// adminGroups are allowed to modify the resources of the admission controller
+	adminGroups []string
+
+	// registry holds the validators run against the admission requests
+	registry *Registry
+
+	// pipeline runs the validators of a request concurrently
+	pipeline *pipeline
+
+	// inconclusivePolicy handles the validators which did not complete in time
+	inconclusivePolicy InconclusivePolicy
+
+	// modes are the configured modes of the validators
+	modes *ModeConfig
+
+	// certificate holds the *servingCertificate served to the API server, it
+	// is replaced when the certificate is renewed
+	certificate atomic.Value
+
+	// certExpiryThreshold is the time before the expiry of the serving
+	// certificate from which the admission controller isn't ready
+	certExpiryThreshold time.Duration
+
+	// certRenewBefore is the time before the expiry of the serving
+	// certificate from which it is renewed
+	certRenewBefore time.Duration
+
+	// certCheckInterval is the interval at which the certificates are
+	// checked for renewal, 0 disables the renewal
+	certCheckInterval time.Duration
+
+	// caRenewBefore is the time before the expiry of the CA from which it is
+	// replaced
+	caRenewBefore time.Duration
+
+	// caGracePeriod is how long a replaced CA stays in the caBundle
+	caGracePeriod time.Duration
+
+	// caBundleSyncInterval is the interval at which the caBundle of the
+	// webhooks is synced with the Secret, 0 disables the sync
+	caBundleSyncInterval time.Duration
+
+	// certFiles are the files the serving certificate is reloaded from, nil
+	// if it comes from a Secret
+	certFiles *certFiles
+
+	// serviceAccountUser is the username the admission controller
+	// authenticates with, allowed to modify its protected resources
+	serviceAccountUser string
+
+	// webhookConfig is the name of the ValidatingWebhookConfiguration
+	// registering the webhooks served
+	webhookConfig string
+
+	// webhookConfigStatus holds the *webhookConfigStatus of the last check
+	// of the webhook configuration, read by the readiness probe
+	webhookConfigStatus atomic.Value
+
+	// devSession is the webhook configuration registered by the
+	// development server, nil otherwise
+	devSession *devSession
+
+	// csr requests the certificates of the Secret from the signer of the
+	// cluster, nil if they are self-signed
+	csr *csrIssuer
+
+	// auditor records the admission decisions, auditing is disabled if nil
+	auditor *Auditor
 }
 
 // Parameters are server configures parameters
@@ -99,6 +174,98 @@ type Parameters struct {
 	CertFile string
 	//KeyFile is path to the x509 private key matching `CertFile`
 	KeyFile string
+	// CAFile is the optional path to the CA which signed `CertFile`, set in
+	// the caBundle of the webhooks
+	CAFile string
+	// CertFileCheckInterval is the interval at which the files are checked
+	// for changes
+	CertFileCheckInterval time.Duration
+	// AdminGroups are the user groups allowed to update or delete the
+	// Secret and Service of the admission controller
+	AdminGroups []string
+	// EnabledValidators, if set, are the only validators run besides the
+	// mandatory ones
+	EnabledValidators []string
+	// DisabledValidators are the validators which are not run
+	DisabledValidators []string
+	// ValidatorWorkers is the number of validators run at once
+	ValidatorWorkers int
+	// ValidatorTimeout bounds every validator, besides the timeout of the
+	// admission request
+	ValidatorTimeout time.Duration
+	// InconclusivePolicy handles the validators which did not complete in time
+	InconclusivePolicy InconclusivePolicy
+	// Modes are the modes of the validators, all validators are enforced if nil
+	Modes *ModeConfig
+	// CertExpiryThreshold is the time before the expiry of the serving
+	// certificate from which the readiness probe fails
+	CertExpiryThreshold time.Duration
+	// CertRenewBefore is the time before the expiry of the serving
+	// certificate from which it is renewed
+	CertRenewBefore time.Duration
+	// CertCheckInterval is the interval at which the certificates are
+	// checked for renewal, 0 disables the renewal
+	CertCheckInterval time.Duration
+	// CARenewBefore is the time before the expiry of the CA from which it is
+	// replaced
+	CARenewBefore time.Duration
+	// CAGracePeriod is how long a replaced CA stays in the caBundle
+	CAGracePeriod time.Duration
+	// CABundleSyncInterval is the interval at which the caBundle of the
+	// webhooks is synced with the Secret, 0 disables the sync
+	CABundleSyncInterval time.Duration
+	// CertManager serves the certificate issued by cert-manager instead of
+	// the self-signed one of the Secret
+	CertManager CertManagerOptions
+	// CSR requests the certificate of the Secret from the signer of the
+	// cluster instead of a self-signed CA
+	CSR CSROptions
+	// TLS is the TLS policy of the server
+	TLS TLSOptions
+	// Auditor records the admission decisions, auditing is disabled if nil
+	Auditor *Auditor
+	// DevHost, if set, is the host or IP the API server reaches a webhook
+	// server running outside of the cluster at, see newDev
+	DevHost string
+}
+
+// CertificateMode is where the serving certificate comes from
+type CertificateMode string
+
+const (
+	// CertificateModeSecret serves the self-signed certificate of the Secret
+	CertificateModeSecret CertificateMode = "secret"
+	// CertificateModeFiles serves the certificate files of -tlsCertFile
+	CertificateModeFiles CertificateMode = "files"
+	// CertificateModeCertManager serves the certificate issued by cert-manager
+	CertificateModeCertManager CertificateMode = "cert-manager"
+	// CertificateModeCSR serves the certificate of the Secret signed by the
+	// signer of the cluster
+	CertificateModeCSR CertificateMode = "csr"
+)
+
+// CertificateMode returns where the serving certificate comes from. Both the
+// bootstrap and the server must use it, so that they agree on the mode, and
+// it fails when several exclusive modes are set.
+func (p Parameters) CertificateMode() (CertificateMode, error) {
+	var modes []string
+	mode := CertificateModeSecret
+	if p.CertFile != "" {
+		modes = append(modes, "-tlsCertFile")
+		mode = CertificateModeFiles
+	}
+	if p.CertManager.Enabled {
+		modes = append(modes, "-certManager")
+		mode = CertificateModeCertManager
+	}
+	if p.CSR.Enabled {
+		modes = append(modes, "-csr")
+		mode = CertificateModeCSR
+	}
+	if len(modes) > 1 {
+		return "", fmt.Errorf("%s are mutually exclusive", strings.Join(modes, ", "))
+	}
+	return mode, nil
 }
 
 func init() {
@@ -116,6 +283,39 @@ func New(p Parameters, kubeClient kubernetes.Interface,
 	litmusClient litmuschaosv1alpha1.Interface) (
 	*webhook, error) {
 
+	if p.DevHost != "" {
+		return newDev(p, kubeClient, litmusClient)
+	}
+	// the resources of the admission controller are protected from all the
+	// users but itself, so it must know who it is
+	serviceAccountUser, err := getServiceAccountUser()
+	if err != nil {
+		return nil, err
+	}
+	wh, err := newServer(p, kubeClient, litmusClient)
+	if err != nil {
+		return nil, err
+	}
+	wh.serviceAccountUser = serviceAccountUser
+	Logger(SubsystemBootstrap).Info("Exempting the admission controller from the resource protection", "username", serviceAccountUser)
+	return wh, nil
+}
+
+// newServer returns a webhook serving the certificate of cert-manager, of the
+// certificate files or of the Secret
+func newServer(p Parameters, kubeClient kubernetes.Interface,
+	litmusClient litmuschaosv1alpha1.Interface) (*webhook, error) {
+	mode, err := p.CertificateMode()
+	if err != nil {
+		return nil, err
+	}
+	switch mode {
+	case CertificateModeCertManager:
+		return newCertManager(p, kubeClient, litmusClient)
+	case CertificateModeFiles:
+		return newCertFiles(p, kubeClient, litmusClient)
+	}
+
 	admNamespace, err := getLitmusNamespace()
 	if err != nil {
 		return nil, err
@@ -131,131 +331,254 @@ func New(p Parameters, kubeClient kubernetes.Interface,
 		)
 	}
 
-	// extract cert information from the secret object
-	certBytes, ok := certSecret.Data[appCrt]
-	if !ok {
-		return nil, fmt.Errorf(
-			"%s value not found in %s secret",
-			appCrt,
-			validatorSecret,
-		)
-	}
-	keyBytes, ok := certSecret.Data[appKey]
-	if !ok {
-		return nil, fmt.Errorf(
-			"%s value not found in %s secret",
-			appKey,
-			validatorSecret,
-		)
+	certBytes, keyBytes, signingCertBytes, err := secretCertificates(certSecret, selfSignedKeys)
+	if err != nil {
+		return nil, err
 	}
 
-	signingCertBytes, ok := certSecret.Data[rootCrt]
-	if !ok {
-		return nil, fmt.Errorf(
-			"%s value not found in %s secret",
-			rootCrt,
-			validatorSecret,
-		)
+	wh, err := newWebhook(p, kubeClient, litmusClient)
+	if err != nil {
+		return nil, err
 	}
+	if err := wh.setServingCertificate(p, certBytes, keyBytes, signingCertBytes); err != nil {
+		return nil, err
+	}
+	if mode == CertificateModeCSR {
+		wh.csr = &csrIssuer{opts: p.CSR, kubeClient: kubeClient}
+	}
+	Logger(SubsystemTLS).Info("Loaded serving certificate", "secret", validatorSecret,
+		"dnsNames", wh.serving().cert.DNSNames, "notAfter", wh.serving().cert.NotAfter.String())
+	return wh, nil
+}
 
-	certPool := x509.NewCertPool()
-	ok = certPool.AppendCertsFromPEM(signingCertBytes)
-	if !ok {
-		return nil, fmt.Errorf("failed to parse root certificate")
+// setServingCertificate sets up the server of the webhook to serve the given
+// PEM encoded certificate, signed by the given CA, until it is renewed
+func (wh *webhook) setServingCertificate(p Parameters, certBytes, keyBytes, signingCertBytes []byte) error {
+	if err := wh.loadServingCertificate(certBytes, keyBytes, signingCertBytes); err != nil {
+		return err
 	}
+	wh.Server = &http.Server{
+		Addr:      fmt.Sprintf(":%v", p.Port),
+		TLSConfig: p.TLS.config(wh.getCertificate),
+	}
+	wh.certExpiryThreshold = p.CertExpiryThreshold
+	wh.certRenewBefore = p.CertRenewBefore
+	wh.certCheckInterval = p.CertCheckInterval
+	wh.caRenewBefore = p.CARenewBefore
+	wh.caGracePeriod = p.CAGracePeriod
+	wh.caBundleSyncInterval = p.CABundleSyncInterval
+	return nil
+}
 
-	sCert, err := tls.X509KeyPair(certBytes, keyBytes)
+// newWebhook returns a webhook running the configured validators against the
+// informer caches of the given clients, without a server
+func newWebhook(p Parameters, kubeClient kubernetes.Interface,
+	litmusClient litmuschaosv1alpha1.Interface) (*webhook, error) {
+	clusterCache, err := newClusterCache(kubeClient, litmusClient)
 	if err != nil {
 		return nil, err
 	}
 
 	wh := &webhook{
-		Server: &http.Server{
-			Addr:      fmt.Sprintf(":%v", p.Port),
-			TLSConfig: &tls.Config{Certificates: []tls.Certificate{sCert}},
-		},
-		kubeClient:   kubeClient,
-		litmusClient: litmusClient,
+		kubeClient:         kubeClient,
+		litmusClient:       litmusClient,
+		cache:              clusterCache,
+		adminGroups:        p.AdminGroups,
+		pipeline:           newPipeline(p.ValidatorWorkers, p.ValidatorTimeout),
+		inconclusivePolicy: p.InconclusivePolicy,
+		modes:              p.Modes,
+		auditor:            p.Auditor,
+		webhookConfig:      validatorWebhook,
 		//snapClientSet: snapClient,
 	}
+
+	wh.registry, err = newValidatorRegistry(wh)
+	if err != nil {
+		return nil, err
+	}
+	if err := wh.registry.Configure(p.EnabledValidators, p.DisabledValidators); err != nil {
+		return nil, err
+	}
+	if p.Modes != nil {
+		if err := p.Modes.check(wh.registry); err != nil {
+			return nil, err
+		}
+	}
 	return wh, nil
 }
 
-func (wh *webhook) validateChaosEngineCreateUpdate(req *v1beta1.AdmissionRequest) *v1beta1.AdmissionResponse {
-	response := &v1beta1.AdmissionResponse{}
+// admissionResponse is an AdmissionResponse along with the warnings field
+// added to the admission API in kubernetes 1.19, older API servers ignore it
+type admissionResponse struct {
+	*v1beta1.AdmissionResponse
+	// Warnings are shown to the user who sent the request
+	Warnings []string `json:"warnings,omitempty"`
+	// results are the results of the validators, recorded in the audit log
+	results []Result
+}
+
+// admissionReview is the AdmissionReview answered to the API server
+type admissionReview struct {
+	metav1.TypeMeta `json:",inline"`
+	Request         *v1beta1.AdmissionRequest `json:"request,omitempty"`
+	Response        *admissionResponse        `json:"response,omitempty"`
+}
+
+// errorCodesAnnotation is the audit annotation holding the error codes of the
+// failures of a request, the API server prefixes it with the webhook name
+const errorCodesAnnotation = "error-codes"
+
+// newAdmissionResponse returns a response allowing the request with the
+// messages of the given results as warnings
+func newAdmissionResponse(warnings []Result) *admissionResponse {
+	response := &admissionResponse{AdmissionResponse: &v1beta1.AdmissionResponse{}}
 	response.Allowed = true
-	var chaosEngine v1alpha1.ChaosEngine
-	err := json.Unmarshal(req.Object.Raw, &chaosEngine)
-	if err != nil {
-		klog.Errorf("Could not unmarshal raw object: %v, %v", err, req.Object.Raw)
-		response.Allowed = false
-		response.Result = &metav1.Status{
-			Status:  metav1.StatusFailure,
-			Code:    http.StatusBadRequest,
-			Reason:  metav1.StatusReasonBadRequest,
-			Message: err.Error(),
+	for _, result := range warnings {
+		response.Warnings = append(response.Warnings, result.Err.Error())
+	}
+	return response
+}
+
+// annotateErrorCodes records the error codes of the given failures in the
+// audit annotations of the response
+func (r *admissionResponse) annotateErrorCodes(results []Result) {
+	codes := resultCodes(results)
+	if len(codes) == 0 {
+		return
+	}
+	r.annotate(errorCodesAnnotation, strings.Join(codes, ","))
+}
+
+// annotate sets an audit annotation of the response
+func (r *admissionResponse) annotate(key, value string) {
+	if r.AuditAnnotations == nil {
+		r.AuditAnnotations = map[string]string{}
+	}
+	r.AuditAnnotations[key] = value
+}
+
+func (wh *webhook) validateChaosEngineCreateUpdate(ctx context.Context, attr *Attributes) *admissionResponse {
+	req := attr.Request
+	results := wh.runValidators(ctx, attr, wh.registry.Validators(req.Kind.Kind, req.Operation))
+	recordResults(results)
+	denials, warnings := wh.classify(ctx, results)
+	recordDenials(denials)
+	response := newAdmissionResponse(warnings)
+	response.results = results
+	response.annotateErrorCodes(append(denials, warnings...))
+	log := loggerFrom(ctx, SubsystemValidators)
+
+	var protectionErrors, validationErrors []Result
+	for _, result := range denials {
+		if wh.registry.IsMandatory(result.Validator.Name()) {
+			protectionErrors = append(protectionErrors, result)
+		} else {
+			validationErrors = append(validationErrors, result)
 		}
+	}
+
+	// mandatory validators, i.e. self protection, are never overridden
+	if len(protectionErrors) != 0 {
+		log.V(2).Info("Self protection denied ChaosEngine")
+		response.Allowed = false
+		response.Result = denialStatus(attr, http.StatusForbidden, metav1.StatusReasonForbidden, protectionErrors)
 		return response
 	}
-  
-	err = wh.CollectValidationErrors(&chaosEngine,
-		wh.ValidateChaosTarget,
-		wh.ValidateChaosExperimentsConfigMaps,
-		wh.ValidateChaosExperimentsSecrets,
-		wh.ValidateChaosExperimentInApplicationNamespaces,
-    wh.ValidateApplicationNamespace)
 
-	if err != nil {
-		klog.V(2).Infof("Validation Failed for ChaosEngine: %v", chaosEngine.Name)
+	if len(validationErrors) != 0 {
+		log.V(2).Info("Validation failed for ChaosEngine")
 		response.Allowed = false
-		response.Result = &metav1.Status{
-			Status:  metav1.StatusFailure,
-			Code:    http.StatusBadRequest,
-			Reason:  metav1.StatusReasonBadRequest,
-			Message: err.Error(),
-		}
+		response.Result = denialStatus(attr, http.StatusBadRequest, metav1.StatusReasonBadRequest, validationErrors)
+		return response
 	}
 
-	klog.V(2).Infof("Validation Successful for ChaosEngine: %v", chaosEngine.Name)
-	response.Allowed = true
+	log.V(2).Info("Validation successful for ChaosEngine")
 	return response
 }
 
+// validateResource denies a request on any other kind if one of the
+// validators registered for it fails.
+func (wh *webhook) validateResource(ctx context.Context, attr *Attributes) *admissionResponse {
+	req := attr.Request
+	results := wh.runValidators(ctx, attr, wh.registry.Validators(req.Kind.Kind, req.Operation))
+	recordResults(results)
+	denials, warnings := wh.classify(ctx, results)
+	recordDenials(denials)
+	response := newAdmissionResponse(warnings)
+	response.results = results
+	response.annotateErrorCodes(append(denials, warnings...))
+
+	if len(denials) != 0 {
+		response.Allowed = false
+		response.Result = denialStatus(attr, http.StatusForbidden, metav1.StatusReasonForbidden, denials)
+	}
+	return response
+}
+
+// Start runs the informers of the webhook and blocks until their caches are
+// synced, the webhook server must not serve requests before.
+func (wh *webhook) Start(stopCh <-chan struct{}) error {
+	return wh.cache.Start(stopCh)
+}
+
 // validate validates the chaosengine create, update request
-func (wh *webhook) validate(ar *v1beta1.AdmissionReview) *v1beta1.AdmissionResponse {
+func (wh *webhook) validate(ctx context.Context, ar *v1beta1.AdmissionReview) *admissionResponse {
 	req := ar.Request
-	var (
-		resourceName string
-	)
-	klog.Infof("AdmissionReview for Kind=%v, Namespace=%v Name=%v (%v) UID=%v patchOperation=%v UserInfo=%v",
-		req.Kind, req.Namespace, req.Name, resourceName, req.UID, req.Operation, req.UserInfo)
-	response := &v1beta1.AdmissionResponse{}
-	response.Allowed = true
+	log := loggerFrom(ctx, SubsystemHTTP)
+	log.V(2).Info("Validating AdmissionReview", "resource", req.Resource.Resource, "subResource", req.SubResource,
+		"groups", req.UserInfo.Groups)
+
+	_, span := tracer().Start(ctx, "DecodeObject")
+	attr, err := newAttributes(req)
+	endSpan(span, err)
+	if err != nil {
+		log.Error(err, "Could not unmarshal raw object", "object", string(req.Object.Raw))
+		return &admissionResponse{
+			AdmissionResponse: &v1beta1.AdmissionResponse{
+				Result: &metav1.Status{
+					Status:  metav1.StatusFailure,
+					Code:    http.StatusBadRequest,
+					Reason:  metav1.StatusReasonBadRequest,
+					Message: err.Error(),
+				},
+			},
+		}
+	}
+
 	switch req.Kind.Kind {
 
 	case "ChaosEngine":
-		klog.V(0).Infof("Starting to validate, admission webhook request for type: %s", req.Kind.Kind)
-		return wh.validateChaosEngine(ar)
+		return wh.validateChaosEngine(ctx, attr)
 
 	default:
-		return response
+		return wh.validateResource(ctx, attr)
 	}
 
 }
 
-func (wh *webhook) validateChaosEngine(ar *v1beta1.AdmissionReview) *v1beta1.AdmissionResponse {
-	req := ar.Request
-	response := &v1beta1.AdmissionResponse{}
-	response.Allowed = true
+func (wh *webhook) validateChaosEngine(ctx context.Context, attr *Attributes) *admissionResponse {
+	req := attr.Request
+	response := newAdmissionResponse(nil)
 
 	if req.Operation == v1beta1.Create || req.Operation == v1beta1.Update {
-		return wh.validateChaosEngineCreateUpdate(req)
+		return wh.validateChaosEngineCreateUpdate(ctx, attr)
 	}
 	return response
 }
 
 // Serve method for webhook server, handles http requests for webhooks
 func (wh *webhook) Serve(w http.ResponseWriter, r *http.Request) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer().Start(ctx, "Serve", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+	log := Logger(SubsystemHTTP)
+
+	if !wh.hasVerifiedClient(r) {
+		log.Error(nil, "Client certificate required", "remoteAddr", r.RemoteAddr)
+		http.Error(w, "client certificate required", http.StatusUnauthorized)
+		return
+	}
+
 	var body []byte
 	if r.Body != nil {
 		if data, err := ioutil.ReadAll(r.Body); err == nil {
@@ -263,7 +586,7 @@ func (wh *webhook) Serve(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	if len(body) == 0 {
-		klog.Error("empty body")
+		log.Error(nil, "Empty body")
 		http.Error(w, "empty body", http.StatusBadRequest)
 		return
 	}
@@ -271,29 +594,60 @@ func (wh *webhook) Serve(w http.ResponseWriter, r *http.Request) {
 	// verify the content type is accurate
 	contentType := r.Header.Get("Content-Type")
 	if contentType != "application/json" {
-		klog.Errorf("Content-Type=%s, expect application/json", contentType)
+		log.Error(nil, "Invalid Content-Type, expect application/json", "contentType", contentType)
 		http.Error(w, "invalid Content-Type, expect `application/json`", http.StatusUnsupportedMediaType)
 		return
 	}
 
-	var admissionResponse *v1beta1.AdmissionResponse
+	var response *admissionResponse
 	ar := v1beta1.AdmissionReview{}
-	if _, _, err := deserializer.Decode(body, nil, &ar); err != nil {
-		klog.Errorf("Can't decode body: %v", err)
-		admissionResponse = &v1beta1.AdmissionResponse{
-			Result: &metav1.Status{
-				Message: err.Error(),
+	_, decodeSpan := tracer().Start(ctx, "Decode")
+	_, _, err := deserializer.Decode(body, nil, &ar)
+	endSpan(decodeSpan, err)
+	if err != nil {
+		log.Error(err, "Can't decode body")
+		response = &admissionResponse{
+			AdmissionResponse: &v1beta1.AdmissionResponse{
+				Result: &metav1.Status{
+					Message: err.Error(),
+				},
 			},
 		}
 	} else {
+		if ar.Request != nil {
+			span.SetAttributes(requestAttributes(ar.Request)...)
+			ctx = withRequestLogValues(ctx, ar.Request)
+			log = loggerFrom(ctx, SubsystemHTTP)
+		}
 		if r.URL.Path == "/validate" {
-			admissionResponse = wh.validate(&ar)
+			ctx, cancel := context.WithTimeout(ctx, requestBudget(r))
+			response = wh.validate(ctx, &ar)
+			cancel()
+		}
+	}
+	if response != nil {
+		span.SetAttributes(allowedKey.Bool(response.Allowed))
+		if span.SpanContext().IsValid() {
+			response.annotate(traceIDAnnotation, span.SpanContext().TraceID().String())
 		}
 	}
 
-	admissionReview := v1beta1.AdmissionReview{}
-	if admissionResponse != nil {
-		admissionReview.Response = admissionResponse
+	if ar.Request != nil {
+		recordRequest(ar.Request.Kind.Kind, string(ar.Request.Operation), response)
+	} else {
+		recordRequest("", "", response)
+	}
+	if response != nil && ar.Request != nil {
+		wh.auditor.Record(newDecisionRecord(ar.Request, response, response.AuditAnnotations[traceIDAnnotation]))
+	}
+	if response != nil {
+		log.Info("Admission request answered", "decision", responseResult(response), "warnings", len(response.Warnings),
+			"errorCodes", response.AuditAnnotations[errorCodesAnnotation])
+	}
+
+	admissionReview := admissionReview{}
+	if response != nil {
+		admissionReview.Response = response
 		if ar.Request != nil {
 			admissionReview.Response.UID = ar.Request.UID
 		}
@@ -301,34 +655,49 @@ func (wh *webhook) Serve(w http.ResponseWriter, r *http.Request) {
 
 	resp, err := json.Marshal(admissionReview)
 	if err != nil {
-		klog.Errorf("Can't encode response: %v", err)
+		log.Error(err, "Can't encode response")
 		http.Error(w, fmt.Sprintf("could not encode response: %v", err), http.StatusInternalServerError)
 	}
-	klog.V(5).Infof("Ready to write reponse ...")
+	log.V(5).Info("Ready to write response")
 	if _, err := w.Write(resp); err != nil {
-		klog.Errorf("Can't write response: %v", err)
+		log.Error(err, "Can't write response")
 		http.Error(w, fmt.Sprintf("could not write response: %v", err), http.StatusInternalServerError)
 	}
 }
 
-// CollectValidationErrors collects all the errors from validation of Chaos Engine
-// and returns the appended error message.
-func (wh *webhook) CollectValidationErrors(ce *v1alpha1.ChaosEngine, fs ...func(*v1alpha1.ChaosEngine) error) error {
+// runValidators runs the given validators concurrently and sets the mode of
+// their results. It records no metrics, the admission metrics are recorded by
+// the admission handlers only.
+func (wh *webhook) runValidators(ctx context.Context, attr *Attributes, validators []Validator) []Result {
+	results := wh.pipeline.Run(ctx, attr, validators)
+	wh.setModes(attr.Request.Namespace, results)
+	return results
+}
+
+// CollectValidationErrors runs the given validators concurrently and returns
+// the appended error message of the ones which would deny the request.
+// It records no admission metrics, i.e. when ChaosEngines are revalidated.
+// Failures of validators in warn or audit mode are only logged, and
+// inconclusive validators are handled according to the inconclusive policy.
+func (wh *webhook) CollectValidationErrors(ctx context.Context, attr *Attributes, validators ...Validator) error {
+	denials, _ := wh.classify(ctx, wh.runValidators(ctx, attr, validators))
+	return joinErrors(denials)
+}
+
+// joinErrors returns the appended error message of the given results, or nil
+// if there are none
+func joinErrors(results []Result) error {
 
-	// Collects all the errors from Chaos Engine validation functions
+	// Collects all the errors from the validators
 	// and returns a joint error, easier for debugging
 	var longError []string
-
-	// Loop over all the functions appended to this function for validation
-	for _, f := range fs {
-		if shortErr := f(ce); shortErr != nil {
-			longError = append(longError, shortErr.Error())
-		}
+	for _, result := range results {
+		longError = append(longError, result.Err.Error())
 	}
 
 	if len(longError) == 0 {
 		return nil
 	}
 
-	return fmt.Errorf(strings.Join(longError, "\n"))
+	return errors.New(strings.Join(longError, "\n"))
 }
@@ -0,0 +1,110 @@
+/*
+Copyright 2019 LitmusChaos Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCertificateMode(t *testing.T) {
+	var tests = []struct {
+		description     string
+		parameters      Parameters
+		expected        CertificateMode
+		isErrorExpected bool
+	}{
+		{
+			description: "The self-signed Secret is served by default.",
+			parameters:  Parameters{},
+			expected:    CertificateModeSecret,
+		},
+		{
+			description: "Certificate files are served with -tlsCertFile.",
+			parameters:  Parameters{CertFile: "tls.crt", KeyFile: "tls.key"},
+			expected:    CertificateModeFiles,
+		},
+		{
+			description: "The cert-manager certificate is served with -certManager.",
+			parameters:  Parameters{CertManager: CertManagerOptions{Enabled: true}},
+			expected:    CertificateModeCertManager,
+		},
+		{
+			description: "The signed certificate is served with -csr.",
+			parameters:  Parameters{CSR: CSROptions{Enabled: true}},
+			expected:    CertificateModeCSR,
+		},
+		{
+			description:     "Certificate files and cert-manager are exclusive.",
+			parameters:      Parameters{CertFile: "tls.crt", CertManager: CertManagerOptions{Enabled: true}},
+			isErrorExpected: true,
+		},
+		{
+			description:     "Certificate files and signing requests are exclusive.",
+			parameters:      Parameters{CertFile: "tls.crt", CSR: CSROptions{Enabled: true}},
+			isErrorExpected: true,
+		},
+		{
+			description:     "cert-manager and signing requests are exclusive.",
+			parameters:      Parameters{CertManager: CertManagerOptions{Enabled: true}, CSR: CSROptions{Enabled: true}},
+			isErrorExpected: true,
+		},
+	}
+	for _, test := range tests {
+		mode, err := test.parameters.CertificateMode()
+		if isError := err != nil; isError != test.isErrorExpected {
+			t.Fatalf("Test %q failed: expected error %v, got %v", test.description, test.isErrorExpected, err)
+		}
+		if mode != test.expected {
+			t.Fatalf("Test %q failed: expected mode %q, got %q", test.description, test.expected, mode)
+		}
+	}
+}
+
+func TestJoinErrors(t *testing.T) {
+	var tests = []struct {
+		description string
+		results     []Result
+		expected    string
+	}{
+		{
+			description: "No failures join into no error.",
+		},
+		{
+			description: "Failures are joined line by line.",
+			results:     []Result{{Err: errors.New("first")}, {Err: errors.New("second")}},
+			expected:    "first\nsecond",
+		},
+		{
+			description: "Percent signs of the failures are kept.",
+			results:     []Result{{Err: errors.New("applabel app=100%s matches no pods")}},
+			expected:    "applabel app=100%s matches no pods",
+		},
+	}
+	for _, test := range tests {
+		err := joinErrors(test.results)
+		if test.expected == "" {
+			if err != nil {
+				t.Fatalf("Test %q failed: expected error to be nil, got %v", test.description, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != test.expected {
+			t.Fatalf("Test %q failed: expected error %q, got %v", test.description, test.expected, err)
+		}
+	}
+}